@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/luthermonson/go-proxmox"
+)
+
+// authorizeKeyScript appends stdin to the authorized_keys of the user given
+// as first argument
+const authorizeKeyScript = `set -e
+home=$(getent passwd "$1" | cut -d: -f6)
+[ -n "$home" ] || { echo "user $1 not found" >&2; exit 1; }
+mkdir -p "$home/.ssh"
+cat >> "$home/.ssh/authorized_keys"
+chown -R "$1": "$home/.ssh"
+chmod 700 "$home/.ssh"
+chmod 600 "$home/.ssh/authorized_keys"`
+
+// adopting returns true if an existing VM is taken over instead of creating one
+func (d *Driver) adopting() bool {
+	return len(d.ExistingVMID) > 0
+}
+
+// findExistingVM returns ExistingVMID from the cluster resources
+func (d *Driver) findExistingVM() (*clusterVM, error) {
+	id, err := strconv.Atoi(d.ExistingVMID)
+	if err != nil {
+		return nil, err
+	}
+	vms, err := d.getClusterVMs()
+	if err != nil {
+		return nil, err
+	}
+	for _, vm := range vms {
+		if vm.VMID != id {
+			continue
+		}
+		if vm.Template == 1 {
+			return nil, fmt.Errorf("VM %d is a template, clone it with --proxmoxve-vm-clone-vmid instead", id)
+		}
+		return &vm, nil
+	}
+	return nil, fmt.Errorf("VM %d not found", id)
+}
+
+// validateExistingVM checks that ExistingVMID exists and is no template
+func (d *Driver) validateExistingVM() []string {
+	if _, err := d.findExistingVM(); err != nil {
+		return []string{"proxmoxve-vm-existing-vmid: " + err.Error()}
+	}
+	return nil
+}
+
+// agentRunning returns true if the guest agent of the VM responds
+func (d *Driver) agentRunning() bool {
+	return d.client.Post(context.Background(), fmt.Sprintf("/nodes/%s/qemu/%d/agent/ping", d.Node, d.VMID), nil, nil) == nil
+}
+
+// authorizeKey adds the public keys, one per line, to the authorized_keys of
+// the ssh user via the guest agent
+func (d *Driver) authorizeKey(key string) error {
+	status, err := d.agentExec([]string{"/bin/sh", "-c", authorizeKeyScript, "sh", d.GetSSHUsername()}, key+"\n")
+	if err != nil {
+		return fmt.Errorf("unable to add the ssh key to VM %d: %w", d.VMID, err)
+	}
+	if status.ExitCode != 0 {
+		return fmt.Errorf("unable to add the ssh key to VM %d: %s", d.VMID, strings.TrimSpace(status.ErrData))
+	}
+	return nil
+}
+
+// rebootVM reboots the VM, which regenerates its cloud-init drive
+func (d *Driver) rebootVM() error {
+	var upid proxmox.UPID
+	if err := d.client.Post(context.Background(), fmt.Sprintf("/nodes/%s/qemu/%d/status/reboot", d.Node, d.VMID), nil, &upid); err != nil {
+		return err
+	}
+	return proxmox.NewTask(upid, d.client).Wait(context.Background(), d.taskInterval, d.taskTimeout)
+}
+
+// adoptVM takes over ExistingVMID instead of creating a VM. The generated
+// ssh key is added via the guest agent of a running VM, otherwise via
+// cloud-init, which applies it on the next boot. The VM is marked adopted
+// before anything else, so removing the machine after a failed adoption, as
+// Rancher does, detaches the VM instead of removing it.
+func (d *Driver) adoptVM() error {
+	existing, err := d.findExistingVM()
+	if err != nil {
+		return err
+	}
+	d.Adopted = true
+	d.Node = existing.Node
+	d.VMID = existing.VMID
+	d.VMName = existing.Name
+	d.debugf("adopting VM %d '%s' on node %s", d.VMID, d.VMName, d.Node)
+
+	config, err := d.getVMConfig(d.Node, d.VMID)
+	if err != nil {
+		return err
+	}
+	if len(d.GuestUsername) == 0 {
+		d.GuestUsername = "root"
+		if ciUser, _ := config["ciuser"].(string); len(ciUser) > 0 {
+			d.GuestUsername = ciUser
+		}
+	}
+
+	vm, err := d.GetVM()
+	if err != nil {
+		return err
+	}
+	sshKeys, err := d.appendVmSshKeys(vm)
+	if err != nil {
+		return err
+	}
+
+	running := existing.Status == "running"
+	if running && d.agentRunning() {
+		key, err := os.ReadFile(d.GetSSHKeyPath() + ".pub")
+		if err != nil {
+			return err
+		}
+		keys, err := d.extraSSHKeys()
+		if err != nil {
+			return err
+		}
+		if err := d.authorizeKey(strings.Join(append(keys, strings.TrimSpace(string(key))), "\n")); err != nil {
+			return err
+		}
+	} else {
+		if len(cloudInitDrive(config)) == 0 {
+			return fmt.Errorf("VM %d has neither a running guest agent nor a cloud-init drive to add the ssh key with", d.VMID)
+		}
+		if err := d.ConfigureVM("sshkeys", sshKeys); err != nil {
+			return err
+		}
+		if running {
+			d.debugf("rebooting VM %d to apply the ssh key", d.VMID)
+			if err := d.rebootVM(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !running {
+		if err := d.Start(); err != nil {
+			return err
+		}
+	}
+
+	ip, err := d.GetIP()
+	if err != nil {
+		return err
+	}
+	d.debugf("VM got an IP: %s", ip)
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ValidateExistingVMID(t *testing.T) {
+	var driver = createDriver()
+	driver.DiskSize = "16"
+	driver.Memory = 8 * 1024
+	driver.GuestSSHPort = 22
+	driver.VMIDRange = "100:200"
+	driver.ExistingVMID = "150"
+
+	assert.True(t, driver.adopting())
+	// neither a clone source nor an image is needed
+	assert.Empty(t, driver.validateFlags())
+
+	driver.ExistingVMID = "web-1"
+	driver.CloneVMID = "9000"
+	assert.Equal(t, []string{
+		"proxmoxve-vm-existing-vmid must be numeric, got 'web-1'",
+		"proxmoxve-vm-existing-vmid can't be combined with proxmoxve-vm-clone-vmid, proxmoxve-vm-clone-name, proxmoxve-vm-image-file, proxmoxve-vm-cloud-image-url or proxmoxve-vm-arch",
+	}, driver.validateFlags())
+}
+
+func Test_RemoveAdoptedVM(t *testing.T) {
+	var driver = createDriver()
+	driver.VMID = 101
+	driver.Adopted = true
+	// detached without contacting the cluster
+	assert.Nil(t, driver.Remove())
+
+	driver.ExistingRemove = true
+	assert.NotNil(t, driver.Remove())
+}
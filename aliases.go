@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/labstack/gommon/log"
+	"github.com/rancher/machine/libmachine/drivers"
+	"github.com/rancher/machine/libmachine/mcnflag"
+)
+
+// flagAlias maps a flag of the upstream proxmox-ve driver (before the rename
+// to proxmoxve) to the flag of this driver
+type flagAlias struct {
+	Name   string
+	EnvVar string
+	Target string
+}
+
+var flagAliases = []flagAlias{
+	{"proxmox-host", "PROXMOX_HOST", "proxmoxve-proxmox-host"},
+	{"proxmox-node", "PROXMOX_NODE", "proxmoxve-proxmox-node"},
+	{"proxmox-user", "PROXMOX_USER", "proxmoxve-proxmox-user-name"},
+	{"proxmox-password", "PROXMOX_PASSWORD", "proxmoxve-proxmox-user-password"},
+	{"proxmox-realm", "PROXMOX_REALM", "proxmoxve-proxmox-realm"},
+	{"proxmox-pool", "PROXMOX_POOL", "proxmoxve-proxmox-pool"},
+	{"proxmox-storage", "PROXMOX_STORAGE", "proxmoxve-vm-storage-path"},
+	{"proxmox-storage-type", "PROXMOX_STORAGE_TYPE", "proxmoxve-vm-storage-type"},
+	{"proxmox-disksize-gb", "PROXMOX_DISKSIZE_GB", "proxmoxve-vm-storage-size"},
+	{"proxmox-memory-gb", "PROXMOX_MEMORY_GB", "proxmoxve-vm-memory"},
+	{"proxmox-image-file", "PROXMOX_IMAGE_FILE", "proxmoxve-vm-image-file"},
+	{"proxmox-guest-username", "PROXMOX_GUEST_USERNAME", "proxmoxve-ssh-username"},
+	{"proxmox-guest-password", "PROXMOX_GUEST_PASSWORD", "proxmoxve-ssh-password"},
+	{"proxmox-guest-ssh-port", "PROXMOX_GUEST_SSH_PORT", "proxmoxve-ssh-port"},
+	{"proxmox-driver-debug", "PROXMOX_DRIVER_DEBUG", "proxmoxve-debug-driver"},
+}
+
+// aliasFlags returns the deprecated flags accepted for compatibility with the
+// upstream driver, typed like the flags they are aliases for
+func aliasFlags(flags []mcnflag.Flag) []mcnflag.Flag {
+	var aliases []mcnflag.Flag
+	for _, a := range flagAliases {
+		usage := fmt.Sprintf("deprecated, use --%s instead", a.Target)
+		for _, f := range flags {
+			if f.String() != a.Target {
+				continue
+			}
+			switch f.(type) {
+			case mcnflag.StringFlag:
+				aliases = append(aliases, mcnflag.StringFlag{Name: a.Name, EnvVar: a.EnvVar, Usage: usage})
+			case mcnflag.IntFlag:
+				aliases = append(aliases, mcnflag.IntFlag{Name: a.Name, EnvVar: a.EnvVar, Usage: usage})
+			case mcnflag.BoolFlag:
+				aliases = append(aliases, mcnflag.BoolFlag{Name: a.Name, EnvVar: a.EnvVar, Usage: usage})
+			}
+		}
+	}
+	return aliases
+}
+
+// aliasOptions wraps the command line options and falls back to a deprecated
+// alias for every flag that is still set to its default value
+type aliasOptions struct {
+	drivers.DriverOptions
+	defaults map[string]interface{}
+}
+
+func (d *Driver) withFlagAliases(flags drivers.DriverOptions) drivers.DriverOptions {
+	return &aliasOptions{DriverOptions: flags, defaults: d.flagDefaults()}
+}
+
+func (o *aliasOptions) alias(key string) string {
+	for _, a := range flagAliases {
+		if a.Target == key {
+			return a.Name
+		}
+	}
+	return ""
+}
+
+func (o *aliasOptions) String(key string) string {
+	v := o.DriverOptions.String(key)
+	if a := o.alias(key); a != "" && v == o.defaults[key] {
+		if av := o.DriverOptions.String(a); av != "" {
+			log.Warnf("--%s is deprecated, use --%s instead", a, key)
+			return av
+		}
+	}
+	return v
+}
+
+func (o *aliasOptions) Int(key string) int {
+	v := o.DriverOptions.Int(key)
+	if a := o.alias(key); a != "" && v == o.defaults[key] {
+		if av := o.DriverOptions.Int(a); av != 0 {
+			log.Warnf("--%s is deprecated, use --%s instead", a, key)
+			return av
+		}
+	}
+	return v
+}
+
+func (o *aliasOptions) Bool(key string) bool {
+	v := o.DriverOptions.Bool(key)
+	if a := o.alias(key); a != "" && !v {
+		if o.DriverOptions.Bool(a) {
+			log.Warnf("--%s is deprecated, use --%s instead", a, key)
+			return true
+		}
+	}
+	return v
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// archAliases maps the names used by the kernel and Proxmox VE to the ones
+// used by Rancher and docker
+var archAliases = map[string]string{
+	"x86_64":  "amd64",
+	"aarch64": "arm64",
+}
+
+// normalizeArch returns the canonical name of an architecture, e.g. arm64 for aarch64
+func normalizeArch(arch string) string {
+	arch = strings.ToLower(strings.TrimSpace(arch))
+	if alias, ok := archAliases[arch]; ok {
+		return alias
+	}
+	return arch
+}
+
+// cloneSourceForArch returns the template ID or name mapped to the selected
+// architecture by --proxmoxve-vm-clone-arch-map
+func (d *Driver) cloneSourceForArch() (string, error) {
+	arch := normalizeArch(d.Arch)
+	for _, entry := range d.CloneArchMap {
+		k, v, ok := strings.Cut(entry, "=")
+		if !ok || len(strings.TrimSpace(v)) == 0 {
+			return "", fmt.Errorf("'%s' must be given as <arch>=<template id or name>", entry)
+		}
+		if normalizeArch(k) == arch {
+			return strings.TrimSpace(v), nil
+		}
+	}
+	return "", fmt.Errorf("no template mapped to architecture '%s'", d.Arch)
+}
+
+// clusterVM is a VM of the cluster resources listing
+type clusterVM struct {
+	VMID     int    `json:"vmid"`
+	Name     string `json:"name"`
+	Node     string `json:"node"`
+	Status   string `json:"status"`
+	Template int    `json:"template"`
+	Tags     string `json:"tags"`
+	MaxCPU   int    `json:"maxcpu"`
+	MaxMem   uint64 `json:"maxmem"`
+}
+
+// getClusterVMs lists the VMs of all nodes
+func (d *Driver) getClusterVMs() ([]clusterVM, error) {
+	if err := d.connect(); err != nil {
+		return nil, err
+	}
+
+	var vms []clusterVM
+	if err := d.client.Get(context.Background(), "/cluster/resources?type=vm", &vms); err != nil {
+		return nil, err
+	}
+	return vms, nil
+}
+
+// templateMatches returns true if the name matches the pattern, which is
+// either a name or a prefix followed by *
+func templateMatches(name, pattern string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+	return name == pattern
+}
+
+// newestTemplate returns the template sorting last by name, e.g. the newest
+// of templates named with a date or version suffix, then by VMID
+func newestTemplate(templates []clusterVM) clusterVM {
+	newest := templates[0]
+	for _, vm := range templates[1:] {
+		if vm.Name > newest.Name || (vm.Name == newest.Name && vm.VMID > newest.VMID) {
+			newest = vm
+		}
+	}
+	return newest
+}
+
+// findTemplate returns the ID of the template with the given name, or the
+// newest one matching a prefix like ubuntu-24.04-*, on the node. With
+// automatic node selection a template on another node is used if the node
+// has none.
+func (d *Driver) findTemplate(pattern string) (int, error) {
+	vms, err := d.getClusterVMs()
+	if err != nil {
+		return 0, err
+	}
+
+	var local, other []clusterVM
+	var nodes []string
+	for _, vm := range vms {
+		if vm.Template != 1 || !templateMatches(vm.Name, pattern) {
+			continue
+		}
+		if vm.Node == d.Node {
+			local = append(local, vm)
+			continue
+		}
+		other = append(other, vm)
+		nodes = append(nodes, vm.Node)
+	}
+	if len(local) > 0 {
+		return newestTemplate(local).VMID, nil
+	}
+	if len(other) > 0 && d.nodeAutoSelect() {
+		return newestTemplate(other).VMID, nil
+	}
+	if len(nodes) > 0 {
+		return 0, fmt.Errorf("template '%s' is not on node '%s' but on %s", pattern, d.Node, strings.Join(nodes, ", "))
+	}
+	return 0, fmt.Errorf("template '%s' not found", pattern)
+}
+
+// resolveCloneSource sets CloneVMID to the template named by
+// --proxmoxve-vm-clone-name or mapped to the selected architecture, if
+// --proxmoxve-vm-arch is given
+func (d *Driver) resolveCloneSource() error {
+	if len(d.Arch) == 0 {
+		if len(d.CloneName) == 0 {
+			return nil
+		}
+		vmid, err := d.findTemplate(d.CloneName)
+		if err != nil {
+			return err
+		}
+		if source := strconv.Itoa(vmid); source != d.CloneVMID {
+			d.debugf("using template %s for '%s'", source, d.CloneName)
+			d.CloneVMID = source
+		}
+		return nil
+	}
+
+	source, err := d.cloneSourceForArch()
+	if err != nil {
+		return err
+	}
+	if _, err := strconv.Atoi(source); err != nil {
+		vmid, err := d.findTemplate(source)
+		if err != nil {
+			return err
+		}
+		source = strconv.Itoa(vmid)
+	}
+
+	if source != d.CloneVMID {
+		d.debugf("using template %s for architecture %s", source, d.Arch)
+	}
+	d.CloneVMID = source
+	return nil
+}
+
+// isARM returns true if an arm64 VM is requested
+func (d *Driver) isARM() bool {
+	return normalizeArch(d.Arch) == "arm64"
+}
+
+// armSettings returns the settings an aarch64 VM needs which differ from the
+// given VM config. Proxmox VE has no emulated graphics for aarch64, so the
+// serial console is used instead.
+func (d *Driver) armSettings(config map[string]interface{}) [][2]string {
+	wanted := [][2]string{
+		{"arch", "aarch64"},
+		{"bios", "ovmf"},
+		{"machine", "virt"},
+		{"serial0", "socket"},
+		{"vga", "serial0"},
+	}
+	if d.ArchEmulate {
+		// a foreign architecture can't use hardware virtualization
+		wanted = append(wanted, [2]string{"kvm", "0"})
+	}
+
+	var settings [][2]string
+	for _, s := range wanted {
+		if fmt.Sprint(config[s[0]]) != s[1] {
+			settings = append(settings, s)
+		}
+	}
+	if _, ok := config["efidisk0"]; !ok {
+		settings = append(settings, [2]string{"efidisk0", d.efiDisk(config)})
+	}
+	return settings
+}
+
+// configureARM applies the settings of an aarch64 VM the clone is missing.
+// Changing arch requires root@pam, templates built for aarch64 already
+// carry it.
+func (d *Driver) configureARM() error {
+	config, err := d.getVMConfig(d.Node, d.VMID)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range d.armSettings(config) {
+		d.debugf("setting %s=%s for aarch64", s[0], s[1])
+		if err := d.ConfigureVM(s[0], s[1]); err != nil {
+			return fmt.Errorf("unable to set %s=%s for aarch64 on VM %d: %w", s[0], s[1], d.VMID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CloneSourceForArch(t *testing.T) {
+	var driver = createDriver()
+	driver.CloneArchMap = []string{"amd64=9000", "arm64=ubuntu-2404-arm64"}
+
+	driver.Arch = "x86_64"
+	source, err := driver.cloneSourceForArch()
+	assert.Nil(t, err)
+	assert.Equal(t, "9000", source)
+
+	driver.Arch = "aarch64"
+	source, err = driver.cloneSourceForArch()
+	assert.Nil(t, err)
+	assert.Equal(t, "ubuntu-2404-arm64", source)
+
+	driver.Arch = "riscv64"
+	_, err = driver.cloneSourceForArch()
+	assert.Error(t, err)
+
+	driver.CloneArchMap = []string{"amd64"}
+	_, err = driver.cloneSourceForArch()
+	assert.Error(t, err)
+}
+
+func Test_TemplateMatches(t *testing.T) {
+	assert.True(t, templateMatches("ubuntu-24.04", "ubuntu-24.04"))
+	assert.False(t, templateMatches("ubuntu-24.04-20250301", "ubuntu-24.04"))
+	assert.True(t, templateMatches("ubuntu-24.04-20250301", "ubuntu-24.04-*"))
+	assert.False(t, templateMatches("ubuntu-22.04-20250301", "ubuntu-24.04-*"))
+
+	templates := []clusterVM{
+		{VMID: 9001, Name: "ubuntu-24.04-20241015"},
+		{VMID: 9000, Name: "ubuntu-24.04-20250301"},
+		{VMID: 9002, Name: "ubuntu-24.04-20250301"},
+	}
+	assert.Equal(t, 9002, newestTemplate(templates).VMID)
+}
+
+func Test_ValidateCloneName(t *testing.T) {
+	var driver = createDriver()
+	driver.DiskSize = "16"
+	driver.Memory = 2048
+	driver.GuestSSHPort = 22
+	driver.CloneName = "ubuntu-24.04-*"
+	assert.Empty(t, driver.validateFlags())
+
+	driver.CloneName = "*"
+	driver.CloudImageURL = "https://example.com/noble.img"
+	assert.Equal(t, []string{
+		"proxmoxve-vm-clone-name must be a name or a prefix followed by *, got '*'",
+		"proxmoxve-vm-clone-name can't be combined with proxmoxve-vm-image-file or proxmoxve-vm-cloud-image-url",
+	}, driver.validateFlags())
+}
+
+func Test_ARMSettings(t *testing.T) {
+	var driver = createDriver()
+	driver.Storage = "local-lvm"
+	driver.Arch = "aarch64"
+	assert.True(t, driver.isARM())
+
+	// template already built for aarch64
+	assert.Empty(t, driver.armSettings(map[string]interface{}{
+		"arch": "aarch64", "bios": "ovmf", "machine": "virt", "serial0": "socket", "vga": "serial0", "efidisk0": "local-lvm:vm-9001-disk-0,efitype=4m",
+	}))
+
+	driver.ArchEmulate = true
+	assert.Equal(t, [][2]string{
+		{"arch", "aarch64"},
+		{"bios", "ovmf"},
+		{"machine", "virt"},
+		{"serial0", "socket"},
+		{"vga", "serial0"},
+		{"kvm", "0"},
+		{"efidisk0", "local-lvm:1,efitype=4m"},
+	}, driver.armSettings(map[string]interface{}{}))
+}
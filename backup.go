@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/luthermonson/go-proxmox"
+)
+
+// removeBackupTimeout is the time a backup before the removal of the VM may
+// take, longer than other tasks as the whole disk is read
+const removeBackupTimeout = time.Hour
+
+// backupParams returns the parameters of the vzdump of the VM to RemoveBackup.
+// The snapshot mode doesn't interrupt a running VM.
+func (d *Driver) backupParams() map[string]interface{} {
+	params := map[string]interface{}{
+		"vmid":     d.VMID,
+		"storage":  d.RemoveBackup,
+		"mode":     "snapshot",
+		"compress": "zstd",
+	}
+	if d.pveVersion.atLeast(7, 2) {
+		// notes of backups are new in Proxmox VE 7.2
+		params["notes-template"] = "docker-machine " + d.VMName
+	}
+	return params
+}
+
+// backupVM backs up the VM to RemoveBackup before it is removed and waits for
+// the backup to finish
+func (d *Driver) backupVM() error {
+	if err := d.connect(); err != nil {
+		return err
+	}
+
+	d.debugf("backing up VM %d to storage %s before removing it", d.VMID, d.RemoveBackup)
+	var upid proxmox.UPID
+	if err := d.client.Post(context.Background(), fmt.Sprintf("/nodes/%s/vzdump", d.Node), d.backupParams(), &upid); err != nil {
+		return fmt.Errorf("unable to back up VM %d to storage %s: %w", d.VMID, d.RemoveBackup, err)
+	}
+	if err := proxmox.NewTask(upid, d.client).Wait(context.Background(), d.taskInterval, removeBackupTimeout); err != nil {
+		return fmt.Errorf("unable to back up VM %d to storage %s, not removing it: %w", d.VMID, d.RemoveBackup, err)
+	}
+	return nil
+}
+
+// validateRemoveBackup checks that the storage for the backup before the
+// removal holds backups
+func (d *Driver) validateRemoveBackup() []string {
+	if len(d.RemoveBackup) == 0 {
+		return nil
+	}
+
+	status, err := d.getStorageStatus(d.Node, d.RemoveBackup)
+	if err != nil {
+		return []string{fmt.Sprintf("proxmoxve-remove-backup: storage '%s' not found on node '%s': %s", d.RemoveBackup, d.Node, err)}
+	}
+	if !status.supports("backup") {
+		return []string{fmt.Sprintf("proxmoxve-remove-backup: storage '%s' does not hold content type 'backup' (content: %s)", d.RemoveBackup, status.Content)}
+	}
+	return nil
+}
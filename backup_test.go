@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BackupParams(t *testing.T) {
+	var driver = createDriver()
+	driver.VMID = 105
+	driver.VMName = "worker-1"
+	driver.RemoveBackup = "pbs"
+	driver.pveVersion = pveVersion{7, 1}
+
+	assert.Equal(t, map[string]interface{}{
+		"vmid":     105,
+		"storage":  "pbs",
+		"mode":     "snapshot",
+		"compress": "zstd",
+	}, driver.backupParams())
+
+	driver.pveVersion = pveVersion{8, 2}
+	assert.Equal(t, "docker-machine worker-1", driver.backupParams()["notes-template"])
+}
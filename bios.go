@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/luthermonson/go-proxmox"
+)
+
+// machineTypePattern matches the x86 machine types, optionally pinned to a
+// QEMU version like pc-q35-8.1
+var machineTypePattern = regexp.MustCompile(`^(q35|i440fx|pc|pc-(i440fx|q35)-\d+\.\d+(\+pve\d+)?)$`)
+
+// machineType returns the machine option for MachineType, i440fx is called pc
+// by Proxmox VE
+func (d *Driver) machineType() string {
+	if d.MachineType == "i440fx" {
+		return "pc"
+	}
+	return d.MachineType
+}
+
+// validateMachineType checks the machine type and that PCIe passthrough gets q35
+func (d *Driver) validateMachineType() []string {
+	if len(d.MachineType) == 0 {
+		return nil
+	}
+	if !machineTypePattern.MatchString(d.MachineType) {
+		return []string{fmt.Sprintf("proxmoxve-vm-machine-type must be q35 or i440fx, got '%s'", d.MachineType)}
+	}
+	if d.isARM() {
+		return []string{"proxmoxve-vm-machine-type can't be set for arm64 VMs, they always use virt"}
+	}
+	if d.pcieRequested() && !strings.Contains(d.MachineType, "q35") {
+		return []string{fmt.Sprintf("proxmoxve-vm-machine-type: devices passed through with pcie=1 require q35, got '%s'", d.MachineType)}
+	}
+	return nil
+}
+
+// efiDisk returns the efidisk0 value for a VM with the given config, on
+// Storage or the storage of the boot disk if no storage is given
+func (d *Driver) efiDisk(config map[string]interface{}) string {
+	storage := d.Storage
+	if len(storage) == 0 {
+		storage = diskStorage(fmt.Sprint(config[bootDisk(config)]))
+	}
+	return storage + ":1,efitype=4m"
+}
+
+// biosOptions returns the machine type and firmware options of a VM created
+// from scratch. OVMF keeps its EFI variables on an efidisk, created on Storage.
+func (d *Driver) biosOptions() []proxmox.VirtualMachineOption {
+	var options []proxmox.VirtualMachineOption
+	if len(d.MachineType) > 0 {
+		options = append(options, proxmox.VirtualMachineOption{Name: "machine", Value: d.machineType()})
+	}
+	if len(d.BIOS) == 0 {
+		return options
+	}
+	options = append(options, proxmox.VirtualMachineOption{Name: "bios", Value: d.BIOS})
+	if d.BIOS == "ovmf" {
+		options = append(options, proxmox.VirtualMachineOption{Name: "efidisk0", Value: d.efiDisk(nil)})
+	}
+	return options
+}
+
+// configureBIOS switches the firmware of the clone, adding an efidisk for
+// OVMF if the template has none
+func (d *Driver) configureBIOS() error {
+	config, err := d.getVMConfig(d.Node, d.VMID)
+	if err != nil {
+		return err
+	}
+
+	if fmt.Sprint(config["bios"]) != d.BIOS {
+		if err := d.ConfigureVM("bios", d.BIOS); err != nil {
+			return err
+		}
+	}
+	if _, ok := config["efidisk0"]; d.BIOS == "ovmf" && !ok {
+		return d.ConfigureVM("efidisk0", d.efiDisk(config))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+)
+
+// bootstrapScript prepares generic cloud images for docker-machine: it sets
+// the hostname, installs and enables qemu-guest-agent so it survives reboots
+// and installs docker unless the image has it already
+const bootstrapScript = `set -e
+hostnamectl set-hostname {{hostname}} 2>/dev/null || hostname {{hostname}}
+
+install() {
+	if command -v apt-get >/dev/null; then
+		DEBIAN_FRONTEND=noninteractive apt-get update -q && DEBIAN_FRONTEND=noninteractive apt-get install -qy "$@"
+	elif command -v dnf >/dev/null; then
+		dnf install -qy "$@"
+	elif command -v yum >/dev/null; then
+		yum install -qy "$@"
+	elif command -v zypper >/dev/null; then
+		zypper --non-interactive install "$@"
+	elif command -v apk >/dev/null; then
+		apk add --no-cache "$@"
+	else
+		echo "no supported package manager to install $*" >&2
+		return 1
+	fi
+}
+
+if ! command -v qemu-ga >/dev/null; then
+	install qemu-guest-agent
+fi
+if command -v systemctl >/dev/null; then
+	systemctl enable qemu-guest-agent 2>/dev/null || true
+fi
+
+if ! command -v docker >/dev/null; then
+	command -v curl >/dev/null || install curl
+	curl -fsSL https://get.docker.com | sh
+fi
+`
+
+// bootstrapCommand returns the bootstrap script for the VM
+func (d *Driver) bootstrapCommand() string {
+	return strings.ReplaceAll(bootstrapScript, "{{hostname}}", d.VMName)
+}
+
+// runBootstrap runs the bootstrap script in the guest via the agent, for
+// templates which don't ship docker
+func (d *Driver) runBootstrap() error {
+	d.debugf("bootstrapping VM %d via the guest agent", d.VMID)
+	status, err := d.agentExec([]string{"/bin/sh"}, d.bootstrapCommand())
+	if err != nil {
+		return fmt.Errorf("unable to bootstrap VM %d: %w", d.VMID, err)
+	}
+	d.debugf("bootstrap exited with %d:\n%s%s", status.ExitCode, status.OutData, status.ErrData)
+	if status.ExitCode != 0 {
+		return fmt.Errorf("bootstrap of VM %d failed with exit code %d: %s", d.VMID, status.ExitCode, strings.TrimSpace(status.ErrData))
+	}
+	return nil
+}
+
+// waitForCloudInit waits via the agent until cloud-init finished, so the ssh
+// provisioning of docker-machine doesn't race its package installs
+func (d *Driver) waitForCloudInit() error {
+	d.debugf("waiting for cloud-init to finish in VM %d", d.VMID)
+	status, err := d.agentExec([]string{"/bin/sh", "-c", "cloud-init status --wait"}, "")
+	if err != nil {
+		return fmt.Errorf("unable to wait for cloud-init in VM %d: %w", d.VMID, err)
+	}
+	output := strings.TrimSpace(status.OutData + status.ErrData)
+	switch status.ExitCode {
+	case 0:
+		return nil
+	case 2:
+		// finished, with errors cloud-init recovered from
+		log.Warnf("cloud-init in VM %d finished with recoverable errors: %s", d.VMID, output)
+		return nil
+	case 127:
+		log.Warnf("cloud-init not found in VM %d, not waiting for it", d.VMID)
+		return nil
+	}
+	return fmt.Errorf("cloud-init failed in VM %d with exit code %d: %s", d.VMID, status.ExitCode, output)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_Bootstrap(t *testing.T) {
+	var driver = createDriver()
+	driver.VMName = "worker-1"
+	driver.CloudInitUserData = "packages:\n  - htop\n"
+	driver.Bootstrap = true
+	assert.True(t, driver.needsCloudInitSeed())
+
+	userData, err := driver.cloudInitUserData(nil, "")
+	assert.Nil(t, err)
+
+	var config map[string]interface{}
+	assert.Nil(t, yaml.Unmarshal([]byte(userData), &config))
+	assert.Equal(t, []interface{}{"htop", "qemu-guest-agent"}, config["packages"])
+	assert.Equal(t, []interface{}{"systemctl enable --now qemu-guest-agent"}, config["runcmd"])
+
+	assert.Contains(t, driver.bootstrapCommand(), "hostnamectl set-hostname worker-1 2>/dev/null || hostname worker-1\n")
+	assert.NotContains(t, driver.bootstrapCommand(), "{{hostname}}")
+}
+
+func Test_WaitForCloudInit(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stdout)
+
+	for _, c := range []struct {
+		exitCode int
+		warning  string
+		err      string
+	}{
+		{exitCode: 0},
+		// recoverable errors and a guest without cloud-init only warn
+		{exitCode: 2, warning: "cloud-init in VM 101 finished with recoverable errors: status: error"},
+		{exitCode: 127, warning: "cloud-init not found in VM 101, not waiting for it"},
+		{exitCode: 1, err: "cloud-init failed in VM 101 with exit code 1: status: error"},
+	} {
+		driver := createAPIDriver(t, func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api2/json/nodes/pve1/qemu/101/agent/exec":
+				w.Write([]byte(`{"data":{"pid":42}}`))
+			case "/api2/json/nodes/pve1/qemu/101/agent/exec-status":
+				fmt.Fprintf(w, `{"data":{"exited":1,"exitcode":%d,"out-data":"status: error"}}`, c.exitCode)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+
+		out.Reset()
+		err := driver.waitForCloudInit()
+		if len(c.err) == 0 {
+			assert.Nil(t, err, c.exitCode)
+		} else {
+			assert.EqualError(t, err, c.err)
+		}
+		if len(c.warning) == 0 {
+			assert.NotContains(t, out.String(), "WARN", c.exitCode)
+		} else {
+			assert.Contains(t, out.String(), c.warning)
+		}
+	}
+}
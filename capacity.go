@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// default overcommit ratios of the capacity check, the memory of the VM has
+// to fit into the free memory of the node, its vCPUs may share the cpus of
+// the node with the vCPUs of 3 other VMs
+const (
+	defaultMemoryOvercommit = "1"
+	defaultCPUOvercommit    = "4"
+)
+
+// overcommitRatio parses an overcommit ratio, 0 disables the check. Machines
+// created before the check have none, they get the default.
+func overcommitRatio(value, defaultValue string) (float64, error) {
+	if len(value) == 0 {
+		value = defaultValue
+	}
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil || ratio < 0 {
+		return 0, fmt.Errorf("must be a positive ratio like 1.5 or 0, got '%s'", value)
+	}
+	return ratio, nil
+}
+
+// vmCPUs returns the number of vCPUs the VM is created with, the template
+// may decide on sockets and cores not given
+func (d *Driver) vmCPUs() int {
+	if vcpus, err := strconv.Atoi(d.VCPUs); err == nil && vcpus > 0 {
+		return vcpus
+	}
+	cpus := 1
+	for _, value := range []string{d.CPUSockets, d.CPUCores} {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			cpus *= n
+		}
+	}
+	return cpus
+}
+
+// capacityShortage returns why the node can't host a VM with the given memory
+// in bytes and vCPUs, empty if it can. The memory has to fit into the memory
+// of the node not in use, scaled by memRatio, the vCPUs of the running VMs
+// on the node into its cpus scaled by cpuRatio. A ratio of 0 skips the check.
+func capacityShortage(n clusterNode, vms []clusterVM, memory uint64, cpus int, memRatio, cpuRatio float64) string {
+	if memRatio > 0 {
+		capacity := uint64(float64(n.MaxMem) * memRatio)
+		if n.Mem+memory > capacity {
+			free := uint64(0)
+			if capacity > n.Mem {
+				free = capacity - n.Mem
+			}
+			return fmt.Sprintf("the VM needs %s memory, %s is free", formatBytes(float64(memory)), formatBytes(float64(free)))
+		}
+	}
+
+	if cpus > n.MaxCPU {
+		return fmt.Sprintf("the VM has %d vCPUs, the node only %d cpus", cpus, n.MaxCPU)
+	}
+	if cpuRatio > 0 {
+		allocated := 0
+		for _, vm := range vms {
+			if vm.Node == n.Node && vm.Status == "running" {
+				allocated += vm.MaxCPU
+			}
+		}
+		capacity := int(float64(n.MaxCPU) * cpuRatio)
+		if allocated+cpus > capacity {
+			return fmt.Sprintf("the VM has %d vCPUs, %d of %d are allocated to running VMs", cpus, allocated, capacity)
+		}
+	}
+	return ""
+}
+
+// nodeShortage returns why the node can't host the VM, empty if it can. A
+// minimal clone keeps memory and cpus of its template.
+func (d *Driver) nodeShortage(n clusterNode, vms []clusterVM) string {
+	// already validated by validateFlags
+	memRatio, _ := overcommitRatio(d.MemoryOvercommit, defaultMemoryOvercommit)
+	cpuRatio, _ := overcommitRatio(d.CPUOvercommit, defaultCPUOvercommit)
+
+	memory, cpus := uint64(d.Memory)*1024*1024, d.vmCPUs()
+	if d.CloneMinimal {
+		template, ok := findVM(vms, d.CloneVMID)
+		if !ok {
+			d.debugf("template '%s' not found, not checking the capacity for the minimal clone", d.CloneVMID)
+			return ""
+		}
+		memory, cpus = template.MaxMem, template.MaxCPU
+	}
+	return capacityShortage(n, vms, memory, cpus, memRatio, cpuRatio)
+}
+
+// findVM returns the VM with the given VMID
+func findVM(vms []clusterVM, vmid string) (clusterVM, bool) {
+	for _, vm := range vms {
+		if strconv.Itoa(vm.VMID) == vmid {
+			return vm, true
+		}
+	}
+	return clusterVM{}, false
+}
+
+// checkCapacity fails if the node of the VM can't host it, so the VM isn't
+// started on a node it would run out of memory on
+func (d *Driver) checkCapacity() error {
+	nodes, err := d.getClusterNodes()
+	if err != nil {
+		return err
+	}
+	vms, err := d.getClusterVMs()
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if n.Node != d.Node {
+			continue
+		}
+		if shortage := d.nodeShortage(n, vms); len(shortage) > 0 {
+			return fmt.Errorf("insufficient capacity on node %s: %s", d.Node, shortage)
+		}
+		return nil
+	}
+	return fmt.Errorf("node %s not found in the cluster", d.Node)
+}
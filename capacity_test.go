@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CapacityShortage(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+	node := clusterNode{Node: "pve1", Status: "online", MaxCPU: 8, Mem: 56 * gb, MaxMem: 64 * gb}
+	vms := []clusterVM{
+		{VMID: 101, Node: "pve1", Status: "running", MaxCPU: 16},
+		{VMID: 102, Node: "pve1", Status: "stopped", MaxCPU: 16},
+		{VMID: 103, Node: "pve2", Status: "running", MaxCPU: 16},
+	}
+
+	assert.Empty(t, capacityShortage(node, vms, 8*gb, 4, 1, 4))
+	assert.Equal(t, "the VM needs 16.0 GiB memory, 8.0 GiB is free", capacityShortage(node, vms, 16*gb, 4, 1, 4))
+	assert.Empty(t, capacityShortage(node, vms, 16*gb, 4, 1.5, 4))
+	assert.Empty(t, capacityShortage(node, vms, 128*gb, 4, 0, 4))
+
+	assert.Equal(t, "the VM has 4 vCPUs, 16 of 16 are allocated to running VMs", capacityShortage(node, vms, gb, 4, 1, 2))
+	assert.Equal(t, "the VM has 12 vCPUs, the node only 8 cpus", capacityShortage(node, vms, gb, 12, 1, 0))
+	assert.Empty(t, capacityShortage(node, vms, gb, 8, 1, 0))
+}
+
+func Test_NodeShortageMinimalClone(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+	node := clusterNode{Node: "pve1", Status: "online", MaxCPU: 8, Mem: 56 * gb, MaxMem: 64 * gb}
+	vms := []clusterVM{
+		{VMID: 9000, Node: "pve1", Template: 1, MaxCPU: 2, MaxMem: 16 * gb},
+	}
+
+	var driver = createDriver()
+	driver.Memory = 4 * 1024
+	driver.CloneVMID = "9000"
+	assert.Empty(t, driver.nodeShortage(node, vms))
+
+	// the clone gets the memory of the template, not of the flags
+	driver.CloneMinimal = true
+	assert.Equal(t, "the VM needs 16.0 GiB memory, 8.0 GiB is free", driver.nodeShortage(node, vms))
+
+	driver.CloneVMID = "9001"
+	assert.Empty(t, driver.nodeShortage(node, vms))
+}
+
+func Test_OvercommitRatio(t *testing.T) {
+	ratio, err := overcommitRatio("", defaultCPUOvercommit)
+	assert.Nil(t, err)
+	assert.Equal(t, 4.0, ratio)
+	ratio, err = overcommitRatio("1.5", defaultMemoryOvercommit)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, ratio)
+	_, err = overcommitRatio("-1", defaultMemoryOvercommit)
+	assert.Error(t, err)
+
+	var driver = createDriver()
+	driver.CPUSockets = "2"
+	driver.CPUCores = "4"
+	assert.Equal(t, 8, driver.vmCPUs())
+	driver.VCPUs = "6"
+	assert.Equal(t, 6, driver.vmCPUs())
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// The driver binary is started by docker-machine/rancher-machine as a plugin.
+// Started with a command instead, it works on the config.json of an existing
+// machine, e.g.
+//
+//	docker-machine-driver-proxmoxve usage ~/.docker/machine/machines/worker-1
+
+const cliUsage = `usage: docker-machine-driver-proxmoxve <command> [options] <machine dir or config.json>
+
+commands:
+  console  print the noVNC console URL of the machine, or write a SPICE remote-viewer file
+  migrate  move the machine to another node of the cluster, online if it is running
+  snapshot list, create, delete or roll back to snapshots of the machine
+  usage    show the CPU, memory, disk and network usage of the machine
+  watch    print state changes, migrations and tasks of the machine until interrupted
+`
+
+// runCommand runs a command given on the command line and returns the exit code
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	var err error
+	switch args[0] {
+	case "console":
+		err = consoleCommand(args[1:], stdout)
+	case "migrate":
+		err = migrateCommand(args[1:], stdout)
+	case "snapshot":
+		err = snapshotCommand(args[1:], stdout)
+	case "usage":
+		err = usageCommand(args[1:], stdout)
+	case "watch":
+		err = watchCommand(args[1:], stdout)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, cliUsage)
+		return 0
+	default:
+		err = fmt.Errorf("unknown command '%s'\n\n%s", args[0], cliUsage)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// machineConfigPath returns the path of the config.json of a machine, given
+// the machine dir or the file itself
+func machineConfigPath(path string) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, "config.json")
+	}
+	return path
+}
+
+// loadMachine reads the driver of a machine from its config.json
+func loadMachine(path string) (*Driver, error) {
+	path = machineConfigPath(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read machine config: %w", err)
+	}
+
+	d := NewDriver("", "").(*Driver)
+	host := struct {
+		DriverName string
+		Driver     *Driver
+	}{Driver: d}
+	if err := json.Unmarshal(data, &host); err != nil {
+		return nil, fmt.Errorf("unable to parse machine config %s: %w", path, err)
+	}
+	if host.DriverName != "" && host.DriverName != d.DriverName() {
+		return nil, fmt.Errorf("machine %s uses the %s driver", path, host.DriverName)
+	}
+	return d, nil
+}
+
+// saveMachine writes the driver back to the config.json of the machine,
+// keeping all other settings of the host as they are
+func saveMachine(path string, d *Driver) error {
+	path = machineConfigPath(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read machine config: %w", err)
+	}
+	var host map[string]json.RawMessage
+	if err := json.Unmarshal(data, &host); err != nil {
+		return fmt.Errorf("unable to parse machine config %s: %w", path, err)
+	}
+	if host["Driver"], err = json.Marshal(d); err != nil {
+		return err
+	}
+	if data, err = json.MarshalIndent(host, "", "    "); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func consoleCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("console", flag.ContinueOnError)
+	spice := fs.String("spice", "", "write a remote-viewer file with a SPICE ticket to the file instead")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: docker-machine-driver-proxmoxve console [-spice <file.vv>] <machine dir or config.json>")
+	}
+
+	d, err := loadMachine(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(*spice) == 0 {
+		fmt.Fprintln(stdout, d.consoleURL())
+		return nil
+	}
+	config, err := d.SpiceConsole()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*spice, []byte(config), 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "open %s with remote-viewer within 30 seconds\n", *spice)
+	return nil
+}
+
+func migrateCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	node := fs.String("node", "", "node to move the machine to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || len(*node) == 0 {
+		return fmt.Errorf("usage: docker-machine-driver-proxmoxve migrate -node <node> <machine dir or config.json>")
+	}
+
+	d, err := loadMachine(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := d.Migrate(*node); err != nil {
+		return err
+	}
+	// the machine is only found on its new node from now on
+	if err := saveMachine(fs.Arg(0), d); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "VM %d (%s) is on node %s\n", d.VMID, d.VMName, d.Node)
+	return nil
+}
+
+const snapshotUsage = `usage: docker-machine-driver-proxmoxve snapshot list <machine dir or config.json>
+       docker-machine-driver-proxmoxve snapshot create [-description text] <name> <machine dir or config.json>
+       docker-machine-driver-proxmoxve snapshot delete <name> <machine dir or config.json>
+       docker-machine-driver-proxmoxve snapshot rollback <name> <machine dir or config.json>`
+
+func snapshotCommand(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf(snapshotUsage)
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	description := fs.String("description", "", "description of the snapshot to create")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if (action == "list" && fs.NArg() != 1) || (action != "list" && fs.NArg() != 2) {
+		return fmt.Errorf(snapshotUsage)
+	}
+
+	d, err := loadMachine(fs.Arg(fs.NArg() - 1))
+	if err != nil {
+		return err
+	}
+	name := fs.Arg(0)
+	switch action {
+	case "list":
+		snapshots, err := d.ListSnapshots()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tCREATED\tDESCRIPTION")
+		for _, s := range snapshots {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Name, time.Unix(s.SnapTime, 0).Format(time.RFC3339), s.Description)
+		}
+		return tw.Flush()
+	case "create":
+		return d.CreateSnapshot(name, *description)
+	case "delete":
+		return d.DeleteSnapshot(name)
+	case "rollback":
+		return d.RollbackSnapshot(name)
+	}
+	return fmt.Errorf("unknown snapshot action '%s'\n\n%s", action, snapshotUsage)
+}
+
+func usageCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("usage", flag.ContinueOnError)
+	timeframe := fs.String("timeframe", "hour", "timeframe of the statistics: hour, day, week, month or year")
+	asJSON := fs.Bool("json", false, "print all samples as json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: docker-machine-driver-proxmoxve usage [-timeframe hour] [-json] <machine dir or config.json>")
+	}
+
+	d, err := loadMachine(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	samples, err := d.GetUsage(*timeframe)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(samples)
+	}
+	printUsage(stdout, d, *timeframe, summarizeUsage(samples))
+	return nil
+}
+
+func watchCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	interval := fs.Duration("interval", 10*time.Second, "poll interval")
+	asJSON := fs.Bool("json", false, "print events as json lines")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: docker-machine-driver-proxmoxve watch [-interval 10s] [-json] <machine dir or config.json>")
+	}
+
+	d, err := loadMachine(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	enc := json.NewEncoder(stdout)
+	return d.Watch(ctx, *interval, func(e WatchEvent) {
+		if *asJSON {
+			enc.Encode(e)
+		} else {
+			fmt.Fprintln(stdout, e)
+		}
+	})
+}
+
+// printUsage prints the summary as table
+func printUsage(w io.Writer, d *Driver, timeframe string, s UsageSummary) {
+	fmt.Fprintf(w, "VM %d (%s) on %s, last %s", d.VMID, d.VMName, d.Node, timeframe)
+	if s.Samples == 0 {
+		fmt.Fprintln(w, ": no data")
+		return
+	}
+	fmt.Fprintf(w, ", %d samples until %s\n\n", s.Samples, time.Unix(s.Average.Time, 0).Format(time.RFC3339))
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tAVERAGE\tPEAK\tCAPACITY")
+	fmt.Fprintf(tw, "cpu\t%.1f%%\t%.1f%%\t%.0f cores\n", s.Average.CPU*100, s.Peak.CPU*100, s.Average.MaxCPU)
+	fmt.Fprintf(tw, "memory\t%s\t%s\t%s\n", formatBytes(s.Average.Mem), formatBytes(s.Peak.Mem), formatBytes(s.Average.MaxMem))
+	fmt.Fprintf(tw, "disk read\t%s/s\t%s/s\t%s\n", formatBytes(s.Average.DiskRead), formatBytes(s.Peak.DiskRead), formatBytes(s.Average.MaxDisk))
+	fmt.Fprintf(tw, "disk write\t%s/s\t%s/s\t\n", formatBytes(s.Average.DiskWrite), formatBytes(s.Peak.DiskWrite))
+	fmt.Fprintf(tw, "net in\t%s/s\t%s/s\t\n", formatBytes(s.Average.NetIn), formatBytes(s.Peak.NetIn))
+	fmt.Fprintf(tw, "net out\t%s/s\t%s/s\t\n", formatBytes(s.Average.NetOut), formatBytes(s.Peak.NetOut))
+	tw.Flush()
+}
+
+// formatBytes formats a number of bytes with a binary unit, e.g. 1.5 GiB
+func formatBytes(b float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for b >= 1024 && i < len(units)-1 {
+		b /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", b, units[i])
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// snapshotNamePattern matches the names Proxmox VE accepts for snapshots
+var snapshotNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{1,39}$`)
+
+// templateStorages returns the storages of the disks of a VM config
+func templateStorages(config map[string]interface{}) []string {
+	var storages []string
+	for _, key := range sortedKeys(config) {
+		value := fmt.Sprint(config[key])
+		if !isDisk(key) || isCdrom(value) {
+			continue
+		}
+		if storage := diskStorage(value); len(storage) > 0 {
+			storages = append(storages, storage)
+		}
+	}
+	return storages
+}
+
+// isTemplate returns true if the VM config belongs to a template
+func isTemplate(config map[string]interface{}) bool {
+	return fmt.Sprint(config["template"]) == "1"
+}
+
+// cloneFull decides between a full and a linked clone of the source with the
+// given config. auto uses a linked clone for templates on shared storage
+// only, as linked clones of local templates can't be placed on other nodes.
+func (d *Driver) cloneFull(config map[string]interface{}) (int, error) {
+	switch d.CloneFullMode {
+	case "", "1":
+		return 1, nil
+	case "0":
+		return 0, nil
+	}
+
+	if !isTemplate(config) {
+		return 1, nil
+	}
+	shared, err := d.sharedSource(config)
+	if err != nil {
+		return 0, err
+	}
+	if !shared {
+		d.debugf("template disks on local storage, using a full clone")
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// sharedSource returns true if all disks of the clone source are on shared
+// storage. The clone API creates clones on other nodes of those only.
+func (d *Driver) sharedSource(config map[string]interface{}) (bool, error) {
+	for _, storage := range templateStorages(config) {
+		status, err := d.getStorageStatus(d.cloneSourceNode(), storage)
+		if err != nil {
+			return false, err
+		}
+		if status.Shared != 1 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// validateCloneFull checks that a linked clone is requested for templates only
+func validateCloneFull(mode string, config map[string]interface{}) []string {
+	if mode == "0" && !isTemplate(config) {
+		return []string{"proxmoxve-vm-clone-full: linked clones (0) require the clone source to be a template"}
+	}
+	return nil
+}
+
+// validSnapshotName returns true for names Proxmox VE accepts for snapshots.
+// current is the name it uses for the current state of the VM.
+func validSnapshotName(name string) bool {
+	return snapshotNamePattern.MatchString(name) && name != "current"
+}
+
+// validateCloneSnapshot checks the name of the snapshot to clone from
+func validateCloneSnapshot(name string) []string {
+	if len(name) > 0 && !validSnapshotName(name) {
+		return []string{fmt.Sprintf("proxmoxve-vm-clone-snapshot must be a snapshot name like golden-2024, got '%s'", name)}
+	}
+	return nil
+}
+
+// cloneSourceConfig returns the config of the clone source, as of the
+// snapshot if CloneSnapshot is given
+func (d *Driver) cloneSourceConfig(vmid int) (map[string]interface{}, error) {
+	if len(d.CloneSnapshot) == 0 {
+		return d.getVMConfig(d.cloneSourceNode(), vmid)
+	}
+	if err := d.connect(); err != nil {
+		return nil, err
+	}
+
+	var config map[string]interface{}
+	path := fmt.Sprintf("/nodes/%s/qemu/%d/snapshot/%s/config", d.cloneSourceNode(), vmid, d.CloneSnapshot)
+	if err := d.client.Get(context.Background(), path, &config); err != nil {
+		return nil, fmt.Errorf("snapshot '%s' of VM %d not found: %w", d.CloneSnapshot, vmid, err)
+	}
+	return config, nil
+}
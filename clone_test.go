@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CloneFull(t *testing.T) {
+	template := map[string]interface{}{
+		"template": 1,
+		"ide2":     "ceph:vm-9000-cloudinit,media=cdrom",
+		"scsi0":    "ceph:base-9000-disk-0,size=8G",
+	}
+	vm := map[string]interface{}{
+		"scsi0": "local-lvm:vm-100-disk-0,size=8G",
+	}
+
+	assert.Equal(t, []string{"ceph"}, templateStorages(template))
+	assert.Empty(t, validateCloneFull("0", template))
+	assert.Len(t, validateCloneFull("0", vm), 1)
+	assert.Empty(t, validateCloneFull("auto", vm))
+
+	var driver = createDriver()
+	for mode, expected := range map[string]int{"": 1, "1": 1, "0": 0} {
+		driver.CloneFullMode = mode
+		full, err := driver.cloneFull(template)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, full)
+	}
+
+	// auto never links a VM which is not a template
+	driver.CloneFullMode = "auto"
+	full, err := driver.cloneFull(vm)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, full)
+}
+
+func Test_CloneBWLimit(t *testing.T) {
+	var driver = createDriver()
+	driver.DiskSize = "16"
+	driver.Memory = 2048
+	driver.GuestSSHPort = 22
+	driver.CloneVMID = "9000"
+
+	driver.CloneBWLimit = 51200
+	assert.Empty(t, driver.validateFlags())
+
+	driver.CloneBWLimit = -1
+	assert.Equal(t, []string{"proxmoxve-vm-clone-bwlimit must not be negative, got '-1'"}, driver.validateFlags())
+}
+
+func Test_ValidateCloneSnapshot(t *testing.T) {
+	assert.Empty(t, validateCloneSnapshot(""))
+	assert.Empty(t, validateCloneSnapshot("golden_2024-10"))
+	assert.Len(t, validateCloneSnapshot("current"), 1)
+	assert.Len(t, validateCloneSnapshot("2024-10"), 1)
+	assert.Len(t, validateCloneSnapshot("golden 2024"), 1)
+}
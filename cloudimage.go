@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/luthermonson/go-proxmox"
+)
+
+// cloudImageFormats are the disk formats the import content type accepts
+var cloudImageFormats = []string{".qcow2", ".raw", ".vmdk"}
+
+// cloudImageFilename returns the name the cloud image is stored as on
+// CloudImageStorage. Cloud images published as .img (e.g. Ubuntu) are qcow2.
+func (d *Driver) cloudImageFilename() (string, error) {
+	u, err := url.Parse(d.CloudImageURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("'%s' is not a http(s) url", d.CloudImageURL)
+	}
+
+	name := path.Base(u.Path)
+	if strings.HasSuffix(name, ".img") {
+		name = strings.TrimSuffix(name, ".img") + ".qcow2"
+	}
+	for _, ext := range cloudImageFormats {
+		if strings.HasSuffix(name, ext) && len(name) > len(ext) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("'%s' has to end with .img, %s", d.CloudImageURL, strings.Join(cloudImageFormats, ", "))
+}
+
+// cloudImageVolume returns the volume id of the downloaded cloud image
+func (d *Driver) cloudImageVolume() (string, error) {
+	name, err := d.cloudImageFilename()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:import/%s", d.CloudImageStorage, name), nil
+}
+
+// checksumLengths are the hex digits of the checksum algorithms the
+// download-url API verifies
+var checksumLengths = map[string]int{"md5": 32, "sha1": 40, "sha224": 56, "sha256": 64, "sha384": 96, "sha512": 128}
+
+// validateCloudImageChecksum checks the checksum is given as <algorithm>:<hex>,
+// a checksum which can't be passed on would leave the image unverified
+func validateCloudImageChecksum(checksum string) []string {
+	if len(checksum) == 0 {
+		return nil
+	}
+	algorithm, sum, _ := strings.Cut(checksum, ":")
+	length, ok := checksumLengths[strings.ToLower(algorithm)]
+	if !ok {
+		return []string{fmt.Sprintf("proxmoxve-vm-cloud-image-checksum must be <algorithm>:<checksum> with algorithm md5, sha1, sha224, sha256, sha384 or sha512, got '%s'", checksum)}
+	}
+	if _, err := hex.DecodeString(sum); err != nil || len(sum) != length {
+		return []string{fmt.Sprintf("proxmoxve-vm-cloud-image-checksum must be %d hex digits for %s, got '%s'", length, algorithm, sum)}
+	}
+	return nil
+}
+
+// validateCloudImage checks the url and that CloudImageStorage accepts imports
+func (d *Driver) validateCloudImage() []string {
+	if _, err := d.cloudImageFilename(); err != nil {
+		return []string{"proxmoxve-vm-cloud-image-url: " + err.Error()}
+	}
+
+	status, err := d.getStorageStatus(d.Node, d.CloudImageStorage)
+	if err != nil {
+		return []string{fmt.Sprintf("proxmoxve-vm-cloud-image-storage: storage '%s' not found on node '%s': %s", d.CloudImageStorage, d.Node, err)}
+	}
+	if !status.supports("import") {
+		return []string{fmt.Sprintf("proxmoxve-vm-cloud-image-storage: storage '%s' does not hold content type 'import' (content: %s)", d.CloudImageStorage, status.Content)}
+	}
+	return nil
+}
+
+// downloadCloudImage downloads CloudImageURL to CloudImageStorage on the node,
+// unless an earlier machine already did
+func (d *Driver) downloadCloudImage() (string, error) {
+	volid, err := d.cloudImageVolume()
+	if err != nil {
+		return "", err
+	}
+
+	volumes, err := d.getStorageContent(d.Node, d.CloudImageStorage, "import")
+	if err != nil {
+		return "", err
+	}
+	for _, v := range volumes {
+		if v.Volid == volid {
+			d.debugf("cloud image %s already downloaded", volid)
+			return volid, nil
+		}
+	}
+
+	_, name, _ := strings.Cut(volid, "/")
+	params := map[string]interface{}{
+		"url":      d.CloudImageURL,
+		"content":  "import",
+		"filename": name,
+	}
+	if len(d.CloudImageChecksum) > 0 {
+		algorithm, checksum, _ := strings.Cut(d.CloudImageChecksum, ":")
+		params["checksum-algorithm"] = strings.ToLower(algorithm)
+		params["checksum"] = checksum
+	}
+
+	d.debugf("downloading cloud image %s to %s", d.CloudImageURL, volid)
+	var upid proxmox.UPID
+	endpoint := fmt.Sprintf("/nodes/%s/storage/%s/download-url", d.Node, url.PathEscape(d.CloudImageStorage))
+	if err := d.client.Post(context.Background(), endpoint, params, &upid); err != nil {
+		return "", fmt.Errorf("unable to download %s: %w", d.CloudImageURL, err)
+	}
+	task := proxmox.NewTask(upid, d.client)
+	if err := task.Wait(context.Background(), d.taskInterval, d.taskTimeout); err != nil {
+		return "", fmt.Errorf("unable to download %s: %w", d.CloudImageURL, err)
+	}
+	return volid, nil
+}
+
+// cloudImageOptions returns the options of a VM created from scratch with the
+// disk imported from the downloaded cloud image
+func (d *Driver) cloudImageOptions(volid string) []proxmox.VirtualMachineOption {
+	disk := fmt.Sprintf("%s:0,import-from=%s", d.Storage, volid)
+	if len(d.StorageType) > 0 {
+		disk += ",format=" + d.StorageType
+	}
+	disk = setDiskOptions(disk, d.bootDiskOptions())
+	net := d.generateNetString()
+	if len(d.NetBridge) == 0 {
+		net = fmt.Sprintf("model=%s,bridge=%s", d.NetModel, defaultBridge)
+	}
+
+	options := []proxmox.VirtualMachineOption{
+		{Name: "name", Value: d.VMName},
+		{Name: "ostype", Value: "l26"},
+		{Name: "memory", Value: d.Memory},
+		{Name: "scsihw", Value: d.scsiController()},
+		{Name: "scsi0", Value: disk},
+		{Name: "boot", Value: "order=scsi0"},
+		{Name: "net0", Value: net},
+		// cloud images expect a serial console
+		{Name: "serial0", Value: "socket"},
+	}
+	options = append(options, d.biosOptions()...)
+	if len(d.Pool) > 0 {
+		options = append(options, proxmox.VirtualMachineOption{Name: "pool", Value: d.Pool})
+	}
+	return options
+}
+
+// createFromCloudImage creates a new VM with the disk imported from
+// CloudImageURL, grown to DiskSize, and a cloud-init drive for the ssh key
+func (d *Driver) createFromCloudImage(newId int) error {
+	volid, err := d.downloadCloudImage()
+	if err != nil {
+		return err
+	}
+
+	node, err := d.client.Node(context.Background(), d.Node)
+	if err != nil {
+		return err
+	}
+
+	d.debugf("creating new vm %d from cloud image '%s'", newId, volid)
+	task, err := node.NewVirtualMachine(context.Background(), newId, d.cloudImageOptions(volid)...)
+	if err != nil {
+		return err
+	}
+	// from here on a failed creation leaves a VM to clean up
+	d.VMID = newId
+
+	if err := task.Wait(context.Background(), d.taskInterval, d.taskTimeout); err != nil {
+		return err
+	}
+	d.debugf("vm %d created", newId)
+
+	vm, err := d.GetVM()
+	if err != nil {
+		return err
+	}
+	config, err := d.getVMConfig(d.Node, d.VMID)
+	if err != nil {
+		return err
+	}
+	size, err := strconv.Atoi(d.DiskSize)
+	if err != nil {
+		return err
+	}
+	if err := d.growDisk(vm, config, "scsi0", size); err != nil {
+		return err
+	}
+
+	return d.ensureCloudInitDrive()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/luthermonson/go-proxmox"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CloudImageVolume(t *testing.T) {
+	var driver = createDriver()
+	driver.CloudImageStorage = "local"
+
+	driver.CloudImageURL = "https://cloud-images.ubuntu.com/noble/current/noble-server-cloudimg-amd64.img"
+	volid, err := driver.cloudImageVolume()
+	assert.Nil(t, err)
+	assert.Equal(t, "local:import/noble-server-cloudimg-amd64.qcow2", volid)
+
+	driver.CloudImageURL = "https://example.com/debian-12-generic-amd64.qcow2?download=1"
+	volid, err = driver.cloudImageVolume()
+	assert.Nil(t, err)
+	assert.Equal(t, "local:import/debian-12-generic-amd64.qcow2", volid)
+
+	for _, u := range []string{"https://example.com/image.iso", "ftp://example.com/image.qcow2", "https://example.com/"} {
+		driver.CloudImageURL = u
+		_, err = driver.cloudImageVolume()
+		assert.NotNil(t, err, u)
+	}
+}
+
+func Test_CloudImageOptions(t *testing.T) {
+	var driver = createDriver()
+	driver.VMName = "worker-1"
+	driver.Memory = 2 * 1024
+	driver.Storage = "local-lvm"
+	driver.ScsiController = "virtio-scsi-single"
+	driver.NetModel = "virtio"
+
+	assert.Equal(t, []proxmox.VirtualMachineOption{
+		{Name: "name", Value: "worker-1"},
+		{Name: "ostype", Value: "l26"},
+		{Name: "memory", Value: 2048},
+		{Name: "scsihw", Value: "virtio-scsi-single"},
+		{Name: "scsi0", Value: "local-lvm:0,import-from=local:import/noble.qcow2"},
+		{Name: "boot", Value: "order=scsi0"},
+		{Name: "net0", Value: "model=virtio,bridge=vmbr0"},
+		{Name: "serial0", Value: "socket"},
+	}, driver.cloudImageOptions("local:import/noble.qcow2"))
+}
+
+func Test_ValidateCloudImageChecksum(t *testing.T) {
+	assert.Empty(t, validateCloudImageChecksum(""))
+	assert.Empty(t, validateCloudImageChecksum("sha256:"+strings.Repeat("a1", 32)))
+	assert.Empty(t, validateCloudImageChecksum("SHA512:"+strings.Repeat("0F", 64)))
+	for _, v := range []string{strings.Repeat("a1", 32), "sha256", "sha256:abc", "sha256:" + strings.Repeat("zz", 32), "crc32:deadbeef"} {
+		assert.Len(t, validateCloudImageChecksum(v), 1, v)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luthermonson/go-proxmox"
+	"gopkg.in/yaml.v3"
+)
+
+// Proxmox VE generates the cloud-init user-data itself and only exposes a few
+// settings (user, ssh keys, ip config). Settings beyond that are delivered by
+// a NoCloud seed the driver renders and attaches instead of the generated
+// cloud-init drive. The seed therefore carries the ssh keys and the user too.
+// Custom user-data is merged into the seed as well: cicustom would need it on
+// a snippets storage, but the API doesn't accept snippet uploads.
+
+// citypes are the cloud-init formats of Proxmox VE
+var citypes = []string{"nocloud", "configdrive2", "opennebula"}
+
+// citypeOption returns the citype option of the new VM, nil if it keeps the
+// citype its template defines
+func (d *Driver) citypeOption(config map[string]interface{}) *proxmox.VirtualMachineOption {
+	if citype, ok := config["citype"].(string); ok && len(citype) > 0 {
+		d.debugf("keeping citype %s of the template", citype)
+		return nil
+	}
+	return &proxmox.VirtualMachineOption{Name: "citype", Value: d.Citype}
+}
+
+// needsCloudInitSeed returns true if any option requires a driver rendered seed
+func (d *Driver) needsCloudInitSeed() bool {
+	return len(d.Timezone) > 0 || d.customSSHPort() || d.guestMTU() > 0 || len(d.CloudInitUserData) > 0 ||
+		len(d.CloudInitNetworkConfig) > 0 || d.Bootstrap
+}
+
+// inlineOrFile returns a value given inline, spanning several lines, or as the
+// path of a local file
+func inlineOrFile(value string) ([]byte, error) {
+	if strings.Contains(value, "\n") {
+		return []byte(value), nil
+	}
+	return os.ReadFile(value)
+}
+
+// customUserData returns the --proxmoxve-vm-cloud-init-user-data cloud-config,
+// given inline or as the path of a local file
+func (d *Driver) customUserData() (map[string]interface{}, error) {
+	data, err := inlineOrFile(d.CloudInitUserData)
+	if err != nil {
+		return nil, err
+	}
+
+	config := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("not a cloud-config mapping: %w", err)
+	}
+	return config, nil
+}
+
+// guestMTU returns the MTU the guest interface has to be configured with, 0
+// if not set. mtu=1 makes Proxmox VE use the bridge MTU, which the driver
+// doesn't know.
+func (d *Driver) guestMTU() int {
+	mtu, err := strconv.Atoi(d.NetMtu)
+	if err != nil || mtu <= 1 {
+		return 0
+	}
+	return mtu
+}
+
+// customSSHPort returns true if the guest sshd has to listen on a port other than 22
+func (d *Driver) customSSHPort() bool {
+	return d.GuestSSHPort > 0 && d.GuestSSHPort != 22
+}
+
+// cloudInitUserData renders the #cloud-config user-data of the seed. Custom
+// user-data is the base, the driver only adds its ssh keys and commands to
+// the lists and overrides the hostname, user and timezone.
+func (d *Driver) cloudInitUserData(sshKeys []string, ciUser string) (string, error) {
+	config := map[string]interface{}{}
+	if len(d.CloudInitUserData) > 0 {
+		custom, err := d.customUserData()
+		if err != nil {
+			return "", err
+		}
+		config = custom
+	}
+	config["hostname"] = d.VMName
+	config["manage_etc_hosts"] = true
+
+	if len(ciUser) > 0 {
+		config["user"] = ciUser
+	}
+	if len(d.CIPassword) > 0 {
+		// the seed stays on the ISO storage of the node until the VM is
+		// removed, it never holds the password in plain text. A user mapping
+		// without name amends the default user of the distribution.
+		password, err := resolveSecret(d.CIPassword)
+		if err != nil {
+			return "", err
+		}
+		hash, err := hashPassword(password)
+		if err != nil {
+			return "", err
+		}
+		user := map[string]interface{}{"hashed_passwd": hash, "lock_passwd": false}
+		if len(ciUser) > 0 {
+			user["name"] = ciUser
+		}
+		config["user"] = user
+	}
+	if len(sshKeys) > 0 {
+		keys, _ := config["ssh_authorized_keys"].([]interface{})
+		for _, key := range sshKeys {
+			keys = append(keys, key)
+		}
+		config["ssh_authorized_keys"] = keys
+	}
+	if len(d.Timezone) > 0 {
+		config["timezone"] = d.Timezone
+	}
+	if d.customSSHPort() {
+		// the port has to be open before the custom commands run, as they
+		// may take longer than docker-machine waits for ssh
+		var commands []interface{}
+		for _, c := range sshdPortCommands(d.GuestSSHPort) {
+			commands = append(commands, c)
+		}
+		custom, _ := config["runcmd"].([]interface{})
+		config["runcmd"] = append(commands, custom...)
+	}
+	if d.Bootstrap {
+		// the agent runs the rest of the bootstrap
+		packages, _ := config["packages"].([]interface{})
+		config["packages"] = append(packages, "qemu-guest-agent")
+		commands, _ := config["runcmd"].([]interface{})
+		config["runcmd"] = append(commands, "systemctl enable --now qemu-guest-agent")
+	}
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return "#cloud-config\n" + string(data), nil
+}
+
+// applyCIUser sets the cloud-init user and password of the VM. Without
+// CIUser the user of the template is kept, and is the ssh user unless
+// GuestUsername is given.
+func (d *Driver) applyCIUser() error {
+	password, err := resolveSecret(d.CIPassword)
+	if err != nil {
+		return err
+	}
+	if err := d.configureVMOptions(
+		proxmox.VirtualMachineOption{Name: "ciuser", Value: d.CIUser},
+		proxmox.VirtualMachineOption{Name: "cipassword", Value: password},
+	); err != nil {
+		return err
+	}
+
+	if len(d.GuestUsername) == 0 {
+		config, err := d.getVMConfig(d.Node, d.VMID)
+		if err != nil {
+			return err
+		}
+		if ciUser, _ := config["ciuser"].(string); len(ciUser) > 0 {
+			d.debugf("using cloud-init user '%s' of the template as ssh user", ciUser)
+			d.GuestUsername = ciUser
+		}
+	}
+	return nil
+}
+
+// sshdPortCommands reconfigures sshd to listen on the given port and opens the
+// port in the guest firewall (ufw, firewalld) and selinux policy if present
+func sshdPortCommands(port int) []string {
+	return []string{
+		fmt.Sprintf("sed -i -e '/^#\\?Port /d' /etc/ssh/sshd_config && echo 'Port %d' >> /etc/ssh/sshd_config", port),
+		fmt.Sprintf("if command -v semanage >/dev/null; then semanage port -a -t ssh_port_t -p tcp %d || true; fi", port),
+		fmt.Sprintf("if command -v ufw >/dev/null; then ufw allow %d/tcp; fi", port),
+		fmt.Sprintf("if command -v firewall-cmd >/dev/null; then firewall-cmd --permanent --add-port=%d/tcp && firewall-cmd --reload; fi", port),
+		// ssh.socket is used for socket activation since ubuntu 22.10
+		"systemctl daemon-reload; systemctl restart ssh.socket 2>/dev/null; systemctl restart ssh 2>/dev/null || systemctl restart sshd",
+	}
+}
+
+// customNetworkConfig returns the --proxmoxve-vm-cloud-init-network-config,
+// given inline or as the path of a local file, for layouts like bonds, vlan
+// interfaces or static routes
+func (d *Driver) customNetworkConfig() (string, error) {
+	data, err := inlineOrFile(d.CloudInitNetworkConfig)
+	if err != nil {
+		return "", err
+	}
+
+	var config struct {
+		Version int `yaml:"version"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return "", fmt.Errorf("not a network-config mapping: %w", err)
+	}
+	if config.Version != 1 && config.Version != 2 {
+		return "", fmt.Errorf("network-config must be version 1 or 2, got %d", config.Version)
+	}
+	return string(data), nil
+}
+
+// cloudInitNetworkConfig renders the network-config (version 2) of the seed for
+// net0 of the given VM config. The ip config and nameservers of the template
+// are carried over, as the generated cloud-init drive they belong to is
+// replaced. Returns an empty string if net0 has no MAC address yet.
+func (d *Driver) cloudInitNetworkConfig(config map[string]interface{}) (string, error) {
+	net0, _ := config["net0"].(string)
+	mac := netMACAddress(net0)
+	if len(mac) == 0 {
+		return "", nil
+	}
+
+	ethernet := map[string]interface{}{
+		"match": map[string]interface{}{"macaddress": strings.ToLower(mac)},
+	}
+	ipconfig, _ := config["ipconfig0"].(string)
+	for k, v := range parsePropertyString(ipconfig) {
+		switch {
+		case k == "ip" && v == "dhcp":
+			ethernet["dhcp4"] = true
+		case k == "ip6" && v == "dhcp":
+			ethernet["dhcp6"] = true
+		case k == "ip6" && v == "auto":
+			ethernet["accept-ra"] = true
+		case k == "ip" || k == "ip6":
+			addresses, _ := ethernet["addresses"].([]string)
+			ethernet["addresses"] = append(addresses, v)
+		case k == "gw":
+			ethernet["gateway4"] = v
+		case k == "gw6":
+			ethernet["gateway6"] = v
+		}
+	}
+	if ethernet["addresses"] == nil && ethernet["dhcp6"] == nil && ethernet["accept-ra"] == nil {
+		ethernet["dhcp4"] = true
+	}
+	if mtu := d.guestMTU(); mtu > 0 {
+		ethernet["mtu"] = mtu
+	}
+
+	nameservers := map[string]interface{}{}
+	if ns, _ := config["nameserver"].(string); len(ns) > 0 {
+		nameservers["addresses"] = strings.Fields(ns)
+	}
+	if search, _ := config["searchdomain"].(string); len(search) > 0 {
+		nameservers["search"] = strings.Fields(search)
+	}
+	if len(nameservers) > 0 {
+		ethernet["nameservers"] = nameservers
+	}
+
+	data, err := yaml.Marshal(map[string]interface{}{
+		"version":   2,
+		"ethernets": map[string]interface{}{"net0": ethernet},
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// parsePropertyString parses a Proxmox VE property string like the ipconfigN
+// value ip=10.0.0.5/24,gw=10.0.0.1
+func parsePropertyString(value string) map[string]string {
+	values := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(part), "="); ok {
+			values[k] = v
+		}
+	}
+	return values
+}
+
+// cloudInitMetaData renders the meta-data of the seed
+func (d *Driver) cloudInitMetaData() string {
+	return fmt.Sprintf("instance-id: iid-%d-%d\nlocal-hostname: %s\n", d.VMID, time.Now().Unix(), d.VMName)
+}
+
+// applyCloudInitSeed replaces the generated cloud-init drive of the VM with a
+// seed rendered by the driver
+func (d *Driver) applyCloudInitSeed(escapedSSHKeys string) error {
+	config, err := d.getVMConfig(d.Node, d.VMID)
+	if err != nil {
+		return err
+	}
+
+	keys, err := url.PathUnescape(escapedSSHKeys)
+	if err != nil {
+		return err
+	}
+	ciUser, _ := config["ciuser"].(string)
+
+	userData, err := d.cloudInitUserData(strings.Split(keys, "\n"), ciUser)
+	if err != nil {
+		return err
+	}
+	d.debugf("cloud-init user-data:\n%s", userData)
+
+	var networkConfig string
+	if len(d.CloudInitNetworkConfig) > 0 {
+		networkConfig, err = d.customNetworkConfig()
+	} else {
+		networkConfig, err = d.cloudInitNetworkConfig(config)
+	}
+	if err != nil {
+		return err
+	}
+	d.debugf("cloud-init network-config:\n%s", networkConfig)
+
+	device := cloudInitDrive(config)
+	if len(device) > 0 {
+		d.debugf("removing generated cloud-init drive %s", device)
+		if err := d.ConfigureVM("delete", device); err != nil {
+			return err
+		}
+	} else {
+		device = freeDevice(config, "ide2", "ide3", "ide0", "ide1")
+	}
+
+	vm, err := d.GetVM()
+	if err != nil {
+		return err
+	}
+
+	d.debugf("attaching cloud-init seed as %s", device)
+	// go-proxmox leaves the ISO it uploads in the temp dir
+	defer os.Remove(filepath.Join(os.TempDir(), seedISOName(d.VMID)))
+	return vm.CloudInit(context.Background(), device, userData, d.cloudInitMetaData(), "", networkConfig)
+}
+
+// seedISOName returns the file name go-proxmox uploads the seed of a VM as
+func seedISOName(vmid int) string {
+	return fmt.Sprintf(proxmox.UserDataISOFormat, vmid)
+}
+
+// deleteCloudInitSeed deletes the seed ISO of the VM from the ISO storage of
+// the node, go-proxmox uploads it to the first one. Unless the media are
+// ejected, it is kept as long as the VM exists, as cloud-init reads it again
+// if the instance id changes.
+func (d *Driver) deleteCloudInitSeed() error {
+	node, err := d.client.Node(context.Background(), d.Node)
+	if err != nil {
+		return err
+	}
+	storage, err := node.StorageISO(context.Background())
+	if err != nil {
+		// no ISO storage, no seed
+		return nil
+	}
+	iso, err := storage.ISO(context.Background(), seedISOName(d.VMID))
+	if err != nil {
+		return nil
+	}
+
+	d.debugf("deleting cloud-init seed %s", iso.VolID)
+	task, err := iso.Delete(context.Background())
+	if err != nil {
+		return err
+	}
+	return task.Wait(context.Background(), d.taskInterval, d.taskTimeout)
+}
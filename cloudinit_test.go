@@ -0,0 +1,193 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_CloudInitUserData(t *testing.T) {
+	var driver = createDriver()
+	driver.VMName = "worker-1"
+
+	assert.False(t, driver.needsCloudInitSeed())
+
+	driver.Timezone = "Europe/Berlin"
+	assert.True(t, driver.needsCloudInitSeed())
+
+	userData, err := driver.cloudInitUserData([]string{"ssh-rsa AAAA worker-1"}, "ubuntu")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(userData, "#cloud-config\n"))
+
+	var config map[string]interface{}
+	assert.Nil(t, yaml.Unmarshal([]byte(userData), &config))
+	assert.Equal(t, "worker-1", config["hostname"])
+	assert.Equal(t, "ubuntu", config["user"])
+	assert.Equal(t, "Europe/Berlin", config["timezone"])
+	assert.Equal(t, []interface{}{"ssh-rsa AAAA worker-1"}, config["ssh_authorized_keys"])
+}
+
+func Test_CloudInitSSHPort(t *testing.T) {
+	var driver = createDriver()
+	driver.GuestSSHPort = 22
+
+	assert.False(t, driver.needsCloudInitSeed())
+
+	driver.GuestSSHPort = 2222
+	assert.True(t, driver.needsCloudInitSeed())
+
+	userData, err := driver.cloudInitUserData(nil, "")
+	assert.Nil(t, err)
+
+	var config map[string]interface{}
+	assert.Nil(t, yaml.Unmarshal([]byte(userData), &config))
+	assert.Contains(t, config["runcmd"], "sed -i -e '/^#\\?Port /d' /etc/ssh/sshd_config && echo 'Port 2222' >> /etc/ssh/sshd_config")
+	assert.Contains(t, config["runcmd"], "if command -v ufw >/dev/null; then ufw allow 2222/tcp; fi")
+}
+
+func Test_CloudInitNetworkConfig(t *testing.T) {
+	var driver = createDriver()
+	driver.NetMtu = "9000"
+
+	assert.True(t, driver.needsCloudInitSeed())
+
+	networkConfig, err := driver.cloudInitNetworkConfig(map[string]interface{}{
+		"net0":       "virtio=BC:24:11:00:00:01,bridge=vmbr0,mtu=9000",
+		"ipconfig0":  "ip=10.0.0.5/24,gw=10.0.0.1",
+		"nameserver": "10.0.0.2 10.0.0.3",
+	})
+	assert.Nil(t, err)
+
+	var config map[string]interface{}
+	assert.Nil(t, yaml.Unmarshal([]byte(networkConfig), &config))
+	net0 := config["ethernets"].(map[string]interface{})["net0"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"macaddress": "bc:24:11:00:00:01"}, net0["match"])
+	assert.Equal(t, []interface{}{"10.0.0.5/24"}, net0["addresses"])
+	assert.Equal(t, "10.0.0.1", net0["gateway4"])
+	assert.Equal(t, 9000, net0["mtu"])
+	assert.Nil(t, net0["dhcp4"])
+
+	// mtu=1 uses the bridge MTU, which is unknown to the driver
+	driver.NetMtu = "1"
+	assert.False(t, driver.needsCloudInitSeed())
+
+	networkConfig, err = driver.cloudInitNetworkConfig(map[string]interface{}{"net0": "virtio=BC:24:11:00:00:01,bridge=vmbr0"})
+	assert.Nil(t, err)
+	assert.Nil(t, yaml.Unmarshal([]byte(networkConfig), &config))
+	net0 = config["ethernets"].(map[string]interface{})["net0"].(map[string]interface{})
+	assert.Equal(t, true, net0["dhcp4"])
+	assert.Nil(t, net0["mtu"])
+}
+
+func Test_CloudInitCustomUserData(t *testing.T) {
+	var driver = createDriver()
+	driver.VMName = "worker-1"
+	driver.GuestSSHPort = 2222
+	driver.CloudInitUserData = "#cloud-config\npackages:\n  - qemu-guest-agent\nhostname: ignored\nssh_authorized_keys:\n  - ssh-rsa BBBB admin\nruncmd:\n  - systemctl enable --now qemu-guest-agent\n"
+
+	assert.True(t, driver.needsCloudInitSeed())
+
+	userData, err := driver.cloudInitUserData([]string{"ssh-rsa AAAA worker-1"}, "")
+	assert.Nil(t, err)
+
+	var config map[string]interface{}
+	assert.Nil(t, yaml.Unmarshal([]byte(userData), &config))
+	assert.Equal(t, "worker-1", config["hostname"])
+	assert.Equal(t, []interface{}{"qemu-guest-agent"}, config["packages"])
+	assert.Equal(t, []interface{}{"ssh-rsa BBBB admin", "ssh-rsa AAAA worker-1"}, config["ssh_authorized_keys"])
+	runcmd := config["runcmd"].([]interface{})
+	assert.Equal(t, "systemctl enable --now qemu-guest-agent", runcmd[len(runcmd)-1])
+
+	file := filepath.Join(t.TempDir(), "user-data.yaml")
+	assert.Nil(t, os.WriteFile(file, []byte("packages:\n  - docker.io\n"), 0600))
+	driver.CloudInitUserData = file
+	custom, err := driver.customUserData()
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"docker.io"}, custom["packages"])
+
+	driver.CloudInitUserData = "- not\n- a mapping\n"
+	_, err = driver.customUserData()
+	assert.NotNil(t, err)
+}
+
+func Test_CIUser(t *testing.T) {
+	var driver = createDriver()
+	err := driver.SetConfigFromFlags(newTestOptions(driver, map[string]interface{}{
+		"proxmoxve-proxmox-host": "pve.example.com",
+		"proxmoxve-vm-ci-user":   "ubuntu",
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, "ubuntu", driver.GetSSHUsername())
+
+	driver = createDriver()
+	err = driver.SetConfigFromFlags(newTestOptions(driver, map[string]interface{}{
+		"proxmoxve-proxmox-host":   "pve.example.com",
+		"proxmoxve-vm-ci-user":     "ubuntu",
+		"proxmoxve-ssh-username":   "admin",
+		"proxmoxve-vm-ci-password": "env:TEST_CI_PASSWORD",
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, "admin", driver.GetSSHUsername())
+
+	t.Setenv("TEST_CI_PASSWORD", "secret")
+	driver.VMName = "worker-1"
+	userData, err := driver.cloudInitUserData(nil, driver.CIUser)
+	assert.Nil(t, err)
+	var config map[string]interface{}
+	assert.Nil(t, yaml.Unmarshal([]byte(userData), &config))
+	assert.NotContains(t, userData, "secret")
+	user, _ := config["user"].(map[string]interface{})
+	assert.Equal(t, "ubuntu", user["name"])
+	assert.Equal(t, false, user["lock_passwd"])
+	hash, _ := user["hashed_passwd"].(string)
+	assert.Equal(t, sha512Crypt("secret", hash[3:19]), hash)
+}
+
+func Test_CloudInitCustomNetworkConfig(t *testing.T) {
+	var driver = createDriver()
+	assert.False(t, driver.needsCloudInitSeed())
+
+	driver.CloudInitNetworkConfig = "version: 2\nethernets:\n  eth0:\n    dhcp4: false\nvlans:\n  vlan10:\n    id: 10\n    link: eth0\n    addresses: [10.0.10.5/24]\n"
+	assert.True(t, driver.needsCloudInitSeed())
+	networkConfig, err := driver.customNetworkConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, driver.CloudInitNetworkConfig, networkConfig)
+
+	file := filepath.Join(t.TempDir(), "network-config.yaml")
+	assert.Nil(t, os.WriteFile(file, []byte("version: 1\nconfig:\n  - type: physical\n    name: eth0\n"), 0600))
+	driver.CloudInitNetworkConfig = file
+	networkConfig, err = driver.customNetworkConfig()
+	assert.Nil(t, err)
+	assert.Contains(t, networkConfig, "type: physical")
+
+	driver.CloudInitNetworkConfig = "version: 3\nethernets: {}\n"
+	_, err = driver.customNetworkConfig()
+	assert.NotNil(t, err)
+}
+
+func Test_CitypeOption(t *testing.T) {
+	var driver = createDriver()
+	driver.Citype = "configdrive2"
+
+	option := driver.citypeOption(map[string]interface{}{"name": "template"})
+	assert.NotNil(t, option)
+	assert.Equal(t, "configdrive2", option.Value)
+
+	assert.Nil(t, driver.citypeOption(map[string]interface{}{"citype": "opennebula"}))
+
+	driver.DiskSize = "16"
+	driver.Memory = 2048
+	driver.GuestSSHPort = 22
+	driver.CloneVMID = "9000"
+	driver.Citype = "cloudbase"
+	assert.Contains(t, validationError(driver.validateFlags()).Error(), "proxmoxve-vm-citype must be one of nocloud, configdrive2, opennebula, got 'cloudbase'")
+
+	driver.Citype = "configdrive2"
+	assert.Empty(t, driver.validateFlags())
+	driver.Timezone = "Europe/Berlin"
+	assert.Contains(t, validationError(driver.validateFlags()).Error(), "proxmoxve-vm-citype must be nocloud with options delivered by the cloud-init seed, which is a NoCloud iso, got 'configdrive2'")
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"github.com/rancher/machine/libmachine/drivers"
+	"gopkg.in/yaml.v3"
+)
+
+// configOptions wraps the command line options and falls back to the values of
+// a config file for every flag that is still set to its default value. The
+// options don't tell whether a flag was given, so a flag given at its default
+// value (false for booleans) can't override the config file.
+type configOptions struct {
+	drivers.DriverOptions
+	defaults map[string]interface{} // flag defaults as declared in GetCreateFlags
+	values   map[string]interface{} // values read from the config file
+}
+
+// loadConfigFile reads the file given by --proxmoxve-config and returns driver
+// options using its values as defaults
+func (d *Driver) loadConfigFile(flags drivers.DriverOptions) (drivers.DriverOptions, error) {
+	path := flags.String("proxmoxve-config")
+	if len(path) == 0 {
+		return flags, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %w", err)
+	}
+
+	raw, err := parseConfigFile(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+
+	defaults := d.flagDefaults()
+
+	environments, _ := raw["environments"].(map[string]interface{})
+	delete(raw, "environments")
+	profiles, _ := raw["profiles"].(map[string]interface{})
+	delete(raw, "profiles")
+
+	values, err := configValues(raw, defaults)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	// values of the selected environment override the top level ones, values
+	// of the selected profile (the size of the machine) override both
+	for _, section := range []struct {
+		kind     string
+		sections map[string]interface{}
+	}{{"environment", environments}, {"profile", profiles}} {
+		flag := "proxmoxve-" + section.kind
+		name := flags.String(flag)
+		if len(name) == 0 && values[flag] != nil {
+			name = fmt.Sprint(values[flag])
+		}
+		if len(name) == 0 {
+			continue
+		}
+
+		selected, ok := section.sections[name].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s '%s' is not defined in config file %s", section.kind, name, path)
+		}
+		selectedValues, err := configValues(selected, defaults)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s' in config file %s: %w", section.kind, name, path, err)
+		}
+		for k, v := range selectedValues {
+			values[k] = v
+		}
+		d.debugf("using %s '%s' from config file %s", section.kind, name, path)
+	}
+
+	d.debugf("loaded %d option(s) from config file %s", len(values), path)
+
+	return &configOptions{
+		DriverOptions: flags,
+		defaults:      defaults,
+		values:        values,
+	}, nil
+}
+
+// parseConfigFile parses a yaml or, by the .json extension, a json config
+// file. Numbers of json files are kept as written, e.g. for large integers.
+func parseConfigFile(path string, data []byte) (map[string]interface{}, error) {
+	var raw map[string]interface{}
+	if !strings.EqualFold(filepath.Ext(path), ".json") {
+		err := yaml.Unmarshal(data, &raw)
+		return raw, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	err := dec.Decode(&raw)
+	return raw, err
+}
+
+// flattenConfig joins the keys of nested sections with their section, e.g.
+// vm: {memory: 4} to vm-memory: 4, no flag takes a mapping as value
+func flattenConfig(raw map[string]interface{}, prefix string, flat map[string]interface{}) {
+	for k, v := range raw {
+		if section, ok := v.(map[string]interface{}); ok {
+			flattenConfig(section, prefix+k+"-", flat)
+			continue
+		}
+		flat[prefix+k] = v
+	}
+}
+
+// flagDefaults returns the default values of all flags by name
+func (d *Driver) flagDefaults() map[string]interface{} {
+	defaults := make(map[string]interface{})
+	for _, f := range d.GetCreateFlags() {
+		defaults[f.String()] = f.Default()
+	}
+	return defaults
+}
+
+// configValues maps the keys of a config file section to flag names and
+// expands ${VAR} references to environment variables in string values
+func configValues(raw map[string]interface{}, defaults map[string]interface{}) (map[string]interface{}, error) {
+	flat := make(map[string]interface{})
+	flattenConfig(raw, "", flat)
+
+	values := make(map[string]interface{})
+	for k, v := range flat {
+		key := configKey(k)
+		if _, ok := defaults[key]; !ok {
+			return nil, fmt.Errorf("unknown option '%s'", k)
+		}
+		switch v := v.(type) {
+		case nil:
+			continue
+		case string:
+			values[key] = expandEnvRefs(v)
+		default:
+			values[key] = v
+		}
+	}
+	return values, nil
+}
+
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnvRefs replaces ${VAR} with the value of the environment variable VAR,
+// so credentials don't need to be written into the config file
+func expandEnvRefs(s string) string {
+	return envRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		return os.Getenv(envRefPattern.FindStringSubmatch(ref)[1])
+	})
+}
+
+// configKey maps a config file key to the flag name, e.g. proxmox-host or
+// proxmox_host to proxmoxve-proxmox-host
+func configKey(k string) string {
+	k = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(k)), "_", "-")
+	if !strings.HasPrefix(k, "proxmoxve-") {
+		k = "proxmoxve-" + k
+	}
+	return k
+}
+
+func (o *configOptions) String(key string) string {
+	v := o.DriverOptions.String(key)
+	if c, ok := o.values[key]; ok && v == o.defaults[key] {
+		return fmt.Sprint(c)
+	}
+	return v
+}
+
+func (o *configOptions) StringSlice(key string) []string {
+	v := o.DriverOptions.StringSlice(key)
+	c, ok := o.values[key]
+	if !ok || len(v) > 0 {
+		return v
+	}
+
+	switch c := c.(type) {
+	case []interface{}:
+		values := make([]string, 0, len(c))
+		for _, item := range c {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	default:
+		return []string{fmt.Sprint(c)}
+	}
+}
+
+func (o *configOptions) Int(key string) int {
+	v := o.DriverOptions.Int(key)
+	if c, ok := o.values[key]; ok && v == o.defaults[key] {
+		i, err := strconv.Atoi(fmt.Sprint(c))
+		if err == nil {
+			return i
+		}
+		log.Warnf("ignoring config value '%v' for %s: %s", c, key, err)
+	}
+	return v
+}
+
+func (o *configOptions) Bool(key string) bool {
+	v := o.DriverOptions.Bool(key)
+	if c, ok := o.values[key]; ok && !v {
+		b, err := strconv.ParseBool(fmt.Sprint(c))
+		if err == nil {
+			return b
+		}
+		log.Warnf("ignoring config value '%v' for %s: %s", c, key, err)
+	}
+	return v
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/stretchr/testify/assert"
+)
+
+// testOptions mimics the command line by returning the flag defaults for
+// every option which is not explicitly set
+type testOptions map[string]interface{}
+
+func newTestOptions(d *Driver, set map[string]interface{}) testOptions {
+	o := testOptions{}
+	for _, f := range d.GetCreateFlags() {
+		o[f.String()] = f.Default()
+	}
+	for k, v := range set {
+		o[k] = v
+	}
+	return o
+}
+
+func (o testOptions) String(key string) string {
+	v, _ := o[key].(string)
+	return v
+}
+
+func (o testOptions) StringSlice(key string) []string {
+	v, _ := o[key].([]string)
+	return v
+}
+
+func (o testOptions) Int(key string) int {
+	v, _ := o[key].(int)
+	return v
+}
+
+func (o testOptions) Bool(key string) bool {
+	v, _ := o[key].(bool)
+	return v
+}
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "proxmox.yaml")
+	err := os.WriteFile(path, []byte(content), 0600)
+	assert.Nil(t, err)
+	return path
+}
+
+func Test_ConfigFileDefaults(t *testing.T) {
+	var driver = createDriver()
+
+	path := writeConfig(t, `
+proxmox-host: pve.example.com
+proxmoxve-proxmox-realm: pve
+vm_memory: 4
+vm-net-bridge: vmbr1
+`)
+
+	err := driver.SetConfigFromFlags(newTestOptions(driver, map[string]interface{}{
+		"proxmoxve-config":        path,
+		"proxmoxve-vm-net-bridge": "vmbr0",
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "pve.example.com", driver.Host)
+	assert.Equal(t, "pve", driver.Realm)
+	assert.Equal(t, 4*1024, driver.Memory)
+	// explicitly given flags win over the config file
+	assert.Equal(t, "vmbr0", driver.NetBridge)
+}
+
+func Test_ConfigFileNested(t *testing.T) {
+	var driver = createDriver()
+
+	path := writeConfig(t, `
+proxmox:
+  host: pve01.example.com
+  user_name: docker-machine
+vm:
+  memory: 8
+  clone:
+    vmid: "9000"
+    bwlimit: 51200
+`)
+
+	err := driver.SetConfigFromFlags(newTestOptions(driver, map[string]interface{}{
+		"proxmoxve-config":    path,
+		"proxmoxve-vm-memory": 4,
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "pve01.example.com", driver.Host)
+	assert.Equal(t, "docker-machine", driver.User)
+	assert.Equal(t, "9000", driver.CloneVMID)
+	assert.Equal(t, 51200, driver.CloneBWLimit)
+	// the command line takes precedence
+	assert.Equal(t, 4*1024, driver.Memory)
+}
+
+func Test_ConfigFileJSON(t *testing.T) {
+	var driver = createDriver()
+
+	path := filepath.Join(t.TempDir(), "proxmox.json")
+	assert.Nil(t, os.WriteFile(path, []byte(`{
+	"proxmox-host": "pve01.example.com",
+	"vm": {"clone-bwlimit": 2000000, "net-bridge": "vmbr1"},
+	"vm-extra-disk": ["100", "scsi2=50"]
+}`), 0600))
+
+	err := driver.SetConfigFromFlags(newTestOptions(driver, map[string]interface{}{
+		"proxmoxve-config": path,
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "pve01.example.com", driver.Host)
+	assert.Equal(t, 2000000, driver.CloneBWLimit)
+	assert.Equal(t, "vmbr1", driver.NetBridge)
+	assert.Equal(t, []string{"100", "scsi2=50"}, driver.ExtraDisks)
+}
+
+func Test_ConfigFileUnknownOption(t *testing.T) {
+	var driver = createDriver()
+
+	path := writeConfig(t, "proxmox-hots: pve.example.com\n")
+
+	err := driver.SetConfigFromFlags(newTestOptions(driver, map[string]interface{}{
+		"proxmoxve-config": path,
+	}))
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown option 'proxmox-hots'")
+}
+
+func Test_ConfigFileEnvironment(t *testing.T) {
+	var driver = createDriver()
+
+	t.Setenv("TEST_PVE_PASSWORD", "secret")
+	path := writeConfig(t, `
+proxmox-realm: pve
+environment: lab
+environments:
+  lab:
+    proxmox-host: pve-lab.example.com
+    proxmox-user-password: ${TEST_PVE_PASSWORD}
+  prod:
+    proxmox-host: pve-prod.example.com
+    proxmox-realm: ldap
+`)
+
+	err := driver.SetConfigFromFlags(newTestOptions(driver, map[string]interface{}{
+		"proxmoxve-config": path,
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "pve-lab.example.com", driver.Host)
+	assert.Equal(t, "pve", driver.Realm)
+	assert.Equal(t, "secret", driver.Password)
+
+	err = driver.SetConfigFromFlags(newTestOptions(driver, map[string]interface{}{
+		"proxmoxve-config":      path,
+		"proxmoxve-environment": "prod",
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "pve-prod.example.com", driver.Host)
+	assert.Equal(t, "ldap", driver.Realm)
+
+	err = driver.SetConfigFromFlags(newTestOptions(driver, map[string]interface{}{
+		"proxmoxve-config":      path,
+		"proxmoxve-environment": "staging",
+	}))
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "environment 'staging' is not defined")
+}
+
+func Test_ConfigFileProfile(t *testing.T) {
+	var driver = createDriver()
+
+	path := writeConfig(t, `
+vm-memory: 4
+vm-cpu-cores: "2"
+environments:
+  prod:
+    proxmox-host: pve-prod.example.com
+    profile: small
+profiles:
+  small:
+    vm-memory: 2
+  gpu:
+    vm:
+      memory: 32
+      cpu-cores: "16"
+      hostpci0: mapping=gpu
+`)
+
+	err := driver.SetConfigFromFlags(newTestOptions(driver, map[string]interface{}{
+		"proxmoxve-config":      path,
+		"proxmoxve-environment": "prod",
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "pve-prod.example.com", driver.Host)
+	assert.Equal(t, 2*1024, driver.Memory)
+	assert.Equal(t, "2", driver.CPUCores)
+
+	err = driver.SetConfigFromFlags(newTestOptions(driver, map[string]interface{}{
+		"proxmoxve-config":      path,
+		"proxmoxve-environment": "prod",
+		"proxmoxve-profile":     "gpu",
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 32*1024, driver.Memory)
+	assert.Equal(t, "16", driver.CPUCores)
+
+	err = driver.SetConfigFromFlags(newTestOptions(driver, map[string]interface{}{
+		"proxmoxve-config":  path,
+		"proxmoxve-profile": "large",
+	}))
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "profile 'large' is not defined")
+}
+
+func Test_DeprecatedFlagAliases(t *testing.T) {
+	var driver = createDriver()
+
+	assert.Contains(t, driver.GetCreateFlags(), mcnflag.StringFlag{
+		Name:   "proxmox-host",
+		EnvVar: "PROXMOX_HOST",
+		Usage:  "deprecated, use --proxmoxve-proxmox-host instead",
+	})
+
+	err := driver.SetConfigFromFlags(newTestOptions(driver, map[string]interface{}{
+		"proxmox-host":              "pve-old.example.com",
+		"proxmox-memory-gb":         2,
+		"proxmox-realm":             "pve",
+		"proxmoxve-proxmox-realm":   "ldap",
+		"proxmoxve-vm-storage-path": "local-lvm",
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "pve-old.example.com", driver.Host)
+	assert.Equal(t, 2*1024, driver.Memory)
+	// the new flag wins if both are given
+	assert.Equal(t, "ldap", driver.Realm)
+	assert.Equal(t, "local-lvm", driver.Storage)
+}
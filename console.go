@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// webURL returns the web interface the API is served by, behind the URL of
+// a reverse proxy if given, else on the first API endpoint
+func (d *Driver) webURL() (*url.URL, error) {
+	api, err := d.apiURL()
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(api)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/api2/json")
+	return u, nil
+}
+
+// consoleURL returns the noVNC console of the VM in the web interface, which
+// asks for a login unless the browser has a session
+func (d *Driver) consoleURL() string {
+	web, err := d.webURL()
+	if err != nil || d.VMID == 0 {
+		return ""
+	}
+	query := url.Values{
+		"console": {"kvm"},
+		"novnc":   {"1"},
+		"vmid":    {fmt.Sprint(d.VMID)},
+		"vmname":  {d.VMName},
+		"node":    {d.Node},
+		"resize":  {"off"},
+	}
+	web.Path += "/"
+	web.RawQuery = query.Encode()
+	return web.String()
+}
+
+// spiceFile renders the remote-viewer file of a spiceproxy ticket
+func spiceFile(ticket map[string]interface{}) string {
+	var keys []string
+	for k := range ticket {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("[virt-viewer]\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%v\n", k, ticket[k])
+	}
+	return b.String()
+}
+
+// SpiceConsole returns a remote-viewer file with a fresh SPICE ticket for the
+// console of the VM, proxied via the host of the web interface. The ticket is only
+// valid for a short time and needs a SPICE display (qxl) of the VM.
+func (d *Driver) SpiceConsole() (string, error) {
+	if err := d.connect(); err != nil {
+		return "", err
+	}
+	vm, err := d.getClusterVM()
+	if err != nil {
+		return "", err
+	}
+	d.Node = vm.Node
+
+	params := map[string]interface{}{}
+	if web, err := d.webURL(); err == nil {
+		params["proxy"] = web.Hostname()
+	}
+	var ticket map[string]interface{}
+	if err := d.client.Post(context.Background(), fmt.Sprintf("/nodes/%s/qemu/%d/spiceproxy", d.Node, d.VMID), params, &ticket); err != nil {
+		return "", fmt.Errorf("unable to get a SPICE ticket for VM %d, does it have a SPICE display (qxl)?: %w", d.VMID, err)
+	}
+	return spiceFile(ticket), nil
+}
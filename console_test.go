@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ConsoleURL(t *testing.T) {
+	var driver = createDriver()
+	assert.Empty(t, driver.consoleURL())
+
+	driver.Host = "pve1.example.com, pve2.example.com"
+	driver.Port = "8006"
+	driver.Node = "pve2"
+	driver.VMID = 120
+	driver.VMName = "worker 1"
+	assert.Equal(t, "https://pve1.example.com:8006/?console=kvm&node=pve2&novnc=1&resize=off&vmid=120&vmname=worker+1", driver.consoleURL())
+
+	// behind a reverse proxy
+	driver.URL = "https://proxy.example.com/pve/"
+	assert.Equal(t, "https://proxy.example.com/pve/?console=kvm&node=pve2&novnc=1&resize=off&vmid=120&vmname=worker+1", driver.consoleURL())
+	web, err := driver.webURL()
+	assert.Nil(t, err)
+	assert.Equal(t, "proxy.example.com", web.Hostname())
+}
+
+func Test_SpiceFile(t *testing.T) {
+	ticket := map[string]interface{}{
+		"type":     "spice",
+		"host":     "pvespiceproxy:65a1b2c3:120:pve2::abc",
+		"password": "secret",
+		"proxy":    "http://pve1.example.com:3128",
+		"tls-port": float64(61000),
+	}
+	assert.Equal(t, "[virt-viewer]\nhost=pvespiceproxy:65a1b2c3:120:pve2::abc\npassword=secret\nproxy=http://pve1.example.com:3128\ntls-port=61000\ntype=spice\n", spiceFile(ticket))
+}
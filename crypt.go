@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"math/big"
+)
+
+// cryptAlphabet is the base64 alphabet of crypt(3)
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// hashPassword returns the SHA-512 crypt(3) hash ($6$) of the password with a
+// random salt, which every distribution's cloud-init accepts as hashed_passwd
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	for i := range salt {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(cryptAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		salt[i] = cryptAlphabet[n.Int64()]
+	}
+	return sha512Crypt(password, string(salt)), nil
+}
+
+// sha512CryptOrder is the order the bytes of the digest are encoded in
+var sha512CryptOrder = [][3]int{
+	{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4}, {47, 5, 26}, {6, 27, 48},
+	{28, 49, 7}, {50, 8, 29}, {9, 30, 51}, {31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13},
+	{56, 14, 35}, {15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19}, {62, 20, 41},
+}
+
+// repeatDigest returns n bytes of the digest repeated
+func repeatDigest(digest []byte, n int) []byte {
+	b := make([]byte, 0, n)
+	for ; n > len(digest); n -= len(digest) {
+		b = append(b, digest...)
+	}
+	return append(b, digest[:n]...)
+}
+
+// sha512Crypt implements the SHA-512 crypt of glibc with the default of 5000
+// rounds, see https://www.akkadia.org/drepper/SHA-crypt.txt
+func sha512Crypt(password, salt string) string {
+	const rounds = 5000
+	key := []byte(password)
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+	s := []byte(salt)
+
+	b := sha512.New()
+	b.Write(key)
+	b.Write(s)
+	b.Write(key)
+	digestB := b.Sum(nil)
+
+	a := sha512.New()
+	a.Write(key)
+	a.Write(s)
+	a.Write(repeatDigest(digestB, len(key)))
+	for i := len(key); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			a.Write(digestB)
+		} else {
+			a.Write(key)
+		}
+	}
+	digestA := a.Sum(nil)
+
+	dp := sha512.New()
+	for i := 0; i < len(key); i++ {
+		dp.Write(key)
+	}
+	p := repeatDigest(dp.Sum(nil), len(key))
+
+	ds := sha512.New()
+	for i := 0; i < 16+int(digestA[0]); i++ {
+		ds.Write(s)
+	}
+	sp := repeatDigest(ds.Sum(nil), len(s))
+
+	c := digestA
+	for i := 0; i < rounds; i++ {
+		h := sha512.New()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(sp)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	out := []byte("$6$" + salt + "$")
+	encode := func(b2, b1, b0 byte, n int) {
+		w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+		for ; n > 0; n-- {
+			out = append(out, cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	for _, i := range sha512CryptOrder {
+		encode(c[i[0]], c[i[1]], c[i[2]], 4)
+	}
+	encode(0, 0, c[63], 2)
+	return string(out)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SHA512Crypt(t *testing.T) {
+	assert.Equal(t, "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+		sha512Crypt("Hello world!", "saltstring"))
+	// the salt is cut to 16 characters, as by glibc
+	assert.Equal(t, "$6$toolongsaltstrin$lQ8jolhgVRVhY4b5pZKaysCLi0QBxGoNeKQzQ3glMhwllF7oGDZxUhx1yxdYcz/e1JSbq3y6JMxxl8audkUEm0",
+		sha512Crypt("This is just a test", "toolongsaltstring"))
+
+	hash, err := hashPassword("secret")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$6$"))
+	assert.Equal(t, sha512Crypt("secret", hash[3:19]), hash)
+}
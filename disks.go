@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"github.com/luthermonson/go-proxmox"
+)
+
+var diskKeyPattern = regexp.MustCompile(`^(ide|sata|scsi|virtio)\d+$`)
+
+// isDisk returns true for the config keys of disk devices (ide0, scsi1, ...)
+func isDisk(key string) bool {
+	return diskKeyPattern.MatchString(key)
+}
+
+// isCdrom returns true for the values of cdrom and cloud-init devices
+func isCdrom(value string) bool {
+	return strings.Contains(value, "media=cdrom") || strings.Contains(value, "cloudinit")
+}
+
+// cloudInitDrive returns the device of the cloud-init drive of a VM config (if any)
+func cloudInitDrive(config map[string]interface{}) string {
+	for _, key := range sortedKeys(config) {
+		if isDisk(key) && strings.Contains(fmt.Sprint(config[key]), "cloudinit") {
+			return key
+		}
+	}
+	return ""
+}
+
+// bootDisk returns the device of the first disk in the boot order of a VM config
+func bootDisk(config map[string]interface{}) string {
+	if boot, ok := config["boot"].(string); ok {
+		for _, device := range strings.Split(strings.TrimPrefix(boot, "order="), ";") {
+			if value, ok := config[device]; ok && isDisk(device) && !isCdrom(fmt.Sprint(value)) {
+				return device
+			}
+		}
+	}
+	if device, ok := config["bootdisk"].(string); ok && len(device) > 0 {
+		return device
+	}
+	for _, key := range sortedKeys(config) {
+		if isDisk(key) && !isCdrom(fmt.Sprint(config[key])) {
+			return key
+		}
+	}
+	return "scsi0"
+}
+
+// diskStorage returns the storage of a disk value like local-lvm:vm-100-disk-0,size=16G
+func diskStorage(value string) string {
+	volume, _, _ := strings.Cut(value, ",")
+	storage, _, found := strings.Cut(volume, ":")
+	if !found {
+		return ""
+	}
+	return storage
+}
+
+// freeDevice returns the first of the given devices which is unused in a VM config
+func freeDevice(config map[string]interface{}, devices ...string) string {
+	for _, device := range devices {
+		if _, ok := config[device]; !ok {
+			return device
+		}
+	}
+	return ""
+}
+
+// defaultScsiController is the scsihw of VMs created from scratch
+const defaultScsiController = "virtio-scsi-pci"
+
+// scsiControllers are the values of scsihw
+var scsiControllers = []string{"lsi", "lsi53c810", "virtio-scsi-pci", "virtio-scsi-single", "megasas", "pvscsi"}
+
+// scsiController returns the scsihw of a VM created from scratch
+func (d *Driver) scsiController() string {
+	if len(d.ScsiController) == 0 {
+		return defaultScsiController
+	}
+	return d.ScsiController
+}
+
+// scsiAttributes returns ScsiAttributes as key=value options
+func (d *Driver) scsiAttributes() []string {
+	var options []string
+	for _, option := range strings.Split(d.ScsiAttributes, ",") {
+		if option = strings.TrimSpace(option); len(option) > 0 {
+			options = append(options, option)
+		}
+	}
+	return options
+}
+
+// diskOptions returns the options applied to the disks of the VM, as key=value
+func (d *Driver) diskOptions() []string {
+	var options []string
+	for _, o := range [][2]string{
+		{"cache", d.DiskCache},
+		{"discard", d.DiskDiscard},
+		{"iothread", d.DiskIOThread},
+		{"ssd", d.DiskSSD},
+	} {
+		if len(o[1]) > 0 {
+			options = append(options, o[0]+"="+o[1])
+		}
+	}
+	return options
+}
+
+// throttleOptions returns the io limits of the primary disk, as key=value
+func (d *Driver) throttleOptions() []string {
+	var options []string
+	for _, o := range [][2]string{
+		{"mbps_rd", d.DiskMBpsRd},
+		{"mbps_wr", d.DiskMBpsWr},
+		{"iops_rd", d.DiskIOPSRd},
+		{"iops_wr", d.DiskIOPSWr},
+	} {
+		if len(o[1]) > 0 {
+			options = append(options, o[0]+"="+o[1])
+		}
+	}
+	return options
+}
+
+// validateThrottleOptions checks that the io limits are positive numbers
+func (d *Driver) validateThrottleOptions() []string {
+	var problems []string
+	for _, o := range [][2]string{{"mbps-rd", d.DiskMBpsRd}, {"mbps-wr", d.DiskMBpsWr}} {
+		if mbps, err := strconv.ParseFloat(o[1], 64); len(o[1]) > 0 && (err != nil || mbps <= 0) {
+			problems = append(problems, fmt.Sprintf("proxmoxve-vm-disk-%s must be a positive number of MB/s, got '%s'", o[0], o[1]))
+		}
+	}
+	for _, o := range [][2]string{{"iops-rd", d.DiskIOPSRd}, {"iops-wr", d.DiskIOPSWr}} {
+		if iops, err := strconv.Atoi(o[1]); len(o[1]) > 0 && (err != nil || iops <= 0) {
+			problems = append(problems, fmt.Sprintf("proxmoxve-vm-disk-%s must be a positive number of operations per second, got '%s'", o[0], o[1]))
+		}
+	}
+	return problems
+}
+
+// validateDiskOptions checks the values of the disk options
+func (d *Driver) validateDiskOptions() []string {
+	var problems []string
+	switch d.DiskCache {
+	case "", "none", "writethrough", "writeback", "directsync", "unsafe":
+	default:
+		problems = append(problems, fmt.Sprintf("proxmoxve-vm-disk-cache must be none, writethrough, writeback, directsync or unsafe, got '%s'", d.DiskCache))
+	}
+	if d.DiskDiscard != "" && d.DiskDiscard != "on" && d.DiskDiscard != "ignore" {
+		problems = append(problems, fmt.Sprintf("proxmoxve-vm-disk-discard must be on or ignore, got '%s'", d.DiskDiscard))
+	}
+	if d.DiskIOThread != "" && d.DiskIOThread != "0" && d.DiskIOThread != "1" {
+		problems = append(problems, fmt.Sprintf("proxmoxve-vm-disk-iothread must be 0 or 1, got '%s'", d.DiskIOThread))
+	}
+	if d.DiskSSD != "" && d.DiskSSD != "0" && d.DiskSSD != "1" {
+		problems = append(problems, fmt.Sprintf("proxmoxve-vm-disk-ssd must be 0 or 1, got '%s'", d.DiskSSD))
+	}
+	if d.ScsiController != "" && !strings.Contains(" "+strings.Join(scsiControllers, " ")+" ", " "+d.ScsiController+" ") {
+		problems = append(problems, fmt.Sprintf("proxmoxve-vm-scsi-controller must be one of %s, got '%s'", strings.Join(scsiControllers, ", "), d.ScsiController))
+	}
+	for _, option := range d.scsiAttributes() {
+		if key, _, ok := strings.Cut(option, "="); !ok || len(key) == 0 {
+			problems = append(problems, fmt.Sprintf("proxmoxve-vm-scsi-attributes must be key=value pairs like iothread=1,ssd=1, got '%s'", option))
+		}
+	}
+	return problems
+}
+
+// setDiskOptions sets the options in a disk value like
+// local-lvm:vm-100-disk-0,size=16G, replacing existing ones
+func setDiskOptions(value string, options []string) string {
+	parts := strings.Split(value, ",")
+	for _, option := range options {
+		key, _, _ := strings.Cut(option, "=")
+		replaced := false
+		for i, part := range parts[1:] {
+			if k, _, _ := strings.Cut(part, "="); k == key {
+				parts[i+1] = option
+				replaced = true
+			}
+		}
+		if !replaced {
+			parts = append(parts, option)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// bootDiskOptions returns ScsiAttributes, the disk options and io limits of
+// the boot disk, later ones replacing earlier ones with the same key
+func (d *Driver) bootDiskOptions() []string {
+	options := append(d.scsiAttributes(), d.diskOptions()...)
+	return append(options, d.throttleOptions()...)
+}
+
+// applyDiskOptions applies the scsi controller, ScsiAttributes, the disk
+// options and io limits to the boot disk of the clone
+func (d *Driver) applyDiskOptions() error {
+	if len(d.ScsiController) > 0 {
+		if err := d.ConfigureVM("scsihw", d.ScsiController); err != nil {
+			return err
+		}
+	}
+
+	options := d.bootDiskOptions()
+	if len(options) == 0 {
+		return nil
+	}
+
+	config, err := d.getVMConfig(d.Node, d.VMID)
+	if err != nil {
+		return err
+	}
+	device := bootDisk(config)
+	value, ok := config[device].(string)
+	if !ok {
+		return fmt.Errorf("VM %d has no disk %s to apply %s to", d.VMID, device, strings.Join(options, ","))
+	}
+	return d.ConfigureVM(device, setDiskOptions(value, options))
+}
+
+// diskSizeUnits are the units of the size option of a disk value
+var diskSizeUnits = map[byte]float64{'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30, 'T': 1 << 40}
+
+// diskSize returns the size in bytes of a disk value like
+// local-lvm:vm-100-disk-0,size=16G, false if it has no size
+func diskSize(value string) (float64, bool) {
+	size := parsePropertyString(value)["size"]
+	if len(size) == 0 {
+		return 0, false
+	}
+	unit := 1.0
+	if u, ok := diskSizeUnits[size[len(size)-1]]; ok {
+		unit, size = u, size[:len(size)-1]
+	}
+	n, err := strconv.ParseFloat(size, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n * unit, true
+}
+
+// growDisk grows the disk of the VM to the given size in GB. Disks can't
+// shrink, so a disk which is already as large or larger is left as is.
+func (d *Driver) growDisk(vm *proxmox.VirtualMachine, config map[string]interface{}, device string, gb int) error {
+	if size, ok := diskSize(fmt.Sprint(config[device])); ok && size >= float64(gb)*diskSizeUnits['G'] {
+		if size > float64(gb)*diskSizeUnits['G'] {
+			log.Warnf("disk %s of VM %d is larger than %dG already, skipping the resize", device, d.VMID, gb)
+		}
+		return nil
+	}
+
+	d.debugf("resizing disk %s of VM %d to %dG", device, d.VMID, gb)
+	if err := vm.ResizeDisk(context.Background(), device, fmt.Sprintf("%dG", gb)); err != nil {
+		return fmt.Errorf("unable to resize disk %s of VM %d: %w", device, d.VMID, err)
+	}
+	return nil
+}
+
+// validateDiskSize checks that DiskSize doesn't shrink the disk of the
+// template which is grown
+func (d *Driver) validateDiskSize(config map[string]interface{}, cloneVmId int) []string {
+	gb, err := strconv.Atoi(d.DiskSize)
+	if err != nil {
+		// already reported by validateFlags
+		return nil
+	}
+	device := d.resizeDevice(config)
+	size, ok := diskSize(fmt.Sprint(config[device]))
+	if !ok || size <= float64(gb)*diskSizeUnits['G'] {
+		return nil
+	}
+	minimum := int(math.Ceil(size / diskSizeUnits['G']))
+	return []string{fmt.Sprintf("proxmoxve-vm-storage-size: %dG is smaller than disk %s of VM %d, disks can't shrink, use at least %d", gb, device, cloneVmId, minimum)}
+}
+
+// resizeDevice returns the disk of the clone grown to DiskSize, ResizeDevice
+// or the boot disk of the template
+func (d *Driver) resizeDevice(config map[string]interface{}) string {
+	if len(d.ResizeDevice) > 0 {
+		return d.ResizeDevice
+	}
+	return bootDisk(config)
+}
+
+// parseExtraDisk splits a --proxmoxve-vm-extra-disk value given as
+// [<device>=]<size in GB>
+func parseExtraDisk(value string) (string, int, error) {
+	device, size, found := strings.Cut(value, "=")
+	if !found {
+		device, size = "", value
+	} else if !isDisk(device) {
+		return "", 0, fmt.Errorf("'%s' is not a disk device like scsi1", device)
+	}
+	gb, err := strconv.Atoi(size)
+	if err != nil || gb <= 0 {
+		return "", 0, fmt.Errorf("size of '%s' must be a positive number of GB", value)
+	}
+	return device, gb, nil
+}
+
+// nextDiskDevice returns the first unused scsi device of a VM config
+func nextDiskDevice(config map[string]interface{}) string {
+	for i := 0; i <= 30; i++ {
+		if device := fmt.Sprintf("scsi%d", i); config[device] == nil {
+			return device
+		}
+	}
+	return ""
+}
+
+// applyExtraDisks grows the disks of the VM given by device or adds new disks
+// of the given size on Storage (or the storage of the boot disk)
+func (d *Driver) applyExtraDisks() error {
+	vm, err := d.GetVM()
+	if err != nil {
+		return err
+	}
+	config, err := d.getVMConfig(d.Node, d.VMID)
+	if err != nil {
+		return err
+	}
+	storage := d.Storage
+	if len(storage) == 0 {
+		storage = diskStorage(fmt.Sprint(config[bootDisk(config)]))
+	}
+
+	for _, value := range d.ExtraDisks {
+		device, size, err := parseExtraDisk(value)
+		if err != nil {
+			return err
+		}
+		if _, exists := config[device]; exists {
+			if err := d.growDisk(vm, config, device, size); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(device) == 0 {
+			if device = nextDiskDevice(config); len(device) == 0 {
+				return fmt.Errorf("VM %d has no free scsi device for another disk", d.VMID)
+			}
+		}
+		disk := setDiskOptions(fmt.Sprintf("%s:%d", storage, size), d.diskOptions())
+		d.debugf("adding disk %s=%s", device, disk)
+		if err := d.ConfigureVM(device, disk); err != nil {
+			return fmt.Errorf("unable to add disk %s to VM %d: %w", device, d.VMID, err)
+		}
+		config[device] = disk
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ensureCloudInitDrive adds a cloud-init drive to the VM unless it already has one
+func (d *Driver) ensureCloudInitDrive() error {
+	config, err := d.getVMConfig(d.Node, d.VMID)
+	if err != nil {
+		return err
+	}
+
+	if device := cloudInitDrive(config); device != "" {
+		d.debugf("VM %d has cloud-init drive %s", d.VMID, device)
+		return nil
+	}
+
+	storage := d.Storage
+	if len(storage) == 0 {
+		storage = diskStorage(fmt.Sprint(config[bootDisk(config)]))
+	}
+	device := freeDevice(config, "ide2", "ide3", "ide0", "ide1")
+	if len(storage) == 0 || len(device) == 0 {
+		return fmt.Errorf("unable to add a cloud-init drive to VM %d (storage: '%s', free ide device: '%s')", d.VMID, storage, device)
+	}
+
+	d.debugf("adding cloud-init drive %s on storage %s", device, storage)
+	return d.ConfigureVM(device, storage+":cloudinit")
+}
+
+// removableMedia returns the cdrom devices of a VM config with media inserted
+// and the cloud-init drives, which are removed as a whole
+func removableMedia(config map[string]interface{}) (cdroms []string, cloudInit []string) {
+	for _, key := range sortedKeys(config) {
+		value := fmt.Sprint(config[key])
+		if !isDisk(key) || !isCdrom(value) {
+			continue
+		}
+		volume, _, _ := strings.Cut(value, ",")
+		switch {
+		case strings.Contains(volume, "cloudinit"):
+			cloudInit = append(cloudInit, key)
+		case volume != "none" && volume != "cdrom":
+			cdroms = append(cdroms, key)
+		}
+	}
+	return cdroms, cloudInit
+}
+
+// ejectMedia ejects the installation and cloud-init seed media and removes the
+// cloud-init drive once the machine is up, so the VM keeps no references to
+// removable media. The seed iso is deleted from the storage too. It runs
+// before the protection of the VM is set, which blocks removing drives.
+func (d *Driver) ejectMedia() error {
+	config, err := d.getVMConfig(d.Node, d.VMID)
+	if err != nil {
+		return err
+	}
+
+	cdroms, cloudInit := removableMedia(config)
+	for _, device := range cdroms {
+		d.debugf("ejecting %s from %s", config[device], device)
+		if err := d.ConfigureVM(device, "none,media=cdrom"); err != nil {
+			return err
+		}
+	}
+	for _, device := range cloudInit {
+		d.debugf("removing cloud-init drive %s", device)
+		if err := d.ConfigureVM("delete", device); err != nil {
+			return err
+		}
+	}
+	return d.deleteCloudInitSeed()
+}
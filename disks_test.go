@@ -0,0 +1,140 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DiskHelpers(t *testing.T) {
+	config := map[string]interface{}{
+		"boot":    "order=ide2;virtio0;net0",
+		"ide2":    "local:iso/ubuntu.iso,media=cdrom",
+		"ide0":    "local-lvm:vm-100-cloudinit,media=cdrom",
+		"scsi0":   "local-lvm:vm-100-disk-1,size=8G",
+		"virtio0": "ceph:vm-100-disk-0,size=32G",
+		"net0":    "virtio=AA:BB:CC:DD:EE:FF,bridge=vmbr0",
+	}
+
+	assert.Equal(t, "virtio0", bootDisk(config))
+	assert.Equal(t, "ide0", cloudInitDrive(config))
+	assert.Equal(t, "ceph", diskStorage(config["virtio0"].(string)))
+	assert.Equal(t, "ide3", freeDevice(config, "ide2", "ide3"))
+
+	delete(config, "boot")
+	delete(config, "ide0")
+	assert.Equal(t, "scsi0", bootDisk(config))
+	assert.Equal(t, "", cloudInitDrive(config))
+}
+
+func Test_RemovableMedia(t *testing.T) {
+	cdroms, cloudInit := removableMedia(map[string]interface{}{
+		"ide0":  "local-lvm:vm-100-cloudinit,media=cdrom",
+		"ide1":  "none,media=cdrom",
+		"ide2":  "local:iso/ubuntu.iso,media=cdrom",
+		"ide3":  "local:iso/user-data-100.iso,media=cdrom",
+		"scsi0": "local-lvm:vm-100-disk-1,size=8G",
+	})
+
+	assert.Equal(t, []string{"ide2", "ide3"}, cdroms)
+	assert.Equal(t, []string{"ide0"}, cloudInit)
+}
+
+func Test_DiskOptions(t *testing.T) {
+	var driver = createDriver()
+	assert.Empty(t, driver.diskOptions())
+
+	driver.DiskCache = "writeback"
+	driver.DiskDiscard = "on"
+	driver.DiskIOThread = "1"
+	driver.DiskSSD = "1"
+	assert.Empty(t, driver.validateDiskOptions())
+
+	assert.Equal(t, "local-lvm:vm-101-disk-0,cache=writeback,size=16G,discard=on,iothread=1,ssd=1",
+		setDiskOptions("local-lvm:vm-101-disk-0,cache=none,size=16G", driver.diskOptions()))
+
+	driver.DiskCache = "fast"
+	driver.DiskSSD = "yes"
+	assert.Len(t, driver.validateDiskOptions(), 2)
+}
+
+func Test_ThrottleOptions(t *testing.T) {
+	var driver = createDriver()
+	driver.DiskMBpsRd = "200"
+	driver.DiskMBpsWr = "100.5"
+	driver.DiskIOPSWr = "1000"
+
+	assert.Equal(t, []string{"mbps_rd=200", "mbps_wr=100.5", "iops_wr=1000"}, driver.throttleOptions())
+	assert.Empty(t, driver.validateThrottleOptions())
+
+	driver.DiskIOPSRd = "1.5"
+	driver.DiskMBpsRd = "-1"
+	assert.Equal(t, []string{
+		"proxmoxve-vm-disk-mbps-rd must be a positive number of MB/s, got '-1'",
+		"proxmoxve-vm-disk-iops-rd must be a positive number of operations per second, got '1.5'",
+	}, driver.validateThrottleOptions())
+}
+
+func Test_ExtraDisks(t *testing.T) {
+	device, size, err := parseExtraDisk("100")
+	assert.Nil(t, err)
+	assert.Equal(t, "", device)
+	assert.Equal(t, 100, size)
+
+	device, size, err = parseExtraDisk("virtio1=20")
+	assert.Nil(t, err)
+	assert.Equal(t, "virtio1", device)
+	assert.Equal(t, 20, size)
+
+	_, _, err = parseExtraDisk("disk1=20")
+	assert.NotNil(t, err)
+	_, _, err = parseExtraDisk("scsi1=0")
+	assert.NotNil(t, err)
+
+	config := map[string]interface{}{"scsi0": "local-lvm:vm-101-disk-0", "scsi1": "local-lvm:vm-101-disk-1", "ide2": "local-lvm:vm-101-cloudinit,media=cdrom"}
+	assert.Equal(t, "scsi2", nextDiskDevice(config))
+
+	var driver = createDriver()
+	config["boot"] = "order=scsi1"
+	assert.Equal(t, "scsi1", driver.resizeDevice(config))
+	driver.ResizeDevice = "scsi0"
+	assert.Equal(t, "scsi0", driver.resizeDevice(config))
+}
+
+func Test_DiskSize(t *testing.T) {
+	size, ok := diskSize("local-lvm:vm-100-disk-0,size=16G")
+	assert.True(t, ok)
+	assert.Equal(t, float64(16<<30), size)
+	size, ok = diskSize("local:100/vm-100-disk-0.qcow2,iothread=1,size=2252M")
+	assert.True(t, ok)
+	assert.Equal(t, float64(2252<<20), size)
+	_, ok = diskSize("local-lvm:vm-100-disk-0")
+	assert.False(t, ok)
+
+	var driver = createDriver()
+	config := map[string]interface{}{"scsi0": "local-lvm:base-100-disk-0,size=32G"}
+	driver.DiskSize = "16"
+	assert.Equal(t, []string{"proxmoxve-vm-storage-size: 16G is smaller than disk scsi0 of VM 100, disks can't shrink, use at least 32"}, driver.validateDiskSize(config, 100))
+	driver.DiskSize = "32"
+	assert.Nil(t, driver.validateDiskSize(config, 100))
+}
+
+func Test_ScsiAttributes(t *testing.T) {
+	var driver = createDriver()
+	assert.Equal(t, "virtio-scsi-pci", driver.scsiController())
+	driver.ScsiController = "virtio-scsi-single"
+	assert.Equal(t, "virtio-scsi-single", driver.scsiController())
+
+	driver.ScsiAttributes = "iothread=1, ssd=1,"
+	driver.DiskSSD = "0"
+	assert.Equal(t, []string{"iothread=1", "ssd=1", "ssd=0"}, driver.bootDiskOptions())
+	assert.Equal(t, "local-lvm:vm-100-disk-0,size=16G,iothread=1,ssd=0", setDiskOptions("local-lvm:vm-100-disk-0,size=16G", driver.bootDiskOptions()))
+	assert.Nil(t, driver.validateDiskOptions())
+
+	driver.ScsiController = "virtio"
+	driver.ScsiAttributes = "iothread"
+	assert.Equal(t, []string{
+		"proxmoxve-vm-scsi-controller must be one of lsi, lsi53c810, virtio-scsi-pci, virtio-scsi-single, megasas, pvscsi, got 'virtio'",
+		"proxmoxve-vm-scsi-attributes must be key=value pairs like iothread=1,ssd=1, got 'iothread'",
+	}, driver.validateDiskOptions())
+}
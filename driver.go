@@ -2,13 +2,13 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
-	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -18,36 +18,71 @@ import (
 
 	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/mcnflag"
+	"github.com/rancher/machine/libmachine/mcnutils"
 	"github.com/rancher/machine/libmachine/ssh"
 	"github.com/rancher/machine/libmachine/state"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
+// ipProbeTimeout is the time to wait for a cached ip to answer before it is discovered again
+const ipProbeTimeout = 3 * time.Second
+
 // Driver for Proxmox VE
 type Driver struct {
 	*drivers.BaseDriver
 	client *proxmox.Client
 
 	// Basic Authentication for Proxmox VE
-	Host     string // Host to connect to
+	Host     string // Host to connect to, or comma separated hosts to fail over to
 	Port     string // Port to connect to (default 8006)
+	URL      string // optional, base URL of the API (e.g. behind a reverse proxy), overrides Host and Port
 	Node     string // optional, node to create VM on, host used if omitted but must match internal node name
 	User     string // username
 	Password string // password
 	Realm    string // realm, e.g. pam, pve, etc.
 
+	Headers     []string // headers added to every API request, as "Name: value"
+	InsecureTLS bool     // skip the verification of the API certificate
+	CAFile      string   // CA certificate to verify the API certificate with
+
+	APIRetries      int // attempts of API requests failing transiently
+	APIRetryBackoff int // seconds to wait before the first retry, doubled with every attempt
+
+	NodeCandidates  []string // nodes the VM may be placed on, Node is selected from them
+	PlacementPolicy string   // spread places the VM on the node with the fewest VMs of the same Rancher cluster
+
+	MemoryOvercommit string // ratio of the memory of a node available to VMs, 0 disables the capacity check
+	CPUOvercommit    string // ratio of vCPUs of running VMs to cpus of a node, 0 disables the capacity check
+
 	// File to load as boot image RancherOS/Boot2Docker
 	ImageFile string // in the format <storagename>:iso/<filename>.iso
 
-	Pool            string // pool to add the VM to (necessary for users with only pool permission)
-	Storage         string // internal PVE storage name
-	StorageType     string // Type of the storage (currently QCOW2 and RAW)
-	DiskSize        string // disk size in GB
-	Memory          int    // memory in GB
-	StorageFilename string
-	Onboot          string // Specifies whether a VM will be started during system bootup.
-	Protection      string // Sets the protection flag of the VM. This will disable the remove VM and remove disk operations.
-	Citype          string // Specifies the cloud-init configuration format.
-	NUMA            string // Enable/disable NUMA
+	CloudImageURL      string // cloud image downloaded to the node and imported as scsi0
+	CloudImageStorage  string // storage the cloud image is downloaded to, needs the import content type
+	CloudImageChecksum string // checksum of the cloud image as <algorithm>:<checksum>
+
+	Pool               string // pool to add the VM to (necessary for users with only pool permission), nested pools as path e.g. rancher/prod
+	PoolCreate         bool   // create missing levels of the pool
+	Storage            string // internal PVE storage name
+	StorageType        string // Type of the storage (currently QCOW2 and RAW)
+	DiskSize           string // disk size in GB
+	Memory             int    // memory in GB
+	MemoryBalloon      string // minimum memory in GB for ballooning, 0 disables ballooning
+	MemoryShares       string // memory shares for auto-ballooning
+	StorageFilename    string
+	Onboot             string // Specifies whether a VM will be started during system bootup.
+	KVM                string // Enable/disable hardware virtualization
+	Autostart          string // Enable/disable the automatic restart after a crash
+	Protection         string // Sets the protection flag of the VM. This will disable the remove VM and remove disk operations.
+	ProtectionOverride bool   // clear the protection flag when the machine is removed instead of failing
+	RemoveBackup       string // storage to back up the VM to before it is removed
+	GoldenSnapshot     string // snapshot taken of the VM once it is created, to roll it back to
+	HAGroup            string // HA group to register the VM in as HA resource
+	HAState            string // requested state of the HA resource, started if empty
+	Citype             string // cloud-init format, unless the template defines one
+	NUMA               string // Enable/disable NUMA
+	BIOS               string // firmware of the VM, seabios or ovmf
+	MachineType        string // machine type of the VM, q35 or i440fx
 
 	NetModel    string // Net Interface Model, [e1000, virtio, realtek, etc...]
 	NetFirewall string // Enable/disable firewall
@@ -55,25 +90,128 @@ type Driver struct {
 	NetBridge   string // bridge applied to network interface
 	NetVlanTag  int    // vlan tag
 
-	HostPci0 string // host pci adapter that should be attached via passthrough https://pve.proxmox.com/wiki/PCI(e)_Passthrough
+	HostPci0 string   // host pci adapter that should be attached via passthrough https://pve.proxmox.com/wiki/PCI(e)_Passthrough
+	HostPCI  []string // further host pci adapters, attached as hostpci1, hostpci2, ...
 
 	ScsiController string
 	ScsiAttributes string
 
-	VMID          int    // VM ID only filled by create()
-	VMIDRange     string // acceptable range of VMIDs
-	CloneVMID     string // VM ID to clone
-	CloneFull     int    // Make a full (detached) clone from parent (defaults to true if VMID is not a template, otherwise false)
-	GuestUsername string // user to log into the guest OS to copy the public key
-	GuestPassword string // password to log into the guest OS to copy the public key
-	GuestSSHPort  int    // ssh port to log into the guest OS to copy the public key
-	CPU           string // Emulated CPU type.
-	CPUSockets    string // The number of cpu sockets.
-	CPUCores      string // The number of cores per socket.
-	driverDebug   bool   // driver debugging
-
+	DiskCache    string // cache mode of the disks, e.g. none or writeback
+	DiskDiscard  string // pass discards (trim) to the storage: on or ignore
+	DiskIOThread string // use a dedicated io thread per disk (0/1)
+	DiskSSD      string // present the disks as ssd to the guest (0/1)
+
+	ResizeDevice string   // disk of the clone grown to DiskSize, the boot disk if empty
+	ExtraDisks   []string // further disks as [<device>=]<size in GB>, existing ones are grown
+
+	DiskMBpsRd string // read limit of the primary disk in MB/s
+	DiskMBpsWr string // write limit of the primary disk in MB/s
+	DiskIOPSRd string // read limit of the primary disk in operations per second
+	DiskIOPSWr string // write limit of the primary disk in operations per second
+
+	VMID           int    // VM ID only filled by create()
+	VMIDRange      string // acceptable range of VMIDs
+	VMIDRetries    int    // number of retries with another VMID if the allocated one is taken concurrently
+	CloneVMID      string // VM ID to clone
+	CloneName      string // name of the template to clone, a trailing * selects the newest one with the prefix
+	CloneSnapshot  string // snapshot of the clone source to clone from instead of its current state
+	ExistingVMID   string // VM ID of an existing VM to adopt instead of creating one
+	ExistingRemove bool   // remove the adopted VM with the machine instead of detaching it
+	Adopted        bool   // VMID is an adopted VM, which is only removed with ExistingRemove
+	CloneFull      int    // Make a full (detached) clone from parent, as decided by CloneFullMode
+	CloneFullMode  string // 1 for a full clone, 0 for a linked clone, auto for linked clones of templates on shared storage
+	CloneBWLimit   int    // bandwidth limit of the clone in KiB/s, 0 for the default of the storage or datacenter
+	GuestUsername  string // user to log into the guest OS to copy the public key
+	GuestPassword  string // password to log into the guest OS to copy the public key
+	GuestSSHPort   int    // ssh port to log into the guest OS to copy the public key
+	CPU            string // Emulated CPU type.
+	CPUSockets     string // The number of cpu sockets.
+	CPUCores       string // The number of cores per socket.
+	CPULimit       string // Limit of cpu usage, in cpus (0 = unlimited).
+	CPUUnits       string // CPU weight of the VM relative to the other VMs of the node.
+	VCPUs          string // The number of hotplugged vcpus, up to sockets * cores.
+	MACAddress     string // MAC address of the interface the IPAddress was discovered on
+	VMName         string // name of the VM in Proxmox VE, sanitized MachineName or rendered from VMNameTemplate
+	VMNameTemplate string // template for the VM name
+	ConsoleURL     string // noVNC console of the VM in the web interface
+
+	SSHKeysReplace bool     // replace the sshkeys of the template instead of appending to them
+	SSHExtraKeys   []string // public keys authorized besides the generated one
+	SSHKeySource   string   // existing private key used instead of generating one, with its public key next to it as .pub
+
+	NodeForward           bool   // reach the guest via port forwards of its node
+	NodeForwardPortBase   int    // node ports above it are forwarded to the guests, two per VMID
+	NodeForwardSSHUser    string // user to log into the node with to add the forwards
+	NodeForwardSSHKey     string // private key to log into the node with
+	NodeForwardKnownHosts string // known_hosts file with the host keys of the nodes
+
+	CloneArchMap []string // templates (ID or name) to clone per architecture, as arch=template
+	Arch         string   // architecture of the VM, selects the template from CloneArchMap
+	ArchEmulate  bool     // emulate a foreign architecture (kvm=0), e.g. arm64 on x86_64 hosts
+
+	CloudInitDriveAdd bool // add a cloud-init drive to the clone if the template has none
+	EjectMedia        bool // eject installation and cloud-init media once the machine is up
+	CloneMinimal      bool // don't touch agent, autostart, kvm, citype, onboot, memory, cpus, disk size, protection, sshkeys and description of the clone
+
+	Timezone string // guest timezone set via cloud-init
+
+	CloudInitIP      string // static guest address set via cloud-init ipconfig0 instead of DHCP
+	CloudInitGateway string // gateway of the static guest address
+	CloudInitNetmask string // netmask of the static guest address, unless CloudInitIP is in CIDR notation
+	Nameserver       string // cloud-init DNS servers, comma or space separated
+	CIUser           string // cloud-init user, also the ssh user unless GuestUsername is given
+	CIPassword       string // cloud-init password of CIUser
+	Searchdomain     string // cloud-init DNS search domains, comma or space separated
+
+	CloudInitUserData      string // custom cloud-config merged into the seed user-data, inline or a local file
+	CloudInitNetworkConfig string // network-config of the seed instead of the one rendered for net0, inline or a local file
+
+	RancherCluster  string // owning Rancher cluster, applied as tag and description
+	RancherNodePool string // owning Rancher node pool, applied as tag and description
+	LookupTag       string // tag the VM has to have to be found by name if the store lost the VMID
+	VMIDRecovered   bool   // VMID was looked up by name and tag, the VM is never removed
+
+	DescriptionTemplate string // template for the provisioning metadata written to the VM description
+
+	IPStablePolls int    // number of consecutive polls the discovered IP has to stay unchanged and reachable
+	IPProtocol    string // protocol of the discovered IP: ipv4, ipv6 or dual (ipv4, falling back to ipv6)
+	IPSource      string // where the IP is discovered: agent, dhcp-lease or config
+	IPCIDR        string // subnet the IP reported by the guest agent has to be in
+	IPInterface   string // guest interface the IP reported by the guest agent has to be on
+
+	ShutdownTimeout int // seconds Stop waits for the guest to shut down before stopping it hard
+
+	FirewallEnable      string // enable the VM firewall (0/1, ''=default)
+	FirewallPolicyIn    string // VM firewall input policy
+	FirewallPolicyOut   string // VM firewall output policy
+	FirewallLogLevelIn  string // VM firewall log level for incoming traffic
+	FirewallLogLevelOut string // VM firewall log level for outgoing traffic
+	FirewallMacFilter   string // VM firewall MAC address filter (0/1, ''=default)
+
+	WebhookURL      string   // url notified about create, start, stop and remove
+	WebhookTemplate string   // text/template of the webhook body, json if empty
+	WebhookEvents   []string // events the webhook is notified about, all if empty
+
+	GuestFiles      []string          // local files copied into the guest via the agent after boot, as src:dest
+	GuestExec       []string          // commands run in the guest via the agent after boot
+	Bootstrap       bool              // install qemu-guest-agent via cloud-init, set the hostname and install docker via the agent
+	CloudInitWait   bool              // wait via the agent until cloud-init finished before the machine is provisioned
+	EnginePort      int               // port of the docker daemon, 2376 if 0
+	EngineWait      int               // seconds Create waits for the docker daemon to accept connections
+	GuestExecOutput []GuestExecResult // output of the GuestExec commands
+
+	LogFormat    string // format of the debug output, text or json
+	TaskTimeout  int    // seconds until an individual task times out
+	TaskInterval int    // seconds to wait within a task loop
+
+	driverDebug  bool          // driver debugging
+	keepFailedVM bool          // keep the VM if Create fails instead of removing it
 	taskTimeout  time.Duration // The number of seconds until an individual task times out
 	taskInterval time.Duration // The number of seconds to wait within a task loop
+	cloneNode    string        // node of the clone source, if it differs from Node
+	placement    []string      // selected node followed by the fallback nodes
+	pveVersion   pveVersion    // release of the cluster, known once connected
+	forwardReady bool          // the port forward of the node is in place
 }
 
 // NewDriver returns a new driver
@@ -88,40 +226,60 @@ func NewDriver(hostName, storePath string) drivers.Driver {
 	}
 }
 
-func (d *Driver) debugf(format string, v ...interface{}) {
-	if d.driverDebug {
-		log.Infof(format, v...)
-	}
-}
-
-func (d *Driver) debug(v ...interface{}) {
-	if d.driverDebug {
-		log.Info(v...)
-	}
-}
-
 func (d *Driver) connectApi() (client *proxmox.Client, err error) {
 	var options []proxmox.Option
 
+	tlsConfig, err := d.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	var transport http.RoundTripper = &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+	if endpoints := d.apiEndpoints(); len(d.URL) == 0 && len(endpoints) > 1 {
+		transport = &failoverTransport{base: transport, endpoints: endpoints}
+	}
+	if len(d.Headers) > 0 {
+		header, err := d.apiHeaders()
+		if err != nil {
+			return nil, err
+		}
+		transport = &headerTransport{base: transport, header: header}
+	}
+	if d.APIRetries > 1 {
+		transport = &retryTransport{base: transport, attempts: d.APIRetries, backoff: time.Duration(d.APIRetryBackoff) * time.Second}
+	}
+
 	options = append(options, proxmox.WithHTTPClient(&http.Client{
-		Timeout: d.taskTimeout,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+		Timeout:   d.taskTimeout,
+		Transport: transport,
 	}))
+	password, err := resolveSecret(d.Password)
+	if err != nil {
+		return nil, err
+	}
 	credentials := proxmox.Credentials{
 		Username: d.User,
-		Password: d.Password,
+		Password: password,
 		Realm:    d.Realm,
 	}
 	options = append(options, proxmox.WithCredentials(&credentials))
 
-	proxmoxUrl := fmt.Sprintf("https://%s:%s/api2/json", d.Host, d.Port)
+	proxmoxUrl, err := d.apiURL()
+	if err != nil {
+		return nil, err
+	}
 	log.Debug(fmt.Sprintf("Connecting to %s", proxmoxUrl))
 	d.client = proxmox.NewClient(proxmoxUrl, options...)
 
 	version, err := d.client.Version(context.Background())
 	if err != nil {
+		return nil, tlsError(err)
+	}
+	if d.pveVersion, err = parsePVEVersion(version.Version); err != nil {
+		return nil, err
+	}
+	if err := checkPVEVersion(d.pveVersion); err != nil {
 		return nil, err
 	}
 	c, err2 := d.client.Cluster(context.Background())
@@ -134,15 +292,65 @@ func (d *Driver) connectApi() (client *proxmox.Client, err error) {
 	return d.client, err
 }
 
+// apiURL returns the url of the API: URL, with /api2/json appended unless
+// it already ends with it, or https://Host:Port/api2/json of the first host
+func (d *Driver) apiURL() (string, error) {
+	if len(d.URL) == 0 {
+		endpoints := d.apiEndpoints()
+		if len(endpoints) == 0 {
+			return "", errors.New("no host given")
+		}
+		// the failover transport switches to the other hosts if needed
+		return fmt.Sprintf("https://%s/api2/json", endpoints[0]), nil
+	}
+
+	u, err := url.Parse(d.URL)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || len(u.Host) == 0 {
+		return "", fmt.Errorf("'%s' is not a http(s) url", d.URL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	if !strings.HasSuffix(u.Path, "/api2/json") {
+		u.Path += "/api2/json"
+	}
+	return u.String(), nil
+}
+
 // GetCreateFlags returns the argument flags for the program
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
-	return []mcnflag.Flag{
+	flags := []mcnflag.Flag{
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_CONFIG",
+			Name:   "proxmoxve-config",
+			Usage:  "config file (yaml, or json if ending in .json) supplying default values for all other flags; flags at their default value (false for booleans) don't override it",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_ENVIRONMENT",
+			Name:   "proxmoxve-environment",
+			Usage:  "named environment (e.g. lab, staging, prod) of the config file to use",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_PROFILE",
+			Name:   "proxmoxve-profile",
+			Usage:  "named profile (e.g. small, etcd, gpu) of the config file with the cpu, memory, disk and network settings to use",
+			Value:  "",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_PROXMOX_HOST",
 			Name:   "proxmoxve-proxmox-host",
-			Usage:  "Host to connect to",
+			Usage:  "Host to connect to, or a comma separated list of cluster nodes to fail over to in this order (host or host:port)",
 			Value:  "192.168.1.253",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_PROXMOX_URL",
+			Name:   "proxmoxve-proxmox-url",
+			Usage:  "base URL of the API instead of host and port, e.g. https://proxy.example.com/pve behind a reverse proxy",
+			Value:  "",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_PROXMOX_PORT",
 			Name:   "proxmoxve-proxmox-port",
@@ -152,45 +360,145 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_PROXMOX_NODE",
 			Name:   "proxmoxve-proxmox-node",
-			Usage:  "Node to use (defaults to host)",
+			Usage:  "Node to use (''=the online node with the most free memory)",
+			Value:  "",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "PROXMOXVE_PROXMOX_NODES",
+			Name:   "proxmoxve-proxmox-nodes",
+			Usage:  "nodes the VM may be placed on, the first online node with free --proxmoxve-vm-hostpci0/--proxmoxve-vm-hostpci devices is used, the next ones if creating the VM fails there (repeatable, overrides --proxmoxve-proxmox-node)",
+			Value:  []string{},
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_PROXMOX_PLACEMENT_POLICY",
+			Name:   "proxmoxve-proxmox-placement-policy",
+			Usage:  "spread: place the VM on the candidate node with the fewest VMs of the same --proxmoxve-rancher-cluster, so a failing node takes down as few of them as possible (default: the order of --proxmoxve-proxmox-nodes or the load of the nodes)",
 			Value:  "",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_PROXMOX_MEMORY_OVERCOMMIT",
+			Name:   "proxmoxve-proxmox-memory-overcommit",
+			Usage:  "the memory of the VM has to fit into the memory of the node not in use, scaled by this ratio (0 to skip the check)",
+			Value:  defaultMemoryOvercommit,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_PROXMOX_CPU_OVERCOMMIT",
+			Name:   "proxmoxve-proxmox-cpu-overcommit",
+			Usage:  "the vCPUs of the running VMs of the node and the new VM have to fit into its cpus, scaled by this ratio (0 to skip the check)",
+			Value:  defaultCPUOvercommit,
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_PROXMOX_USER_NAME",
 			Name:   "proxmoxve-proxmox-user-name",
-			Usage:  "User to connect as",
+			Usage:  "User to connect as, either plain or as user@realm",
 			Value:  "root",
 		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_PROXMOX_USER_PASSWORD",
 			Name:   "proxmoxve-proxmox-user-password",
-			Usage:  "Password to connect with",
+			Usage:  "Password to connect with (or env:<VAR>/file:<path> to only store a reference)",
 			Value:  "",
 		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_PROXMOX_REALM",
 			Name:   "proxmoxve-proxmox-realm",
-			Usage:  "Realm to connect to (default: pam)",
+			Usage:  "Realm to connect to (default: pam, overridden by user@realm)",
 			Value:  "pam",
 		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_PROXMOX_INSECURE_TLS",
+			Name:   "proxmoxve-proxmox-insecure-tls",
+			Usage:  "skip the verification of the API certificate",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_PROXMOX_CA_FILE",
+			Name:   "proxmoxve-proxmox-ca-file",
+			Usage:  "PEM file with the CA certificate to verify the API certificate with, e.g. a copy of /etc/pve/pve-root-ca.pem",
+			Value:  "",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_PROXMOX_RETRIES",
+			Name:   "proxmoxve-proxmox-retries",
+			Usage:  "attempts of API requests failing with 5xx, 596 or a reset connection (1 to disable retries)",
+			Value:  3,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_PROXMOX_RETRY_BACKOFF",
+			Name:   "proxmoxve-proxmox-retry-backoff",
+			Usage:  "seconds to wait before retrying a failed API request, doubled with every attempt",
+			Value:  1,
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "PROXMOXVE_PROXMOX_HEADER",
+			Name:   "proxmoxve-proxmox-header",
+			Usage:  "header added to every API request as 'Name: value', the value can be given as env:<VAR> or file:<path> (repeatable)",
+			Value:  []string{},
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_PROXMOX_POOL",
 			Name:   "proxmoxve-proxmox-pool",
-			Usage:  "pool to attach to",
+			Usage:  "pool to attach to, nested pools (PVE 8.1+) as path e.g. rancher/prod/workers",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_PROXMOX_POOL_CREATE",
+			Name:   "proxmoxve-proxmox-pool-create",
+			Usage:  "create missing levels of the pool",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_RANCHER_CLUSTER",
+			Name:   "proxmoxve-rancher-cluster",
+			Usage:  "owning Rancher cluster, added as tag rancher-cluster-<name> and to the description of the VM",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_RANCHER_NODE_POOL",
+			Name:   "proxmoxve-rancher-node-pool",
+			Usage:  "owning Rancher node pool, added as tag rancher-pool-<cluster>-<name> and to the description of the VM",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_LOOKUP_TAG",
+			Name:   "proxmoxve-vm-lookup-tag",
+			Usage:  "look a VM whose VMID got lost up by name among the VMs with this tag, e.g. rancher-cluster-<name> (default: no lookup)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_DESCRIPTION_TEMPLATE",
+			Name:   "proxmoxve-vm-description-template",
+			Usage:  "template for the provisioning metadata added to the VM description (variables: MachineName, VMName, Cluster, NodePool, Created, Version, Template, Node)",
 			Value:  "",
 		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_VM_VMID_RANGE",
 			Name:   "proxmoxve-vm-vmid-range",
-			Usage:  "range of acceptable vmid values <low>[:<high>]",
+			Usage:  "range of acceptable vmid values <low>:<high> (''=next free vmid of the cluster)",
 			Value:  "",
 		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_VM_VMID_RETRIES",
+			Name:   "proxmoxve-vm-vmid-retries",
+			Usage:  "number of retries with another vmid if the allocated one is taken by a concurrent create",
+			Value:  3,
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_VM_STORAGE_PATH",
 			Name:   "proxmoxve-vm-storage-path",
 			Usage:  "storage to create the VM volume on",
 			Value:  "", // leave the flag default value blank to support the clone default behavior if not explicity set of 'use what is most appropriate'
 		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_KVM",
+			Name:   "proxmoxve-vm-kvm",
+			Usage:  "enable hardware virtualization, 0 for hosts without nested virtualization (0=false, 1=true, ''=default)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_AUTOSTART",
+			Name:   "proxmoxve-vm-autostart",
+			Usage:  "restart the VM automatically after a crash (0=false, 1=true, ''=default)",
+			Value:  "",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_VM_STORAGE_SIZE",
 			Name:   "proxmoxve-vm-storage-size",
@@ -206,13 +514,73 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_VM_SCSI_CONTROLLER",
 			Name:   "proxmoxve-vm-scsi-controller",
-			Usage:  "scsi controller model (default: virtio-scsi-pci)",
-			Value:  "virtio-scsi-pci",
+			Usage:  "scsi controller model (default: virtio-scsi-pci, clones keep the one of the template)",
+			Value:  "",
 		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_VM_SCSI_ATTRIBUTES",
 			Name:   "proxmoxve-vm-scsi-attributes",
-			Usage:  "scsi0 attributes",
+			Usage:  "attributes merged into the boot disk, e.g. iothread=1,ssd=1",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_RESIZE_DISK",
+			Name:   "proxmoxve-vm-resize-disk",
+			Usage:  "disk of the clone grown to --proxmoxve-vm-storage-size, e.g. virtio0 (''=boot disk of the template)",
+			Value:  "",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "PROXMOXVE_VM_EXTRA_DISK",
+			Name:   "proxmoxve-vm-extra-disk",
+			Usage:  "further disk as [<device>=]<size in GB>, e.g. 100 or scsi1=100, existing disks of the template are grown (repeatable)",
+			Value:  []string{},
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_DISK_CACHE",
+			Name:   "proxmoxve-vm-disk-cache",
+			Usage:  "cache mode of the disk: none, writethrough, writeback, directsync or unsafe (''=default)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_DISK_DISCARD",
+			Name:   "proxmoxve-vm-disk-discard",
+			Usage:  "pass discards of the guest to the storage: on or ignore (''=default)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_DISK_IOTHREAD",
+			Name:   "proxmoxve-vm-disk-iothread",
+			Usage:  "use a dedicated io thread for the disk, requires the virtio-scsi-single controller (0=false, 1=true, ''=default)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_DISK_SSD",
+			Name:   "proxmoxve-vm-disk-ssd",
+			Usage:  "present the disk as ssd to the guest (0=false, 1=true, ''=default)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_DISK_MBPS_RD",
+			Name:   "proxmoxve-vm-disk-mbps-rd",
+			Usage:  "read limit of the disk in MB/s (''=unlimited)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_DISK_MBPS_WR",
+			Name:   "proxmoxve-vm-disk-mbps-wr",
+			Usage:  "write limit of the disk in MB/s (''=unlimited)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_DISK_IOPS_RD",
+			Name:   "proxmoxve-vm-disk-iops-rd",
+			Usage:  "read limit of the disk in operations per second (''=unlimited)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_DISK_IOPS_WR",
+			Name:   "proxmoxve-vm-disk-iops-wr",
+			Usage:  "write limit of the disk in operations per second (''=unlimited)",
 			Value:  "",
 		},
 		mcnflag.IntFlag{
@@ -221,6 +589,18 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "memory in GB",
 			Value:  8,
 		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_MEMORY_BALLOON",
+			Name:   "proxmoxve-vm-memory-balloon",
+			Usage:  "minimum memory in GB the balloon device may shrink the VM to (0=disable ballooning, ''=default)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_MEMORY_SHARES",
+			Name:   "proxmoxve-vm-memory-shares",
+			Usage:  "memory shares for auto-ballooning, VMs with more shares keep their memory longer under host pressure (0-50000, ''=default 1000)",
+			Value:  "",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_VM_NUMA",
 			Name:   "proxmoxve-vm-numa",
@@ -233,6 +613,18 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "Emulatd CPU",
 			Value:  "", // leave the flag default value blank to support the clone default behavior if not explicity set of 'use what is most appropriate'
 		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_BIOS",
+			Name:   "proxmoxve-vm-bios",
+			Usage:  "firmware of the VM, seabios or ovmf (UEFI, an efidisk is added on --proxmoxve-vm-storage-path) (''=default)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_MACHINE_TYPE",
+			Name:   "proxmoxve-vm-machine-type",
+			Usage:  "machine type of the VM, q35 (required for PCIe passthrough) or i440fx, optionally versioned like pc-q35-8.1 (''=default)",
+			Value:  "",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_VM_CPU_SOCKETS",
 			Name:   "proxmoxve-vm-cpu-sockets",
@@ -245,12 +637,98 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "number of cpu cores",
 			Value:  "",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CPU_LIMIT",
+			Name:   "proxmoxve-vm-cpu-limit",
+			Usage:  "limit of the cpu usage in cpus, e.g. 1.5 (0=unlimited, ''=default)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CPU_UNITS",
+			Name:   "proxmoxve-vm-cpu-units",
+			Usage:  "cpu weight of the VM relative to the other VMs of the node, 1 to 262144 (''=default of 100)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_VCPUS",
+			Name:   "proxmoxve-vm-vcpus",
+			Usage:  "number of vcpus plugged at boot, up to sockets * cores (''=all)",
+			Value:  "",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_VM_CLONE_VMID",
 			Name:   "proxmoxve-vm-clone-vmid",
 			Usage:  "vmid to clone",
 			Value:  "",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CLONE_NAME",
+			Name:   "proxmoxve-vm-clone-name",
+			Usage:  "name of the template to clone instead of --proxmoxve-vm-clone-vmid, a trailing * selects the newest template with the prefix (e.g. ubuntu-24.04-*)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CLONE_SNAPSHOT",
+			Name:   "proxmoxve-vm-clone-snapshot",
+			Usage:  "snapshot to clone from instead of the current state, the clone source then needn't be a template (always a full clone)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_EXISTING_VMID",
+			Name:   "proxmoxve-vm-existing-vmid",
+			Usage:  "vmid of an existing VM to adopt instead of creating one, it gets the ssh key via the guest agent or cloud-init",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_VM_EXISTING_REMOVE",
+			Name:   "proxmoxve-vm-existing-remove",
+			Usage:  "remove the adopted VM of --proxmoxve-vm-existing-vmid when the machine is removed (default: the VM is kept)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CLONE_FULL",
+			Name:   "proxmoxve-vm-clone-full",
+			Usage:  "make a full clone (1), a linked clone of a template (0) or a linked clone if the template is on shared storage (auto)",
+			Value:  "1",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_VM_CLONE_BWLIMIT",
+			Name:   "proxmoxve-vm-clone-bwlimit",
+			Usage:  "bandwidth limit of cloning the template in KiB/s (0 for the limit of the storage or datacenter)",
+			Value:  0,
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "PROXMOXVE_VM_CLONE_ARCH_MAP",
+			Name:   "proxmoxve-vm-clone-arch-map",
+			Usage:  "template to clone per architecture as <arch>=<vmid or template name>, e.g. amd64=9000 (repeatable)",
+			Value:  []string{},
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_ARCH",
+			Name:   "proxmoxve-vm-arch",
+			Usage:  "architecture of the VM (e.g. amd64, arm64), selects the template from --proxmoxve-vm-clone-arch-map, arm64 VMs are configured for aarch64",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_VM_ARCH_EMULATE",
+			Name:   "proxmoxve-vm-arch-emulate",
+			Usage:  "emulate the architecture without hardware virtualization (kvm=0), e.g. for arm64 VMs on x86_64 hosts",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_NAME_TEMPLATE",
+			Name:   "proxmoxve-vm-name-template",
+			Usage:  "template for the VM name, e.g. '{{.Pool}}-{{.Name}}-{{.Random}}' (variables: Name, Pool, Node, Index, Random)",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_VM_CLONE_MINIMAL",
+			Name:   "proxmoxve-vm-clone-minimal",
+			Usage:  "minimal-touch clone: keep agent, autostart, kvm, citype, onboot, memory, cpus, disk size, protection, sshkeys and description of the template (for users without VM.Config rights); the template has to authorize the key of --proxmoxve-ssh-keypath",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_VM_CLOUD_INIT_DRIVE_ADD",
+			Name:   "proxmoxve-vm-cloud-init-drive-add",
+			Usage:  "add a cloud-init drive to the clone if the template has none",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_VM_START_ONBOOT",
 			Name:   "proxmoxve-vm-start-onboot",
@@ -263,10 +741,128 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "protect the VM and disks from removal (0=false, 1=true, ''=default)",
 			Value:  "", // leave the flag default value blank to support the clone default behavior if not explicity set of 'use what is most appropriate'
 		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_VM_PROTECTION_OVERRIDE",
+			Name:   "proxmoxve-vm-protection-override",
+			Usage:  "clear the protection flag of the VM when the machine is removed, e.g. by Rancher scaling down the node pool (default: removing a protected VM fails)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_GOLDEN_SNAPSHOT",
+			Name:   "proxmoxve-vm-golden-snapshot",
+			Usage:  "name of a snapshot taken once the VM is created, to roll a misbehaving machine back to its just provisioned state",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_REMOVE_BACKUP",
+			Name:   "proxmoxve-remove-backup",
+			Usage:  "storage to back up the VM to (vzdump) before the machine is removed, the VM is kept if the backup fails",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_HA_GROUP",
+			Name:   "proxmoxve-vm-ha-group",
+			Usage:  "HA group to register the VM in, so Proxmox VE HA restarts it on another node if its node fails",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_HA_STATE",
+			Name:   "proxmoxve-vm-ha-state",
+			Usage:  "requested state of the HA resource of the VM: started, stopped, enabled, disabled or ignored (default started, registers the VM without a group)",
+			Value:  "",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_VM_IMAGE_FILE",
 			Name:   "proxmoxve-vm-image-file",
-			Usage:  "storage of the image file (e.g. local:iso/rancheros-proxmoxve-autoformat.iso)",
+			Usage:  "iso to create the VM from when no --proxmoxve-vm-clone-vmid is given (e.g. local:iso/rancheros-proxmoxve-autoformat.iso)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CLOUD_IMAGE_URL",
+			Name:   "proxmoxve-vm-cloud-image-url",
+			Usage:  "cloud image (qcow2, raw or vmdk) to download to the node and create the VM from when no --proxmoxve-vm-clone-vmid is given",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CLOUD_IMAGE_STORAGE",
+			Name:   "proxmoxve-vm-cloud-image-storage",
+			Usage:  "storage the cloud image is downloaded to, it has to allow the import content type",
+			Value:  "local",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CLOUD_IMAGE_CHECKSUM",
+			Name:   "proxmoxve-vm-cloud-image-checksum",
+			Usage:  "checksum the downloaded cloud image is verified against, e.g. sha256:<checksum>",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_VM_EJECT_MEDIA",
+			Name:   "proxmoxve-vm-eject-media",
+			Usage:  "eject iso media and remove the cloud-init drive once the machine is up",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_TIMEZONE",
+			Name:   "proxmoxve-vm-timezone",
+			Usage:  "guest timezone set via cloud-init, e.g. Europe/Berlin (''=default of the image)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CLOUD_INIT_IP",
+			Name:   "proxmoxve-vm-cloud-init-ip",
+			Usage:  "static IPv4 address of the guest set via cloud-init, e.g. 10.0.0.5/24 (''=DHCP)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CLOUD_INIT_GATEWAY",
+			Name:   "proxmoxve-vm-cloud-init-gateway",
+			Usage:  "gateway of the static guest address, e.g. 10.0.0.1",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CLOUD_INIT_NETMASK",
+			Name:   "proxmoxve-vm-cloud-init-netmask",
+			Usage:  "netmask of the static guest address, e.g. 24 or 255.255.255.0 (not needed in CIDR notation)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_NAMESERVER",
+			Name:   "proxmoxve-vm-nameserver",
+			Usage:  "DNS servers set via cloud-init, comma separated (default: those of the template or the node)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CI_USER",
+			Name:   "proxmoxve-vm-ci-user",
+			Usage:  "user created by cloud-init, also the ssh user unless proxmoxve-ssh-username is given (default: the one of the template)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CI_PASSWORD",
+			Name:   "proxmoxve-vm-ci-password",
+			Usage:  "password of the cloud-init user (or env:<VAR>/file:<path> to only store a reference)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_SEARCHDOMAIN",
+			Name:   "proxmoxve-vm-searchdomain",
+			Usage:  "DNS search domains set via cloud-init, comma separated (default: those of the template or the node)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CLOUD_INIT_USER_DATA",
+			Name:   "proxmoxve-vm-cloud-init-user-data",
+			Usage:  "custom cloud-config user-data, inline or the path of a local file, merged into the cloud-init seed",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CITYPE",
+			Name:   "proxmoxve-vm-citype",
+			Usage:  "cloud-init format (nocloud, configdrive2 or opennebula), only set if the template doesn't define one",
+			Value:  "nocloud",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_CLOUD_INIT_NETWORK_CONFIG",
+			Name:   "proxmoxve-vm-cloud-init-network-config",
+			Usage:  "cloud-init network-config (version 1 or 2), inline or the path of a local file, e.g. for bonds, vlan interfaces or static routes (replaces the network-config of net0)",
 			Value:  "",
 		},
 		mcnflag.StringFlag{
@@ -281,6 +877,42 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "enable/disable firewall (0=false, 1=true, ''=default)",
 			Value:  "",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_FIREWALL_ENABLE",
+			Name:   "proxmoxve-vm-firewall-enable",
+			Usage:  "enable/disable the VM firewall, required for the net0 firewall to filter (0=false, 1=true, ''=default)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_FIREWALL_POLICY_IN",
+			Name:   "proxmoxve-vm-firewall-policy-in",
+			Usage:  "VM firewall input policy (ACCEPT, REJECT, DROP, ''=default)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_FIREWALL_POLICY_OUT",
+			Name:   "proxmoxve-vm-firewall-policy-out",
+			Usage:  "VM firewall output policy (ACCEPT, REJECT, DROP, ''=default)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_FIREWALL_LOG_LEVEL_IN",
+			Name:   "proxmoxve-vm-firewall-log-level-in",
+			Usage:  "VM firewall log level for incoming traffic (e.g. nolog, info, warning, ''=default)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_FIREWALL_LOG_LEVEL_OUT",
+			Name:   "proxmoxve-vm-firewall-log-level-out",
+			Usage:  "VM firewall log level for outgoing traffic (e.g. nolog, info, warning, ''=default)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_FIREWALL_MACFILTER",
+			Name:   "proxmoxve-vm-firewall-macfilter",
+			Usage:  "enable/disable the VM firewall MAC address filter (0=false, 1=true, ''=default)",
+			Value:  "",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_VM_NET_MTU",
 			Name:   "proxmoxve-vm-net-mtu",
@@ -305,6 +937,12 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "pci(e) device from host to attach to vm",
 			Value:  "", // default blank means no device will be attached
 		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "PROXMOXVE_VM_HOSTPCI",
+			Name:   "proxmoxve-vm-hostpci",
+			Usage:  "further pci(e) device to attach, with options like 0000:01:00.0,pcie=1,rombar=0 or mapping=gpu,mdev=nvidia-63 (repeatable)",
+			Value:  []string{},
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_SSH_USERNAME",
 			Name:   "proxmoxve-ssh-username",
@@ -314,33 +952,180 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_SSH_PASSWORD",
 			Name:   "proxmoxve-ssh-password",
-			Usage:  "Password to log in to the guest OS (default tcuser for rancheros)",
+			Usage:  "Password to log in to the guest OS (default tcuser for rancheros, or env:<VAR>/file:<path> to only store a reference)",
 			Value:  "",
 		},
 		mcnflag.IntFlag{
 			EnvVar: "PROXMOXVE_SSH_PORT",
 			Name:   "proxmoxve-ssh-port",
-			Usage:  "SSH port in the guest to log in to (defaults to 22)",
+			Usage:  "SSH port in the guest to log in to (defaults to 22), other ports are configured in the guest via cloud-init",
 			Value:  22,
 		},
 		mcnflag.BoolFlag{
-			EnvVar: "PROXMOXVE_DEBUG_DRIVER",
-			Name:   "proxmoxve-debug-driver",
-			Usage:  "enables debugging in the driver",
+			EnvVar: "PROXMOXVE_SSH_KEYS_REPLACE",
+			Name:   "proxmoxve-ssh-keys-replace",
+			Usage:  "replace the cloud-init sshkeys of the template instead of appending the generated key to them",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_NODE_FORWARD",
+			Name:   "proxmoxve-node-forward",
+			Usage:  "reach ssh and the docker daemon of guests on host-only bridges via port forwards (iptables) of their node, added via ssh to the node",
 		},
 		mcnflag.IntFlag{
-			EnvVar: "PROXMOXVE_TASK_TIMEOUT",
-			Name:   "proxmoxve-task-timeout",
+			EnvVar: "PROXMOXVE_NODE_FORWARD_PORT_BASE",
+			Name:   "proxmoxve-node-forward-port-base",
+			Usage:  "the node ports base+2*VMID and base+2*VMID+1 are forwarded to ssh and the docker daemon of the guest",
+			Value:  defaultNodeForwardPortBase,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_NODE_FORWARD_SSH_USER",
+			Name:   "proxmoxve-node-forward-ssh-user",
+			Usage:  "user to log into the node via ssh to add the port forwards, needs to run iptables",
+			Value:  "root",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_NODE_FORWARD_SSH_KEY",
+			Name:   "proxmoxve-node-forward-ssh-key",
+			Usage:  "private key to log into the node via ssh to add the port forwards",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_NODE_FORWARD_KNOWN_HOSTS",
+			Name:   "proxmoxve-node-forward-known-hosts",
+			Usage:  "known_hosts file with the ssh host keys of the nodes, which are verified before adding the port forwards",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_SSH_KEYPATH",
+			Name:   "proxmoxve-ssh-keypath",
+			Usage:  "existing private ssh key to use instead of generating one, the public key has to be next to it as <path>.pub",
+			Value:  "",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "PROXMOXVE_SSH_EXTRA_KEY",
+			Name:   "proxmoxve-ssh-extra-key",
+			Usage:  "public key, or a local file with one key per line, authorized in the cloud-init sshkeys besides the generated one, e.g. for break-glass access of administrators (repeatable)",
+			Value:  []string{},
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_WEBHOOK_URL",
+			Name:   "proxmoxve-webhook-url",
+			Usage:  "url the outcome of create, start, stop and remove is posted to",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_WEBHOOK_TEMPLATE",
+			Name:   "proxmoxve-webhook-template",
+			Usage:  "go template of the webhook body, e.g. {\"text\": \"{{.MachineName}} {{.Event}} {{.Status}}\"} (defaults to json of the event)",
+			Value:  "",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "PROXMOXVE_WEBHOOK_EVENTS",
+			Name:   "proxmoxve-webhook-events",
+			Usage:  "events the webhook is notified about: create, start, stop, remove (defaults to all)",
+			Value:  []string{},
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "PROXMOXVE_VM_GUEST_FILE",
+			Name:   "proxmoxve-vm-guest-file",
+			Usage:  "local file copied into the guest via qemu-guest-agent before provisioning, as <src>:<dest> (repeatable, up to 45 KiB)",
+			Value:  []string{},
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "PROXMOXVE_VM_GUEST_EXEC",
+			Name:   "proxmoxve-vm-guest-exec",
+			Usage:  "command run in the guest via qemu-guest-agent after boot, file:<path> runs a local script (repeatable)",
+			Value:  []string{},
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_VM_BOOTSTRAP",
+			Name:   "proxmoxve-vm-bootstrap",
+			Usage:  "prepare generic cloud images: install qemu-guest-agent via cloud-init, then set the hostname and install docker via the agent",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_ENGINE_PORT",
+			Name:   "proxmoxve-engine-port",
+			Usage:  "port of the docker daemon in the machine URL",
+			Value:  defaultEnginePort,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_ENGINE_WAIT",
+			Name:   "proxmoxve-engine-wait",
+			Usage:  "seconds Create waits for the docker daemon of templates with docker preinstalled (or installed by --proxmoxve-vm-bootstrap) to accept connections, for slowly booting VMs (0 to not wait)",
+			Value:  0,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_VM_CLOUD_INIT_WAIT",
+			Name:   "proxmoxve-vm-cloud-init-wait",
+			Usage:  "wait via qemu-guest-agent until cloud-init finished (cloud-init status --wait) before docker-machine provisions the machine over ssh",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_IP_STABLE_POLLS",
+			Name:   "proxmoxve-ip-stable-polls",
+			Usage:  "number of consecutive polls the discovered IP has to stay unchanged and reachable via SSH before Create returns (0 to disable)",
+			Value:  0,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_IP_PROTOCOL",
+			Name:   "proxmoxve-vm-ip-protocol",
+			Usage:  "protocol of the IP discovered via the guest agent: ipv4, ipv6 or dual (ipv4, falling back to ipv6)",
+			Value:  "ipv4",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_IP_SOURCE",
+			Name:   "proxmoxve-ip-source",
+			Usage:  "where the IP of the VM is discovered: agent (qemu-guest-agent), dhcp-lease (DHCP of an SDN zone only, Proxmox VE 8.1 and later; not external DHCP on plain bridges) or config (ipconfig0)",
+			Value:  ipSourceAgent,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_IP_CIDR",
+			Name:   "proxmoxve-ip-cidr",
+			Usage:  "only use an IP reported by the guest agent within this subnet, e.g. 10.0.0.0/24 on multi-homed VMs",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_IP_INTERFACE",
+			Name:   "proxmoxve-ip-interface",
+			Usage:  "only use an IP reported by the guest agent on this guest interface, e.g. eth0 (default: the one attached to net0)",
+			Value:  "",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_VM_SHUTDOWN_TIMEOUT",
+			Name:   "proxmoxve-vm-shutdown-timeout",
+			Usage:  "seconds to wait for the guest to shut down via the agent or ACPI on stop before stopping it hard (0 to stop hard right away)",
+			Value:  60,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_KEEP_FAILED_VM",
+			Name:   "proxmoxve-keep-failed-vm",
+			Usage:  "keep the VM if creating the machine fails instead of removing it, for debugging",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_DEBUG_DRIVER",
+			Name:   "proxmoxve-debug-driver",
+			Usage:  "enables debugging in the driver",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_LOG_FORMAT",
+			Name:   "proxmoxve-log-format",
+			Usage:  "format of the driver debug output: text or json (one object per line), passwords and ssh keys are redacted",
+			Value:  logFormatText,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_TASK_TIMEOUT",
+			Name:   "proxmoxve-task-timeout",
 			Usage:  "timeout in seconds for each individual creation related task",
-			Value:  300,
+			Value:  defaultTaskTimeout,
 		},
 		mcnflag.IntFlag{
 			EnvVar: "PROXMOXVE_TASK_INTERVAL",
 			Name:   "proxmoxve-task-interval",
 			Usage:  "interval in seconds for each individual creation related task",
-			Value:  5,
+			Value:  defaultTaskInterval,
 		},
 	}
+
+	return append(flags, aliasFlags(flags)...)
 }
 
 // DriverName returns the name of the driver
@@ -352,20 +1137,42 @@ func (d *Driver) DriverName() string {
 func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.debug("SetConfigFromFlags called")
 
+	// deprecated flags of the upstream driver and defaults from the config file (if any)
+	flags, err := d.loadConfigFile(d.withFlagAliases(flags))
+	if err != nil {
+		return err
+	}
+
 	// PROXMOX API Connection settings
 	d.Host = flags.String("proxmoxve-proxmox-host")
+	d.URL = flags.String("proxmoxve-proxmox-url")
 	d.Port = flags.String("proxmoxve-proxmox-port")
 	if len(d.Port) == 0 {
 		d.Port = "8006"
 	}
 	d.Node = flags.String("proxmoxve-proxmox-node")
-	if len(d.Node) == 0 {
-		d.Node = d.Host
-	}
+	d.NodeCandidates = flags.StringSlice("proxmoxve-proxmox-nodes")
+	d.PlacementPolicy = strings.ToLower(flags.String("proxmoxve-proxmox-placement-policy"))
+	d.MemoryOvercommit = flags.String("proxmoxve-proxmox-memory-overcommit")
+	d.CPUOvercommit = flags.String("proxmoxve-proxmox-cpu-overcommit")
 	d.User = flags.String("proxmoxve-proxmox-user-name")
 	d.Password = flags.String("proxmoxve-proxmox-user-password")
 	d.Realm = flags.String("proxmoxve-proxmox-realm")
-	d.Pool = flags.String("proxmoxve-proxmox-pool")
+	d.Headers = flags.StringSlice("proxmoxve-proxmox-header")
+	d.InsecureTLS = flags.Bool("proxmoxve-proxmox-insecure-tls")
+	d.CAFile = flags.String("proxmoxve-proxmox-ca-file")
+	d.APIRetries = flags.Int("proxmoxve-proxmox-retries")
+	d.APIRetryBackoff = flags.Int("proxmoxve-proxmox-retry-backoff")
+	if i := strings.LastIndex(d.User, "@"); i > 0 {
+		// user@realm as used by all other Proxmox VE tools
+		d.User, d.Realm = d.User[:i], d.User[i+1:]
+	}
+	d.Pool = strings.Trim(flags.String("proxmoxve-proxmox-pool"), "/")
+	d.PoolCreate = flags.Bool("proxmoxve-proxmox-pool-create")
+	d.RancherCluster = flags.String("proxmoxve-rancher-cluster")
+	d.RancherNodePool = flags.String("proxmoxve-rancher-node-pool")
+	d.LookupTag = sanitizeTag(flags.String("proxmoxve-vm-lookup-tag"))
+	d.DescriptionTemplate = flags.String("proxmoxve-vm-description-template")
 
 	// VM configuration
 	d.DiskSize = flags.String("proxmoxve-vm-storage-size")
@@ -373,46 +1180,153 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.StorageType = strings.ToLower(flags.String("proxmoxve-vm-storage-type"))
 	d.Memory = flags.Int("proxmoxve-vm-memory")
 	d.Memory *= 1024
+	d.MemoryBalloon = flags.String("proxmoxve-vm-memory-balloon")
+	d.MemoryShares = flags.String("proxmoxve-vm-memory-shares")
 	d.VMIDRange = flags.String("proxmoxve-vm-vmid-range")
+	d.VMIDRetries = flags.Int("proxmoxve-vm-vmid-retries")
 	d.CloneVMID = flags.String("proxmoxve-vm-clone-vmid")
+	d.CloneName = flags.String("proxmoxve-vm-clone-name")
+	d.CloneSnapshot = flags.String("proxmoxve-vm-clone-snapshot")
+	d.ExistingVMID = flags.String("proxmoxve-vm-existing-vmid")
+	d.ExistingRemove = flags.Bool("proxmoxve-vm-existing-remove")
+	d.CloneFullMode = strings.ToLower(flags.String("proxmoxve-vm-clone-full"))
+	d.CloneBWLimit = flags.Int("proxmoxve-vm-clone-bwlimit")
+	d.CloneArchMap = flags.StringSlice("proxmoxve-vm-clone-arch-map")
+	d.Arch = flags.String("proxmoxve-vm-arch")
+	d.ArchEmulate = flags.Bool("proxmoxve-vm-arch-emulate")
+	d.VMNameTemplate = flags.String("proxmoxve-vm-name-template")
+	d.CloudInitDriveAdd = flags.Bool("proxmoxve-vm-cloud-init-drive-add")
+	d.EjectMedia = flags.Bool("proxmoxve-vm-eject-media")
+	d.CloneMinimal = flags.Bool("proxmoxve-vm-clone-minimal")
+	d.Timezone = flags.String("proxmoxve-vm-timezone")
+	d.CloudInitIP = flags.String("proxmoxve-vm-cloud-init-ip")
+	d.CloudInitGateway = flags.String("proxmoxve-vm-cloud-init-gateway")
+	d.CloudInitNetmask = flags.String("proxmoxve-vm-cloud-init-netmask")
+	d.Nameserver = flags.String("proxmoxve-vm-nameserver")
+	d.CIUser = flags.String("proxmoxve-vm-ci-user")
+	d.CIPassword = flags.String("proxmoxve-vm-ci-password")
+	d.Searchdomain = flags.String("proxmoxve-vm-searchdomain")
+	d.CloudInitUserData = flags.String("proxmoxve-vm-cloud-init-user-data")
+	d.CloudInitNetworkConfig = flags.String("proxmoxve-vm-cloud-init-network-config")
+	d.Citype = flags.String("proxmoxve-vm-citype")
 	d.Onboot = flags.String("proxmoxve-vm-start-onboot")
+	d.KVM = flags.String("proxmoxve-vm-kvm")
+	d.Autostart = flags.String("proxmoxve-vm-autostart")
 	d.Protection = flags.String("proxmoxve-vm-protection")
+	d.ProtectionOverride = flags.Bool("proxmoxve-vm-protection-override")
+	d.RemoveBackup = flags.String("proxmoxve-remove-backup")
+	d.GoldenSnapshot = flags.String("proxmoxve-vm-golden-snapshot")
+	d.HAGroup = flags.String("proxmoxve-vm-ha-group")
+	d.HAState = strings.ToLower(flags.String("proxmoxve-vm-ha-state"))
 	d.ImageFile = flags.String("proxmoxve-vm-image-file")
+	d.CloudImageURL = flags.String("proxmoxve-vm-cloud-image-url")
+	d.CloudImageStorage = flags.String("proxmoxve-vm-cloud-image-storage")
+	d.CloudImageChecksum = flags.String("proxmoxve-vm-cloud-image-checksum")
 	d.CPUSockets = flags.String("proxmoxve-vm-cpu-sockets")
 	d.CPU = flags.String("proxmoxve-vm-cpu")
 	d.CPUCores = flags.String("proxmoxve-vm-cpu-cores")
+	d.CPULimit = flags.String("proxmoxve-vm-cpu-limit")
+	d.BIOS = strings.ToLower(flags.String("proxmoxve-vm-bios"))
+	d.MachineType = strings.ToLower(flags.String("proxmoxve-vm-machine-type"))
+	d.CPUUnits = flags.String("proxmoxve-vm-cpu-units")
+	d.VCPUs = flags.String("proxmoxve-vm-vcpus")
 	d.NetModel = flags.String("proxmoxve-vm-net-model")
 	d.NetFirewall = flags.String("proxmoxve-vm-net-firewall")
 	d.NetMtu = flags.String("proxmoxve-vm-net-mtu")
+	d.FirewallEnable = flags.String("proxmoxve-vm-firewall-enable")
+	d.FirewallPolicyIn = flags.String("proxmoxve-vm-firewall-policy-in")
+	d.FirewallPolicyOut = flags.String("proxmoxve-vm-firewall-policy-out")
+	d.FirewallLogLevelIn = flags.String("proxmoxve-vm-firewall-log-level-in")
+	d.FirewallLogLevelOut = flags.String("proxmoxve-vm-firewall-log-level-out")
+	d.FirewallMacFilter = flags.String("proxmoxve-vm-firewall-macfilter")
 	d.NetBridge = flags.String("proxmoxve-vm-net-bridge")
 	d.NetVlanTag = flags.Int("proxmoxve-vm-net-tag")
 	d.HostPci0 = flags.String("proxmoxve-vm-hostpci0")
+	d.HostPCI = flags.StringSlice("proxmoxve-vm-hostpci")
 	d.ScsiController = flags.String("proxmoxve-vm-scsi-controller")
 	d.ScsiAttributes = flags.String("proxmoxve-vm-scsi-attributes")
+	d.DiskCache = strings.ToLower(flags.String("proxmoxve-vm-disk-cache"))
+	d.DiskDiscard = strings.ToLower(flags.String("proxmoxve-vm-disk-discard"))
+	d.DiskIOThread = flags.String("proxmoxve-vm-disk-iothread")
+	d.DiskSSD = flags.String("proxmoxve-vm-disk-ssd")
+	d.ResizeDevice = flags.String("proxmoxve-vm-resize-disk")
+	d.ExtraDisks = flags.StringSlice("proxmoxve-vm-extra-disk")
+	d.DiskMBpsRd = flags.String("proxmoxve-vm-disk-mbps-rd")
+	d.DiskMBpsWr = flags.String("proxmoxve-vm-disk-mbps-wr")
+	d.DiskIOPSRd = flags.String("proxmoxve-vm-disk-iops-rd")
+	d.DiskIOPSWr = flags.String("proxmoxve-vm-disk-iops-wr")
 	d.driverDebug = flags.Bool("proxmoxve-debug-driver")
+	d.LogFormat = strings.ToLower(flags.String("proxmoxve-log-format"))
+	d.keepFailedVM = flags.Bool("proxmoxve-keep-failed-vm")
 
 	//SSH connection settings
 	d.GuestSSHPort = flags.Int("proxmoxve-ssh-port")
 	d.GuestUsername = flags.String("proxmoxve-ssh-username")
 	d.GuestPassword = flags.String("proxmoxve-ssh-password")
+	d.SSHKeysReplace = flags.Bool("proxmoxve-ssh-keys-replace")
+	d.SSHExtraKeys = flags.StringSlice("proxmoxve-ssh-extra-key")
+	d.SSHKeySource = flags.String("proxmoxve-ssh-keypath")
+	d.NodeForward = flags.Bool("proxmoxve-node-forward")
+	d.NodeForwardPortBase = flags.Int("proxmoxve-node-forward-port-base")
+	d.NodeForwardSSHUser = flags.String("proxmoxve-node-forward-ssh-user")
+	d.NodeForwardSSHKey = flags.String("proxmoxve-node-forward-ssh-key")
+	d.NodeForwardKnownHosts = flags.String("proxmoxve-node-forward-known-hosts")
+	if len(d.GuestUsername) == 0 {
+		d.GuestUsername = d.CIUser
+	}
+	d.IPStablePolls = flags.Int("proxmoxve-ip-stable-polls")
+	d.IPProtocol = strings.ToLower(flags.String("proxmoxve-vm-ip-protocol"))
+	d.IPSource = strings.ToLower(flags.String("proxmoxve-ip-source"))
+	d.IPCIDR = flags.String("proxmoxve-ip-cidr")
+	d.IPInterface = flags.String("proxmoxve-ip-interface")
+	d.ShutdownTimeout = flags.Int("proxmoxve-vm-shutdown-timeout")
+	d.WebhookURL = flags.String("proxmoxve-webhook-url")
+	d.WebhookTemplate = flags.String("proxmoxve-webhook-template")
+	d.WebhookEvents = flags.StringSlice("proxmoxve-webhook-events")
+	d.GuestFiles = flags.StringSlice("proxmoxve-vm-guest-file")
+	d.GuestExec = flags.StringSlice("proxmoxve-vm-guest-exec")
+	d.Bootstrap = flags.Bool("proxmoxve-vm-bootstrap")
+	d.CloudInitWait = flags.Bool("proxmoxve-vm-cloud-init-wait")
+	d.EnginePort = flags.Int("proxmoxve-engine-port")
+	d.EngineWait = flags.Int("proxmoxve-engine-wait")
 
 	// Task timeout
-	d.taskTimeout = time.Duration(flags.Int("proxmoxve-task-timeout")) * time.Second
-	d.taskInterval = time.Duration(flags.Int("proxmoxve-task-interval")) * time.Second
+	d.TaskTimeout = flags.Int("proxmoxve-task-timeout")
+	d.TaskInterval = flags.Int("proxmoxve-task-interval")
+	d.normalize()
 
 	return nil
 }
 
 // GetURL returns the URL for the target docker daemon
 func (d *Driver) GetURL() (string, error) {
-	ip, err := d.GetIP()
-	if err != nil {
+	address, err := d.engineURLAddress()
+	if err != nil || address == "" {
 		return "", err
 	}
-	if ip == "" {
-		return "", nil
+	return fmt.Sprintf("tcp://%s", address), nil
+}
+
+// engineURLAddress returns host:port the docker daemon is reached at, empty
+// if the VM has no IP yet
+func (d *Driver) engineURLAddress() (string, error) {
+	if d.NodeForward {
+		host, err := d.ensureForward()
+		if err != nil || host == "" {
+			return "", err
+		}
+		_, enginePort, err := d.forwardedPorts()
+		if err != nil {
+			return "", err
+		}
+		return net.JoinHostPort(host, strconv.Itoa(enginePort)), nil
+	}
+
+	ip, err := d.GetIP()
+	if err != nil || ip == "" {
+		return "", err
 	}
-	return fmt.Sprintf("tcp://%s:2376", ip), nil
+	return d.engineAddress(ip), nil
 }
 
 // GetMachineName returns the machine name
@@ -430,14 +1344,22 @@ func (d *Driver) GetNetVlanTag() int {
 	return d.NetVlanTag
 }
 
-func (d *Driver) GetNode(nodeName string) (*proxmox.Node, error) {
+// connect connects to the api unless already connected
+func (d *Driver) connect() error {
 	if d.client == nil {
 		client, err := d.connectApi()
 		if err != nil {
-			return nil, err
+			return err
 		}
 		d.client = client
 	}
+	return nil
+}
+
+func (d *Driver) GetNode(nodeName string) (*proxmox.Node, error) {
+	if err := d.connect(); err != nil {
+		return nil, err
+	}
 
 	n, err := d.client.Node(context.Background(), nodeName)
 	if err != nil {
@@ -447,24 +1369,44 @@ func (d *Driver) GetNode(nodeName string) (*proxmox.Node, error) {
 }
 
 func (d *Driver) ConfigureVM(name string, value string) error {
-	d.debugf("ConfigureVM: %s %s", name, value)
+	return d.configureVMOptions(proxmox.VirtualMachineOption{Name: name, Value: value})
+}
+
+// configureVMOptions sets the options of the VM in one config task. Options
+// with an empty value are left as they are, so flags which weren't given
+// don't overwrite the values of the template.
+func (d *Driver) configureVMOptions(options ...proxmox.VirtualMachineOption) error {
+	var set []proxmox.VirtualMachineOption
+	var names []string
+	for _, option := range options {
+		if value, ok := option.Value.(string); ok && len(value) == 0 {
+			continue
+		}
+		if option.Name == "cipassword" {
+			d.debugf("ConfigureVM: %s ********", option.Name)
+		} else {
+			d.debugf("ConfigureVM: %s %v", option.Name, option.Value)
+		}
+		set = append(set, option)
+		names = append(names, option.Name)
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
 	vm, err := d.GetVM()
 	if err != nil {
 		return err
 	}
-	var config proxmox.VirtualMachineOption
-	config.Name = name
-	config.Value = value
-
-	configTask, err2 := vm.Config(context.Background(), config)
 
+	configTask, err2 := vm.Config(context.Background(), set...)
 	if err2 != nil {
-		return err2
+		return fmt.Errorf("unable to set %s of VM %d: %w", strings.Join(names, ", "), d.VMID, err2)
 	}
 
 	// wait for the config task
 	if err4 := configTask.Wait(context.Background(), d.taskInterval, d.taskTimeout); err4 != nil {
-		return err4
+		return fmt.Errorf("unable to set %s of VM %d: %w", strings.Join(names, ", "), d.VMID, err4)
 	}
 
 	d.debugf("Config task finished")
@@ -500,16 +1442,6 @@ func (d *Driver) OperateVM(operation string) error {
 		if err3 := task.Wait(context.Background(), d.taskInterval, d.taskTimeout); err3 != nil {
 			return err3
 		}
-	case "kill":
-		task, err2 := vm.Stop(context.Background())
-		log.Debug(task.ID)
-		if err2 != nil {
-			return err2
-		}
-		// wait for the task
-		if err3 := task.Wait(context.Background(), d.taskInterval, d.taskTimeout); err3 != nil {
-			return err3
-		}
 	case "restart":
 		task, err2 := vm.Reset(context.Background())
 		log.Debug(task.ID)
@@ -531,7 +1463,9 @@ func (d *Driver) OperateVM(operation string) error {
 func (d *Driver) GetVM() (*proxmox.VirtualMachine, error) {
 	d.debugf("GetVM issued")
 	if d.VMID < 1 {
-		return nil, errors.New("invalid VMID")
+		if err := d.recoverVMID(); err != nil {
+			return nil, fmt.Errorf("invalid VMID: %w", err)
+		}
 	}
 
 	n, err := d.GetNode(d.Node)
@@ -543,46 +1477,128 @@ func (d *Driver) GetVM() (*proxmox.VirtualMachine, error) {
 	if err2 != nil {
 		return nil, err2
 	}
-	d.debugf("GetVM returned VMID: '%s' with Status: '%s'", vm.VMID, vm.Status)
+	d.debugf("GetVM returned VMID: '%v' with Status: '%s'", vm.VMID, vm.Status)
 	return vm, err
 }
 
-// GetIP returns the ip
+// GetIP returns the ip, using the static address if configured or the cached
+// address as long as it is still reachable
 func (d *Driver) GetIP() (string, error) {
+	if d.staticIP() {
+		ip, _, err := d.staticIPAddress()
+		if err != nil {
+			return "", err
+		}
+		d.IPAddress = ip.String()
+		return d.IPAddress, nil
+	}
+
+	if d.IPAddress != "" && d.isReachable(d.IPAddress) {
+		d.debugf("using cached IP address %s", d.IPAddress)
+		return d.IPAddress, nil
+	}
+
+	return d.discoverIP()
+}
+
+// isReachable checks whether the guest ssh port answers on the given ip
+func (d *Driver) isReachable(ip string) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(d.GuestSSHPort)), ipProbeTimeout)
+	if err != nil {
+		d.debugf("IP address %s is not reachable: %s", ip, err)
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// agentIP asks the guest agent for the ip of the interface attached to net0
+func (d *Driver) agentIP() (string, error) {
 	vm, err := d.GetVM()
+	if err != nil {
+		return "", err
+	}
 
 	if err := vm.WaitForAgent(context.Background(), int(d.taskTimeout.Seconds())); err != nil {
-		return "", err
+		return "", d.agentError(err)
 	}
-	net := vm.VirtualMachineConfig.Net0
+	net0 := vm.VirtualMachineConfig.Net0
 	iFaces, err3 := vm.AgentGetNetworkIFaces(context.Background())
 	if err3 != nil {
 		return "", err3
 	}
-	for _, iface := range iFaces {
-		if strings.Contains(strings.ToLower(net), strings.ToLower(iface.HardwareAddress)) {
-			for _, ip := range iface.IPAddresses {
-				if ip.IPAddressType == "ipv4" {
-					d.IPAddress = ip.IPAddress
-				}
-			}
+
+	filter, err := d.ipFilter()
+	if err != nil {
+		return "", err
+	}
+	ipAddress, macAddress := selectInterface(iFaces, net0, d.IPProtocol, filter)
+	if ipAddress == "" {
+		return "", nil
+	}
+
+	if ipAddress != d.IPAddress {
+		d.debugf("discovered IP address %s on %s (was: '%s')", ipAddress, macAddress, d.IPAddress)
+	}
+	d.IPAddress = ipAddress
+	d.MACAddress = macAddress
+
+	return d.IPAddress, nil
+}
+
+// agentError explains why the guest agent did not answer in time
+func (d *Driver) agentError(err error) error {
+	config, configErr := d.getVMConfig(d.Node, d.VMID)
+	if configErr == nil && !agentEnabled(fmt.Sprint(config["agent"])) {
+		return fmt.Errorf("qemu-guest-agent is not enabled for VM %d (agent: '%v'), enable it with agent=1 on the template: %w", d.VMID, config["agent"], err)
+	}
+
+	if d.MACAddress != "" {
+		return fmt.Errorf("qemu-guest-agent of VM %d answered before but stopped responding: %w", d.VMID, err)
+	}
+
+	return fmt.Errorf("VM %d never answered via qemu-guest-agent within %s: the template likely lacks qemu-guest-agent, install it in the template or use a static IP or --proxmoxve-ip-source dhcp-lease or config: %w", d.VMID, d.taskTimeout, err)
+}
+
+// agentEnabled parses the agent option of a VM config, e.g. "1" or "enabled=1,fstrim_cloned_disks=1"
+func agentEnabled(agent string) bool {
+	for _, option := range strings.Split(agent, ",") {
+		switch strings.TrimPrefix(option, "enabled=") {
+		case "1", "true", "yes", "on":
+			return true
 		}
 	}
+	return false
+}
 
-	if d.IPAddress == "" {
-		return "", err
+// getVMConfig returns the raw config of a VM
+func (d *Driver) getVMConfig(node string, vmid int) (map[string]interface{}, error) {
+	if err := d.connect(); err != nil {
+		return nil, err
 	}
 
-	return d.IPAddress, err
+	var config map[string]interface{}
+	if err := d.client.Get(context.Background(), fmt.Sprintf("/nodes/%s/qemu/%d/config", node, vmid), &config); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
 // GetSSHHostname returns the ssh host returned by the API
 func (d *Driver) GetSSHHostname() (string, error) {
+	if d.NodeForward {
+		return d.ensureForward()
+	}
 	return d.GetIP()
 }
 
-// GetSSHPort returns the ssh port, 22 if not specified
+// GetSSHPort returns the ssh port, 22 if not specified, or the node port
+// forwarded to it
 func (d *Driver) GetSSHPort() (int, error) {
+	if d.NodeForward {
+		sshPort, _, err := d.forwardedPorts()
+		return sshPort, err
+	}
 	return d.GuestSSHPort, nil
 }
 
@@ -591,6 +1607,45 @@ func (d *Driver) GetSSHUsername() string {
 	return d.GuestUsername
 }
 
+// liveLocks are locks of operations the VM keeps running through
+var liveLocks = map[string]bool{"backup": true, "snapshot": true, "snapshot-delete": true, "migrate": true}
+
+// vmState maps the status, qmp status and lock of a VM to the machine state
+func vmState(status, qmpStatus, lock string) state.State {
+	switch lock {
+	case "":
+	case "suspended":
+		// hibernated to disk
+		return state.Saved
+	case "suspending":
+		return state.Stopping
+	default:
+		if !liveLocks[lock] {
+			// being created, cloned or rolled back, or left locked by a failed task
+			return state.Error
+		}
+	}
+
+	if status == "stopped" {
+		return state.Stopped
+	}
+	switch qmpStatus {
+	case "", "running":
+		if status == "running" {
+			return state.Running
+		}
+	case "paused", "suspended":
+		return state.Paused
+	case "prelaunch", "inmigrate", "postmigrate", "finish-migrate", "restore-vm":
+		return state.Starting
+	case "shutdown", "save-vm":
+		return state.Stopping
+	case "io-error", "internal-error", "guest-panicked":
+		return state.Error
+	}
+	return state.None
+}
+
 // GetState returns the state of the VM
 func (d *Driver) GetState() (state.State, error) {
 	vm, err := d.GetVM()
@@ -602,155 +1657,812 @@ func (d *Driver) GetState() (state.State, error) {
 		return state.None, err
 	}
 
-	if vm.IsStopped() {
-		return state.Stopped, nil
-	}
-
-	if vm.IsRunning() {
-		return state.Running, nil
-	}
-
-	return state.None, nil
+	st := vmState(vm.Status, vm.QMPStatus, vm.Lock)
+	d.debugf("VM %d is %s (status: '%s', qmpstatus: '%s', lock: '%s')", d.VMID, st, vm.Status, vm.QMPStatus, vm.Lock)
+	return st, nil
 }
 
 // PreCreateCheck is called to enforce pre-creation steps
 func (d *Driver) PreCreateCheck() error {
+	problems := d.validateFlags()
 
-	if d.client == nil {
-		client, err := d.connectApi()
-		if err != nil {
-			return err
-		}
-		d.client = client
+	if err := d.connect(); err != nil {
+		// nothing else can be checked without the API
+		return validationError(append(problems, "proxmoxve-proxmox-host: "+err.Error()))
 	}
 
-	return nil
-}
-
-// Create creates a new VM with storage
-func (d *Driver) Create() error {
-
-	newId, err6 := d.GetVmidInRange()
-	if err6 != nil {
-		return err6
+	if d.adopting() {
+		// the VM exists already, its node, storage and network are as they are
+		problems = append(problems, d.validateExistingVM()...)
+		problems = append(problems, d.validatePermissions()...)
+		if len(problems) > 0 {
+			return validationError(problems)
+		}
+		return nil
 	}
 
-	clone := &proxmox.VirtualMachineCloneOptions{
-		Name:    d.MachineName,
-		Full:    1,
-		Pool:    d.Pool,
-		Format:  d.StorageType,
-		Storage: d.Storage,
-		NewID:   newId,
+	if err := d.selectNode(); err != nil {
+		return validationError(append(problems, "proxmoxve-proxmox-nodes: "+err.Error()))
 	}
-
-	d.debugf("cloning new vm from template id '%s'", d.CloneVMID)
-
-	node, err := d.client.Node(context.Background(), d.Node)
-	if err != nil {
-		return err
+	if !d.nodeAutoSelect() {
+		if err := d.checkCapacity(); err != nil {
+			problems = append(problems, "proxmoxve-proxmox-node: "+err.Error())
+		}
 	}
-
-	cloneVmId, err := strconv.Atoi(d.CloneVMID)
-	if err != nil {
-		return err
+	if err := d.resolveCloneSource(); err != nil {
+		if len(d.Arch) > 0 {
+			problems = append(problems, "proxmoxve-vm-arch: "+err.Error())
+		} else {
+			problems = append(problems, "proxmoxve-vm-clone-name: "+err.Error())
+		}
 	}
 
-	clonevm, err := node.VirtualMachine(context.Background(), cloneVmId)
-	if err != nil {
-		return err
+	if applied, err := d.applyTemplateNotes(); err != nil {
+		problems = append(problems, "proxmoxve-vm-clone-vmid: "+err.Error())
+	} else if applied {
+		// validate the defaults taken from the template as well
+		known := make(map[string]bool)
+		for _, p := range problems {
+			known[p] = true
+		}
+		for _, p := range d.validateFlags() {
+			if !known[p] {
+				problems = append(problems, p)
+			}
+		}
+	}
+	problems = append(problems, d.validateCloneSource()...)
+	problems = append(problems, d.validateStorage()...)
+	problems = append(problems, d.validateBridge()...)
+	problems = append(problems, d.validateVersion()...)
+	problems = append(problems, d.validatePermissions()...)
+
+	if len(d.ImageFile) > 0 {
+		problems = append(problems, d.validateVolume("proxmoxve-vm-image-file", d.ImageFile, "iso")...)
+	}
+	if len(d.CloudImageURL) > 0 {
+		problems = append(problems, d.validateCloudImage()...)
 	}
 
-	_, task, err := clonevm.Clone(context.Background(), clone)
-	d.debugf("clone task for new vmid '%d' created", newId)
+	problems = append(problems, d.validateHAGroup()...)
+	problems = append(problems, d.validateRemoveBackup()...)
 
-	if err != nil {
-		return err
+	if len(d.Pool) > 0 && !d.PoolCreate {
+		if missing, err := d.missingPools(); err != nil {
+			problems = append(problems, fmt.Sprintf("proxmoxve-proxmox-pool: unable to list pools: %s", err))
+		} else if len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("proxmoxve-proxmox-pool: pool '%s' does not exist, create it or use --proxmoxve-proxmox-pool-create", missing[0]))
+		}
 	}
 
-	// wait for the clone task
-	if err := task.Wait(context.Background(), d.taskInterval, d.taskTimeout); err != nil {
-		return err
+	if len(problems) > 0 {
+		return validationError(problems)
 	}
-	d.debugf("clone finished for vmid '%d'", newId)
 
-	// explicity set vmid after clone completion to be sure
-	d.VMID = newId
+	return nil
+}
 
-	d.debugf("vmid values VMID: '%d'", d.VMID)
+var timezonePattern = regexp.MustCompile(`^[A-Za-z0-9_+-]+(/[A-Za-z0-9_+-]+)*$`)
 
-	// resize
-	d.debugf("resizing disk '%s' on vmid '%s' to '%s'", "scsi0", d.VMID, d.DiskSize+"G")
+// validationError lists all problems found in the driver configuration
+type validationError []string
 
-	vm, err4 := d.GetVM()
-	if err4 != nil {
-		return err4
+func (e validationError) Error() string {
+	return "invalid driver configuration:\n  - " + strings.Join(e, "\n  - ")
+}
+
+// validateFlags checks the format of all options without contacting the api
+func (d *Driver) validateFlags() []string {
+	var problems []string
+	check := func(ok bool, format string, v ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, v...))
+		}
 	}
-	err5 := vm.ResizeDisk(context.Background(), "scsi0", d.DiskSize+"G")
-	if err5 != nil {
-		return err5
+	isFlag := func(v string) bool {
+		return v == "" || v == "0" || v == "1"
 	}
-
-	d.debugf("add misc configuration options")
-
-	d.ConfigureVM("agent", "1")
-	d.ConfigureVM("autostart", "1")
-	d.ConfigureVM("memory", fmt.Sprint(d.Memory))
-	d.ConfigureVM("sockets", d.CPUSockets)
-	d.ConfigureVM("cores", d.CPUCores)
-	d.ConfigureVM("kvm", "1")
-	d.ConfigureVM("citype", d.Citype)
-	d.ConfigureVM("onboot", d.Onboot)
-	d.ConfigureVM("protection", d.Protection)
-
-	if len(d.HostPci0) > 0 {
-		d.ConfigureVM("hostpci0", d.HostPci0)
+	isNumber := func(v string) bool {
+		_, err := strconv.Atoi(v)
+		return err == nil
 	}
 
-	if len(d.NetBridge) > 0 {
-		d.ConfigureVM("net0", d.generateNetString())
+	check(isFlag(d.Onboot), "proxmoxve-vm-start-onboot must be 0 or 1, got '%s'", d.Onboot)
+	check(isFlag(d.KVM), "proxmoxve-vm-kvm must be 0 or 1, got '%s'", d.KVM)
+	check(d.KVM != "1" || !d.ArchEmulate, "proxmoxve-vm-kvm can't be 1 with proxmoxve-vm-arch-emulate")
+	check(isFlag(d.Autostart), "proxmoxve-vm-autostart must be 0 or 1, got '%s'", d.Autostart)
+	check(isFlag(d.Protection), "proxmoxve-vm-protection must be 0 or 1, got '%s'", d.Protection)
+	check(!d.CloneMinimal || d.Protection == "", "proxmoxve-vm-protection can't be set with proxmoxve-vm-clone-minimal, which keeps the protection of the template")
+	problems = append(problems, validateHAState(d.HAState)...)
+	check(isFlag(d.NetFirewall), "proxmoxve-vm-net-firewall must be 0 or 1, got '%s'", d.NetFirewall)
+	check(isFlag(d.CloneFullMode) || d.CloneFullMode == "auto", "proxmoxve-vm-clone-full must be 0, 1 or auto, got '%s'", d.CloneFullMode)
+	check(d.CloneBWLimit >= 0, "proxmoxve-vm-clone-bwlimit must not be negative, got '%d'", d.CloneBWLimit)
+	problems = append(problems, validateCloneSnapshot(d.CloneSnapshot)...)
+	problems = append(problems, validateCloudImageChecksum(d.CloudImageChecksum)...)
+	check(d.GoldenSnapshot == "" || validSnapshotName(d.GoldenSnapshot), "proxmoxve-vm-golden-snapshot must be a snapshot name like provisioned, got '%s'", d.GoldenSnapshot)
+	problems = append(problems, d.validateFirewall()...)
+
+	size, err := strconv.Atoi(d.DiskSize)
+	check(err == nil && size > 0, "proxmoxve-vm-storage-size must be a positive number of GB, got '%s'", d.DiskSize)
+	check(d.Memory > 0, "proxmoxve-vm-memory must be positive, got '%d'", d.Memory/1024)
+	if len(d.MemoryBalloon) > 0 {
+		balloon, err := strconv.Atoi(d.MemoryBalloon)
+		check(err == nil && balloon >= 0 && balloon*1024 <= d.Memory, "proxmoxve-vm-memory-balloon must be between 0 and proxmoxve-vm-memory, got '%s'", d.MemoryBalloon)
 	}
-
-	if len(d.NUMA) > 0 {
-		d.ConfigureVM("numa", d.NUMA)
+	if len(d.MemoryShares) > 0 {
+		shares, err := strconv.Atoi(d.MemoryShares)
+		check(err == nil && shares >= 0 && shares <= 50000, "proxmoxve-vm-memory-shares must be between 0 and 50000, got '%s'", d.MemoryShares)
+		check(d.MemoryBalloon != "0", "proxmoxve-vm-memory-shares requires ballooning, but proxmoxve-vm-memory-balloon is 0")
 	}
-
-	if len(d.CPU) > 0 {
-		d.ConfigureVM("cpu", d.CPU)
+	if d.CloneMinimal {
+		for _, option := range [][2]string{
+			{"proxmoxve-vm-cpu-sockets", d.CPUSockets}, {"proxmoxve-vm-cpu-cores", d.CPUCores}, {"proxmoxve-vm-cpu", d.CPU},
+			{"proxmoxve-vm-cpu-limit", d.CPULimit}, {"proxmoxve-vm-cpu-units", d.CPUUnits}, {"proxmoxve-vm-vcpus", d.VCPUs},
+			{"proxmoxve-vm-numa", d.NUMA}, {"proxmoxve-vm-memory-balloon", d.MemoryBalloon}, {"proxmoxve-vm-memory-shares", d.MemoryShares},
+		} {
+			check(option[1] == "", "%s can't be set with proxmoxve-vm-clone-minimal, which keeps memory and cpus of the template", option[0])
+		}
+		for _, option := range [][2]string{
+			{"proxmoxve-rancher-cluster", d.RancherCluster}, {"proxmoxve-rancher-node-pool", d.RancherNodePool},
+			{"proxmoxve-vm-net-bridge", d.NetBridge}, {"proxmoxve-vm-nameserver", d.Nameserver}, {"proxmoxve-vm-searchdomain", d.Searchdomain},
+			{"proxmoxve-vm-ci-user", d.CIUser}, {"proxmoxve-vm-ci-password", d.CIPassword}, {"proxmoxve-vm-cloud-init-ip", d.CloudInitIP},
+			{"proxmoxve-vm-scsi-controller", d.ScsiController}, {"proxmoxve-vm-scsi-attributes", d.ScsiAttributes},
+			{"proxmoxve-vm-disk-cache", d.DiskCache}, {"proxmoxve-vm-disk-discard", d.DiskDiscard},
+			{"proxmoxve-vm-disk-iothread", d.DiskIOThread}, {"proxmoxve-vm-disk-ssd", d.DiskSSD},
+			{"proxmoxve-vm-disk-mbps-rd", d.DiskMBpsRd}, {"proxmoxve-vm-disk-mbps-wr", d.DiskMBpsWr},
+			{"proxmoxve-vm-disk-iops-rd", d.DiskIOPSRd}, {"proxmoxve-vm-disk-iops-wr", d.DiskIOPSWr},
+		} {
+			check(option[1] == "", "%s can't be set with proxmoxve-vm-clone-minimal, which doesn't write the config of the clone", option[0])
+		}
+		check(!d.CloudInitDriveAdd, "proxmoxve-vm-cloud-init-drive-add can't be set with proxmoxve-vm-clone-minimal, which doesn't write the config of the clone")
 	}
-
-	// append newly minted ssh key to existing (if any)
-	SSHKeys, err2 := d.appendVmSshKeys(vm)
-	if err2 != nil {
-		return err2
+	check(d.CPUSockets == "" || isNumber(d.CPUSockets), "proxmoxve-vm-cpu-sockets must be numeric, got '%s'", d.CPUSockets)
+	check(d.CPUCores == "" || isNumber(d.CPUCores), "proxmoxve-vm-cpu-cores must be numeric, got '%s'", d.CPUCores)
+	check(d.BIOS == "" || d.BIOS == "seabios" || d.BIOS == "ovmf", "proxmoxve-vm-bios must be seabios or ovmf, got '%s'", d.BIOS)
+	check(d.BIOS == "" || d.BIOS == "ovmf" || !d.isARM(), "proxmoxve-vm-bios must be ovmf for arm64 VMs, got '%s'", d.BIOS)
+	problems = append(problems, d.validateHostPCIDevices()...)
+	problems = append(problems, d.validateDiskOptions()...)
+	problems = append(problems, d.validateThrottleOptions()...)
+	check(d.ResizeDevice == "" || isDisk(d.ResizeDevice), "proxmoxve-vm-resize-disk must be a disk device like scsi0, got '%s'", d.ResizeDevice)
+	for _, disk := range d.ExtraDisks {
+		if _, _, err := parseExtraDisk(disk); err != nil {
+			problems = append(problems, "proxmoxve-vm-extra-disk: "+err.Error())
+		}
 	}
-
-	err3 := d.ConfigureVM("sshkeys", SSHKeys)
-	d.debugf("cloud-init sshkeys set to '%s'", SSHKeys)
-	if err3 != nil {
-		return err3
+	problems = append(problems, d.validateMachineType()...)
+	if len(d.CPULimit) > 0 {
+		limit, err := strconv.ParseFloat(d.CPULimit, 64)
+		check(err == nil && limit >= 0 && limit <= 128, "proxmoxve-vm-cpu-limit must be between 0 and 128, got '%s'", d.CPULimit)
 	}
-
-	// start the VM
-	err = d.Start()
-	if err != nil {
-		return err
+	if len(d.CPUUnits) > 0 {
+		units, err := strconv.Atoi(d.CPUUnits)
+		check(err == nil && units >= 1 && units <= 262144, "proxmoxve-vm-cpu-units must be between 1 and 262144, got '%s'", d.CPUUnits)
 	}
-
-	// wait for the agent and get the IPAddress
-	vmIp, err := d.GetIP()
-	if err != nil {
-		return err
+	if len(d.VCPUs) > 0 {
+		vcpus, err := strconv.Atoi(d.VCPUs)
+		check(err == nil && vcpus >= 1, "proxmoxve-vm-vcpus must be a positive number, got '%s'", d.VCPUs)
+		sockets, socketsErr := strconv.Atoi(d.CPUSockets)
+		cores, coresErr := strconv.Atoi(d.CPUCores)
+		if err == nil && socketsErr == nil && coresErr == nil {
+			check(vcpus <= sockets*cores, "proxmoxve-vm-vcpus must not exceed sockets * cores (%d), got '%s'", sockets*cores, d.VCPUs)
+		}
+	}
+	check(d.StorageType == "" || d.StorageType == "qcow2" || d.StorageType == "raw" || d.StorageType == "vmdk",
+		"proxmoxve-vm-storage-type must be qcow2, raw or vmdk, got '%s'", d.StorageType)
+
+	check(d.NetVlanTag >= 0 && d.NetVlanTag < 4095, "proxmoxve-vm-net-tag must be between 0 and 4094, got '%d'", d.NetVlanTag)
+	check(d.NetMtu == "" || isNumber(d.NetMtu), "proxmoxve-vm-net-mtu must be numeric, got '%s'", d.NetMtu)
+	check(d.GuestSSHPort > 0 && d.GuestSSHPort < 65536, "proxmoxve-ssh-port must be between 1 and 65535, got '%d'", d.GuestSSHPort)
+	check(d.EnginePort >= 0 && d.EnginePort < 65536, "proxmoxve-engine-port must be between 1 and 65535, got '%d'", d.EnginePort)
+	check(d.EngineWait >= 0, "proxmoxve-engine-wait must not be negative, got '%d'", d.EngineWait)
+	check(d.IPProtocol == "" || d.IPProtocol == "ipv4" || d.IPProtocol == "ipv6" || d.IPProtocol == "dual",
+		"proxmoxve-vm-ip-protocol must be ipv4, ipv6 or dual, got '%s'", d.IPProtocol)
+	if _, err := d.apiURL(); len(d.URL) > 0 && err != nil {
+		problems = append(problems, "proxmoxve-proxmox-url: "+err.Error())
+	}
+	check(d.LogFormat == "" || d.LogFormat == logFormatText || d.LogFormat == logFormatJSON, "proxmoxve-log-format must be text or json, got '%s'", d.LogFormat)
+	check(d.IPSource == "" || d.IPSource == ipSourceAgent || d.IPSource == ipSourceLease || d.IPSource == ipSourceConfig,
+		"proxmoxve-ip-source must be agent, dhcp-lease or config, got '%s'", d.IPSource)
+	if _, err := d.ipFilter(); err != nil {
+		problems = append(problems, fmt.Sprintf("proxmoxve-ip-cidr must be a subnet like 10.0.0.0/24, got '%s'", d.IPCIDR))
+	}
+	check(d.APIRetries >= 0, "proxmoxve-proxmox-retries must not be negative, got '%d'", d.APIRetries)
+	check(d.APIRetryBackoff >= 0, "proxmoxve-proxmox-retry-backoff must not be negative, got '%d'", d.APIRetryBackoff)
+	check(d.PlacementPolicy == "" || d.PlacementPolicy == placementSpread, "proxmoxve-proxmox-placement-policy must be spread, got '%s'", d.PlacementPolicy)
+	check(d.PlacementPolicy != placementSpread || d.clusterTag() != "", "proxmoxve-proxmox-placement-policy spread requires proxmoxve-rancher-cluster")
+	if _, err := overcommitRatio(d.MemoryOvercommit, defaultMemoryOvercommit); err != nil {
+		problems = append(problems, "proxmoxve-proxmox-memory-overcommit "+err.Error())
 	}
+	if _, err := overcommitRatio(d.CPUOvercommit, defaultCPUOvercommit); err != nil {
+		problems = append(problems, "proxmoxve-proxmox-cpu-overcommit "+err.Error())
+	}
+	check(d.VMIDRetries >= 0, "proxmoxve-vm-vmid-retries must not be negative, got '%d'", d.VMIDRetries)
+	check(d.ShutdownTimeout >= 0, "proxmoxve-vm-shutdown-timeout must not be negative, got '%d'", d.ShutdownTimeout)
+	check(d.IPStablePolls >= 0, "proxmoxve-ip-stable-polls must not be negative, got '%d'", d.IPStablePolls)
+
+	if d.adopting() {
+		check(isNumber(d.ExistingVMID), "proxmoxve-vm-existing-vmid must be numeric, got '%s'", d.ExistingVMID)
+		check(d.CloneVMID == "" && d.CloneName == "" && d.ImageFile == "" && d.CloudImageURL == "" && d.Arch == "",
+			"proxmoxve-vm-existing-vmid can't be combined with proxmoxve-vm-clone-vmid, proxmoxve-vm-clone-name, proxmoxve-vm-image-file, proxmoxve-vm-cloud-image-url or proxmoxve-vm-arch")
+	} else if len(d.Arch) > 0 {
+		if _, err := d.cloneSourceForArch(); err != nil {
+			problems = append(problems, "proxmoxve-vm-clone-arch-map: "+err.Error())
+		}
+		check(d.CloneName == "", "proxmoxve-vm-clone-name can't be combined with proxmoxve-vm-arch, map the template names with --proxmoxve-vm-clone-arch-map")
+	} else if len(d.CloneName) > 0 {
+		check(strings.TrimSuffix(d.CloneName, "*") != "", "proxmoxve-vm-clone-name must be a name or a prefix followed by *, got '%s'", d.CloneName)
+		check(d.ImageFile == "" && d.CloudImageURL == "",
+			"proxmoxve-vm-clone-name can't be combined with proxmoxve-vm-image-file or proxmoxve-vm-cloud-image-url")
+	} else {
+		check(isNumber(d.CloneVMID) || (d.CloneVMID == "" && (d.ImageFile != "" || d.CloudImageURL != "")),
+			"proxmoxve-vm-clone-vmid must be numeric, got '%s' (or use --proxmoxve-vm-image-file or --proxmoxve-vm-cloud-image-url to create the VM from scratch)", d.CloneVMID)
+		check(d.CloneVMID != "" || d.Storage != "", "proxmoxve-vm-storage-path is required to create the VM from an iso or cloud image")
+	}
+	check(d.Timezone == "" || timezonePattern.MatchString(d.Timezone), "proxmoxve-vm-timezone must be a timezone name like Europe/Berlin, got '%s'", d.Timezone)
 
-	d.debugf("VM got an IP: %s", vmIp)
+	problems = append(problems, d.validateStaticIP()...)
+	problems = append(problems, d.validateDNS()...)
+	if len(d.CloudInitUserData) > 0 {
+		if _, err := d.customUserData(); err != nil {
+			problems = append(problems, "proxmoxve-vm-cloud-init-user-data: "+err.Error())
+		}
+	}
+	if d.NodeForward {
+		check(d.NodeForwardPortBase > 0 && d.NodeForwardPortBase < 65535, "proxmoxve-node-forward-port-base must be a port, got %d", d.NodeForwardPortBase)
+		check(len(d.NodeForwardSSHUser) > 0, "proxmoxve-node-forward-ssh-user is required with proxmoxve-node-forward")
+		if len(d.NodeForwardSSHKey) == 0 {
+			problems = append(problems, "proxmoxve-node-forward-ssh-key is required with proxmoxve-node-forward")
+		} else if _, err := os.Stat(d.NodeForwardSSHKey); err != nil {
+			problems = append(problems, "proxmoxve-node-forward-ssh-key: "+err.Error())
+		}
+		if len(d.NodeForwardKnownHosts) == 0 {
+			problems = append(problems, "proxmoxve-node-forward-known-hosts is required with proxmoxve-node-forward")
+		} else if _, err := knownhosts.New(d.NodeForwardKnownHosts); err != nil {
+			problems = append(problems, "proxmoxve-node-forward-known-hosts: "+err.Error())
+		}
+		// the guest ip isn't reachable, only the forwarded ports are
+		check(d.IPStablePolls == 0, "proxmoxve-ip-stable-polls can't be used with proxmoxve-node-forward, the guest ip isn't reachable")
+	}
+	if len(d.SSHKeySource) > 0 {
+		for _, file := range []string{d.SSHKeySource, d.SSHKeySource + ".pub"} {
+			if _, err := os.Stat(file); err != nil {
+				problems = append(problems, "proxmoxve-ssh-keypath: "+err.Error())
+			}
+		}
+	}
+	if _, err := d.extraSSHKeys(); err != nil {
+		problems = append(problems, "proxmoxve-ssh-extra-key: "+err.Error())
+	}
+	if !strings.Contains(" "+strings.Join(citypes, " ")+" ", " "+d.Citype+" ") {
+		problems = append(problems, fmt.Sprintf("proxmoxve-vm-citype must be one of %s, got '%s'", strings.Join(citypes, ", "), d.Citype))
+	} else {
+		check(d.Citype == "nocloud" || !d.needsCloudInitSeed(), "proxmoxve-vm-citype must be nocloud with options delivered by the cloud-init seed, which is a NoCloud iso, got '%s'", d.Citype)
+	}
+	if len(d.CloudInitNetworkConfig) > 0 {
+		if _, err := d.customNetworkConfig(); err != nil {
+			problems = append(problems, "proxmoxve-vm-cloud-init-network-config: "+err.Error())
+		}
+	}
+	problems = append(problems, d.validateWebhook()...)
+
+	for _, h := range d.Headers {
+		if _, _, err := parseHeader(h); err != nil {
+			problems = append(problems, "proxmoxve-proxmox-header: "+err.Error())
+		}
+	}
+
+	for _, f := range d.GuestFiles {
+		if err := validateGuestFile(f); err != nil {
+			problems = append(problems, "proxmoxve-vm-guest-file: "+err.Error())
+		}
+	}
+
+	if len(d.Pool) > 0 {
+		if err := validatePool(d.Pool); err != nil {
+			problems = append(problems, "proxmoxve-proxmox-pool: "+err.Error())
+		}
+	}
+
+	if _, err := d.renderDescription(time.Now()); err != nil {
+		problems = append(problems, "proxmoxve-vm-description-template: "+err.Error())
+	}
+
+	if name, err := d.renderVMName(); err != nil {
+		problems = append(problems, "proxmoxve-vm-name-template: "+err.Error())
+	} else {
+		check(len(name) > 0, "the VM name for machine '%s' is empty after sanitizing", d.MachineName)
+	}
+
+	// without a range the VMID is allocated by the cluster
+	if len(d.VMIDRange) > 0 {
+		if min, _, err := d.parseVmidRange(); err != nil {
+			problems = append(problems, "proxmoxve-vm-vmid-range: "+err.Error())
+		} else {
+			check(min >= 100, "proxmoxve-vm-vmid-range must start at 100 or above, got '%s'", d.VMIDRange)
+		}
+	}
+
+	return problems
+}
+
+// validateCloneSource checks that the VM to clone exists on the node
+func (d *Driver) validateCloneSource() []string {
+	cloneVmId, err := strconv.Atoi(d.CloneVMID)
+	if err != nil {
+		// already reported by validateFlags
+		return nil
+	}
+
+	if err := d.locateCloneSource(cloneVmId); err != nil {
+		return []string{fmt.Sprintf("proxmoxve-vm-clone-vmid: %s", err)}
+	}
+	config, err := d.cloneSourceConfig(cloneVmId)
+	if err != nil {
+		if len(d.CloneSnapshot) > 0 {
+			return []string{fmt.Sprintf("proxmoxve-vm-clone-snapshot: %s", err)}
+		}
+		return []string{fmt.Sprintf("proxmoxve-vm-clone-vmid: VM %d not found on node '%s': %s", cloneVmId, d.cloneSourceNode(), err)}
+	}
+
+	// snapshots of VMs are always cloned in full, so they needn't be templates
+	if !isTemplate(config) && len(d.CloneSnapshot) == 0 {
+		return []string{fmt.Sprintf("proxmoxve-vm-clone-vmid: VM %d on node '%s' is not a template, convert it with 'qm template %d'", cloneVmId, d.cloneSourceNode(), cloneVmId)}
+	}
+
+	if problems := d.validateDiskSize(config, cloneVmId); len(problems) > 0 {
+		return problems
+	}
+
+	if problems := validateCloneFull(d.CloneFullMode, config); len(problems) > 0 {
+		return problems
+	}
+	if d.CloneFullMode == "0" && d.cloneSourceNode() != d.Node {
+		if shared, err := d.sharedSource(config); err == nil && !shared {
+			return []string{fmt.Sprintf("proxmoxve-vm-clone-full: template %d is on local storage of node %s, a linked clone can't be created on node %s", cloneVmId, d.cloneSourceNode(), d.Node)}
+		}
+	}
+
+	// minimal clones rely on the template authorizing the ssh key
+	if cloudInitDrive(config) == "" && !d.CloudInitDriveAdd && !d.CloneMinimal {
+		return []string{fmt.Sprintf("proxmoxve-vm-clone-vmid: VM %d has no cloud-init drive, so the ssh key can't be injected; "+
+			"add one to the template (qm set %d --ide2 <storage>:cloudinit) or use --proxmoxve-vm-cloud-init-drive-add", cloneVmId, cloneVmId)}
+	}
+	if citype, _ := config["citype"].(string); len(citype) > 0 && citype != "nocloud" && d.needsCloudInitSeed() {
+		return []string{fmt.Sprintf("proxmoxve-vm-clone-vmid: VM %d has citype %s, but options delivered by the cloud-init seed require nocloud", cloneVmId, citype)}
+	}
 
 	return nil
 }
 
+// Create creates a new VM with storage
+func (d *Driver) Create() (err error) {
+	defer func() {
+		if err == nil {
+			d.ConsoleURL = d.consoleURL()
+			d.waitForEngine()
+		}
+		d.notify("create", err)
+	}()
+
+	if d.adopting() {
+		return d.adoptVM()
+	}
+
+	nodes := d.placement
+	if len(nodes) == 0 {
+		nodes = []string{d.Node}
+	}
+
+	for i, node := range nodes {
+		d.Node = node
+		d.VMID = 0
+		err = d.createVM()
+		if err == nil {
+			return nil
+		}
+
+		retry := i < len(nodes)-1 && isNodeLocalError(err)
+		if retry {
+			log.Warnf("creating the VM on node %s failed, trying node %s: %s", node, nodes[i+1], err)
+		}
+		d.rollback()
+		if !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// rollback removes the VM left behind by a failed creation, unless it is
+// kept for debugging
+func (d *Driver) rollback() {
+	if d.VMID == 0 {
+		return
+	}
+	if d.keepFailedVM {
+		log.Warnf("keeping the failed VM %d on node %s", d.VMID, d.Node)
+		return
+	}
+
+	d.debugf("removing the failed VM %d from node %s", d.VMID, d.Node)
+	// the protection was set by the failed creation itself
+	if err := d.unprotect(true); err != nil {
+		log.Warnf("unable to remove the failed VM %d from node %s: %s", d.VMID, d.Node, err)
+		return
+	}
+	if err := d.destroyVM(); err != nil {
+		log.Warnf("unable to remove the failed VM %d from node %s: %s", d.VMID, d.Node, err)
+		return
+	}
+	d.VMID = 0
+}
+
+// createVM creates the VM on the selected node
+func (d *Driver) createVM() error {
+	vmName, err := d.renderVMName()
+	if err != nil {
+		return err
+	}
+	d.VMName = vmName
+
+	if err := d.ensurePool(); err != nil {
+		return err
+	}
+
+	if err := d.resolveCloneSource(); err != nil {
+		return err
+	}
+
+	if !d.nodeAutoSelect() {
+		// candidates are checked when they are selected
+		if err := d.checkCapacity(); err != nil {
+			return err
+		}
+	}
+
+	if err := d.createWithFreeVMID(); err != nil {
+		return err
+	}
+
+	vm, err4 := d.GetVM()
+	if err4 != nil {
+		return err4
+	}
+
+	d.debugf("add misc configuration options")
+
+	var options []proxmox.VirtualMachineOption
+	if d.CloneMinimal {
+		d.debugf("minimal clone mode, leaving agent, autostart, kvm, citype and onboot as defined by the template")
+	} else {
+		options = append(options,
+			proxmox.VirtualMachineOption{Name: "agent", Value: "1"},
+			proxmox.VirtualMachineOption{Name: "autostart", Value: d.Autostart},
+			proxmox.VirtualMachineOption{Name: "kvm", Value: d.KVM},
+			proxmox.VirtualMachineOption{Name: "onboot", Value: d.Onboot},
+		)
+		config, err := d.getVMConfig(d.Node, d.VMID)
+		if err != nil {
+			return err
+		}
+		if citype := d.citypeOption(config); citype != nil {
+			options = append(options, *citype)
+		}
+	}
+	if len(d.MachineType) > 0 && len(d.CloneVMID) > 0 {
+		options = append(options, proxmox.VirtualMachineOption{Name: "machine", Value: d.machineType()})
+	}
+	if err := d.configureVMOptions(options...); err != nil {
+		return err
+	}
+	if len(d.BIOS) > 0 && len(d.CloneVMID) > 0 && !d.isARM() {
+		if err := d.configureBIOS(); err != nil {
+			return err
+		}
+	}
+	if d.isARM() {
+		if err := d.configureARM(); err != nil {
+			return err
+		}
+	}
+
+	if d.CloneMinimal {
+		d.debugf("minimal clone mode, leaving memory and cpus as defined by the template")
+	} else if err := d.applyHardwareOptions(); err != nil {
+		return err
+	}
+
+	if err := d.applyHostPCI(); err != nil {
+		return err
+	}
+
+	if len(d.CloneVMID) > 0 {
+		if err := d.applyDiskOptions(); err != nil {
+			return err
+		}
+	}
+
+	if len(d.ExtraDisks) > 0 {
+		if err := d.applyExtraDisks(); err != nil {
+			return err
+		}
+	}
+
+	if len(d.NetBridge) > 0 {
+		if err := d.ConfigureVM("net0", d.generateNetString()); err != nil {
+			return err
+		}
+	}
+
+	if err := d.applyFirewallOptions(); err != nil {
+		return err
+	}
+
+	if err := d.applyClusterIdentity(); err != nil {
+		return err
+	}
+
+	if err := d.applyDescription(); err != nil {
+		return err
+	}
+
+	if d.CloudInitDriveAdd {
+		if err := d.ensureCloudInitDrive(); err != nil {
+			return err
+		}
+	}
+
+	if d.staticIP() {
+		ipConfig, err := d.staticIPConfig()
+		if err != nil {
+			return err
+		}
+		if err := d.ConfigureVM("ipconfig0", ipConfig); err != nil {
+			return err
+		}
+	}
+	if err := d.configureVMOptions(d.dnsOptions()...); err != nil {
+		return err
+	}
+	if err := d.applyCIUser(); err != nil {
+		return err
+	}
+
+	// append newly minted ssh key to existing (if any)
+	SSHKeys, err2 := d.appendVmSshKeys(vm)
+	if err2 != nil {
+		return err2
+	}
+
+	if d.CloneMinimal {
+		d.debugf("minimal clone mode, leaving the sshkeys of the template")
+	} else {
+		err3 := d.ConfigureVM("sshkeys", SSHKeys)
+		d.debugf("cloud-init sshkeys set to '%s'", SSHKeys)
+		if err3 != nil {
+			return err3
+		}
+	}
+
+	if d.needsCloudInitSeed() {
+		if err := d.applyCloudInitSeed(SSHKeys); err != nil {
+			return err
+		}
+	}
+
+	// start the VM
+	err = d.Start()
+	if err != nil {
+		return err
+	}
+
+	if d.haEnabled() {
+		if err := d.registerHA(); err != nil {
+			return err
+		}
+	}
+
+	// wait for the agent and get the IPAddress
+	var vmIp string
+	if d.IPStablePolls > 0 && !d.staticIP() {
+		vmIp, err = d.waitForStableIP()
+	} else {
+		vmIp, err = d.GetIP()
+	}
+	if err != nil {
+		return err
+	}
+
+	d.debugf("VM got an IP: %s", vmIp)
+
+	// the bootstrap would race the package installs of cloud-init
+	if d.CloudInitWait || d.Bootstrap {
+		if err := d.waitForCloudInit(); err != nil {
+			return err
+		}
+	}
+
+	if d.Bootstrap {
+		if err := d.runBootstrap(); err != nil {
+			return err
+		}
+	}
+
+	if len(d.GuestFiles) > 0 {
+		if err := d.copyGuestFiles(); err != nil {
+			return err
+		}
+	}
+
+	if len(d.GuestExec) > 0 {
+		if err := d.runGuestExec(); err != nil {
+			return err
+		}
+	}
+
+	if d.EjectMedia {
+		if err := d.ejectMedia(); err != nil {
+			return err
+		}
+	}
+
+	if len(d.GoldenSnapshot) > 0 {
+		if err := d.CreateSnapshot(d.GoldenSnapshot, "state of machine "+d.MachineName+" after its creation"); err != nil {
+			return err
+		}
+	}
+
+	if d.CloneMinimal {
+		return nil
+	}
+	// protection is set last, it blocks the removal of drives like the
+	// generated cloud-init drive
+	return d.configureVMOptions(proxmox.VirtualMachineOption{Name: "protection", Value: d.Protection})
+}
+
+// applyHardwareOptions sets memory and cpus of the VM
+func (d *Driver) applyHardwareOptions() error {
+	options := []proxmox.VirtualMachineOption{
+		{Name: "memory", Value: fmt.Sprint(d.Memory)},
+		{Name: "shares", Value: d.MemoryShares},
+		{Name: "sockets", Value: d.CPUSockets},
+		{Name: "cores", Value: d.CPUCores},
+		{Name: "cpulimit", Value: d.CPULimit},
+		{Name: "cpuunits", Value: d.CPUUnits},
+		{Name: "vcpus", Value: d.VCPUs},
+		{Name: "numa", Value: d.NUMA},
+		{Name: "cpu", Value: d.CPU},
+	}
+	if len(d.MemoryBalloon) > 0 {
+		balloon, _ := strconv.Atoi(d.MemoryBalloon)
+		options = append(options, proxmox.VirtualMachineOption{Name: "balloon", Value: fmt.Sprint(balloon * 1024)})
+	}
+	return d.configureVMOptions(options...)
+}
+
+// cloneTemplate creates the VM as clone of CloneVMID
+func (d *Driver) cloneTemplate(newId int) error {
+	clone := &proxmox.VirtualMachineCloneOptions{
+		Name:    d.VMName,
+		Full:    1,
+		Pool:    d.Pool,
+		Format:  d.StorageType,
+		Storage: d.Storage,
+		NewID:   newId,
+		BWLimit: uint64(d.CloneBWLimit),
+	}
+	if len(d.CloneSnapshot) > 0 {
+		d.debugf("cloning from snapshot '%s'", d.CloneSnapshot)
+		clone.SnapName = d.CloneSnapshot
+	}
+
+	d.debugf("cloning new vm from template id '%s'", d.CloneVMID)
+
+	cloneVmId, err := strconv.Atoi(d.CloneVMID)
+	if err != nil {
+		return err
+	}
+
+	if err := d.locateCloneSource(cloneVmId); err != nil {
+		return err
+	}
+
+	config, err := d.cloneSourceConfig(cloneVmId)
+	if err != nil {
+		return err
+	}
+	full, err := d.cloneFull(config)
+	if err != nil {
+		return err
+	}
+	d.CloneFull = full
+	if full == 0 {
+		// storage and format can't be chosen for linked clones
+		d.debugf("creating a linked clone")
+		clone.Full, clone.Storage, clone.Format = 0, "", ""
+	}
+
+	// the clone API creates clones on other nodes from shared storage only,
+	// otherwise the VM is cloned on the node of the source and migrated
+	migrateTo := ""
+	if d.cloneSourceNode() != d.Node {
+		shared, err := d.sharedSource(config)
+		if err != nil {
+			return err
+		}
+		switch {
+		case shared:
+			d.debugf("cloning from node %s to node %s", d.cloneSourceNode(), d.Node)
+			clone.Target = d.Node
+		case full == 0:
+			return fmt.Errorf("template %d is on local storage of node %s, a linked clone can't be created on node %s", cloneVmId, d.cloneSourceNode(), d.Node)
+		default:
+			d.debugf("cloning on node %s and migrating to node %s", d.cloneSourceNode(), d.Node)
+			// the migration moves the disks to Storage
+			migrateTo, clone.Storage = d.Node, ""
+		}
+	}
+
+	node, err := d.client.Node(context.Background(), d.cloneSourceNode())
+	if err != nil {
+		return err
+	}
+
+	clonevm, err := node.VirtualMachine(context.Background(), cloneVmId)
+	if err != nil {
+		return err
+	}
+
+	_, task, err := clonevm.Clone(context.Background(), clone)
+	d.debugf("clone task for new vmid '%d' created", newId)
+
+	if err != nil {
+		return err
+	}
+	// from here on a failed creation leaves a VM to clean up
+	d.VMID = newId
+	if len(migrateTo) > 0 {
+		d.Node = d.cloneSourceNode()
+	}
+
+	// wait for the clone task
+	if err := task.Wait(context.Background(), d.taskInterval, d.taskTimeout); err != nil {
+		return err
+	}
+	d.debugf("clone finished for vmid '%d'", newId)
+
+	if len(migrateTo) > 0 {
+		if err := d.migrateVM(migrateTo, false); err != nil {
+			return err
+		}
+	}
+
+	d.debugf("vmid values VMID: '%d'", d.VMID)
+
+	if d.CloneMinimal {
+		d.debugf("minimal clone mode, leaving the disk size of the template")
+		return nil
+	}
+
+	// resize
+	config, err = d.getVMConfig(d.Node, d.VMID)
+	if err != nil {
+		return err
+	}
+	size, err := strconv.Atoi(d.DiskSize)
+	if err != nil {
+		return err
+	}
+
+	vm, err4 := d.GetVM()
+	if err4 != nil {
+		return err4
+	}
+	return d.growDisk(vm, config, d.resizeDevice(config), size)
+}
+
 func (d *Driver) appendVmSshKeys(vm *proxmox.VirtualMachine) (string, error) {
-	// create and save a new SSH key pair
-	d.debug("creating new ssh keypair")
+	// create and save a new SSH key pair, or copy the given one
 	key, err := d.createSSHKey()
 	if err != nil {
 		return "", err
@@ -768,18 +2480,18 @@ func (d *Driver) appendVmSshKeys(vm *proxmox.VirtualMachine) (string, error) {
 		if err != nil {
 			return "", err
 		}
-
-		SSHKeys = strings.TrimSpace(SSHKeys)
-		SSHKeys += "\n"
 	}
 
-	SSHKeys += key
-	SSHKeys = strings.TrimSpace(SSHKeys)
+	keys, err := d.extraSSHKeys()
+	if err != nil {
+		return "", err
+	}
+	SSHKeys = mergeSSHKeys(SSHKeys, d.SSHKeysReplace, append(keys, key)...)
 
 	// specially handle setting sshkeys
 	// https://forum.proxmox.com/threads/how-to-use-pvesh-set-vms-sshkeys.52570/
 
-	d.debugf("retrieving existing cloud-init sshkeys from vmid '%s'", d.VMID)
+	d.debugf("retrieving existing cloud-init sshkeys from vmid '%d'", d.VMID)
 
 	r := strings.NewReplacer("+", "%2B", "=", "%3D", "@", "%40")
 
@@ -807,13 +2519,46 @@ func (d *Driver) generateNetString() string {
 }
 
 // Start starts the VM
-func (d *Driver) Start() error {
+func (d *Driver) Start() (err error) {
+	defer func() { d.notify("start", err) }()
 	return d.OperateVM("start")
 }
 
 // Stop stopps the VM
-func (d *Driver) Stop() error {
-	return d.OperateVM("stop")
+func (d *Driver) Stop() (err error) {
+	defer func() { d.notify("stop", err) }()
+	return d.shutdownVM()
+}
+
+// shutdownVM shuts the guest down cleanly, via the guest agent if enabled or
+// ACPI otherwise. The VM is stopped hard if it's still running after
+// ShutdownTimeout.
+func (d *Driver) shutdownVM() error {
+	if d.ShutdownTimeout <= 0 {
+		return d.OperateVM("stop")
+	}
+	if err := d.connect(); err != nil {
+		return err
+	}
+
+	var upid proxmox.UPID
+	params := map[string]interface{}{"timeout": d.ShutdownTimeout}
+	if err := d.client.Post(context.Background(), fmt.Sprintf("/nodes/%s/qemu/%d/status/shutdown", d.Node, d.VMID), params, &upid); err != nil {
+		return err
+	}
+
+	interval := d.taskInterval
+	if interval < time.Second {
+		interval = time.Second
+	}
+	// the task fails itself once the timeout is reached
+	timeout := time.Duration(d.ShutdownTimeout)*time.Second + 10*interval
+	task := proxmox.NewTask(upid, d.client)
+	if err := task.Wait(context.Background(), interval, timeout); err != nil {
+		log.Warnf("VM %d did not shut down within %ds, stopping it: %s", d.VMID, d.ShutdownTimeout, err)
+		return d.killVM()
+	}
+	return nil
 }
 
 // Restart restarts the VM
@@ -821,78 +2566,227 @@ func (d *Driver) Restart() error {
 	return d.OperateVM("restart")
 }
 
-// Kill the VM immediately
+// Kill stops the VM immediately, without shutting down the guest
 func (d *Driver) Kill() error {
-	return d.OperateVM("kill")
+	return d.killVM()
+}
+
+// killParams returns the parameters of the hard stop of the VM. A pending
+// shutdown, e.g. of a hung guest, is aborted instead of waited for, and
+// root@pam skips the VM lock as well.
+func (d *Driver) killParams() map[string]interface{} {
+	params := map[string]interface{}{}
+	if d.pveVersion.atLeast(8, 1) {
+		// overrule-shutdown is new in Proxmox VE 8.1
+		params["overrule-shutdown"] = 1
+	}
+	if d.User == "root" && d.Realm == "pam" {
+		params["skiplock"] = 1
+	}
+	return params
+}
+
+// killVM stops the VM hard
+func (d *Driver) killVM() error {
+	if err := d.connect(); err != nil {
+		return err
+	}
+
+	params := d.killParams()
+	var upid proxmox.UPID
+	if err := d.client.Post(context.Background(), fmt.Sprintf("/nodes/%s/qemu/%d/status/stop", d.Node, d.VMID), params, &upid); err != nil {
+		return err
+	}
+
+	interval := d.taskInterval
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return proxmox.NewTask(upid, d.client).Wait(context.Background(), interval, d.taskTimeout)
 }
 
 // Remove removes the VM
-func (d *Driver) Remove() error {
-	vm, err := d.GetVM()
+func (d *Driver) Remove() (err error) {
+	defer func() { d.notify("remove", err) }()
+	if d.VMID == 0 {
+		// never created or already rolled back by Create. A VM which is only
+		// found by name is not removed, it may belong to someone else.
+		d.debug("no VM to remove")
+		return nil
+	}
+	if err := d.checkRemovable(); err != nil {
+		return err
+	}
+	if d.Adopted && !d.ExistingRemove {
+		log.Infof("keeping the adopted VM %d, use --proxmoxve-vm-existing-remove to remove it with the machine", d.VMID)
+		if d.NodeForward {
+			d.removeForward()
+		}
+		return nil
+	}
+	protected, err := d.protected(d.ProtectionOverride)
 	if err != nil {
 		return err
 	}
+	// a failed backup keeps the VM, protected as it was
+	if len(d.RemoveBackup) > 0 {
+		if err := d.backupVM(); err != nil {
+			return err
+		}
+	}
+	if protected {
+		d.debugf("clearing the protection of VM %d", d.VMID)
+		if err := d.ConfigureVM("protection", "0"); err != nil {
+			return err
+		}
+	}
+	if d.NodeForward {
+		d.removeForward()
+	}
+	return d.destroyVM()
+}
 
-	stopTask, err2 := vm.Stop(context.Background())
-	if err2 != nil {
-		return err2
+// checkRemovable refuses the removal of a VM which was only found by name
+func (d *Driver) checkRemovable() error {
+	if d.VMIDRecovered {
+		return fmt.Errorf("VM %d was only found by name, it may belong to someone else and is not removed; remove it in Proxmox VE and the machine with --force", d.VMID)
+	}
+	return nil
+}
+
+// protected returns true if the protection flag of the VM is set, which
+// blocks its removal. Without force a protected VM is an error, so it is left
+// alone before it is backed up or stopped.
+func (d *Driver) protected(force bool) (bool, error) {
+	config, err := d.getVMConfig(d.Node, d.VMID)
+	if err != nil {
+		return false, err
 	}
-	// wait for the stop task
-	vmStoppedStatus, vmStoppedCompleted, vmStoppedErr := stopTask.WaitForCompleteStatus(context.Background(), int(d.taskTimeout.Seconds()))
-	if vmStoppedErr != nil {
-		return vmStoppedErr
+	if fmt.Sprint(config["protection"]) != "1" {
+		return false, nil
 	}
+	if !force {
+		return true, fmt.Errorf("VM %d is protected, clear the protection in Proxmox VE or use --proxmoxve-vm-protection-override to remove it", d.VMID)
+	}
+	return true, nil
+}
 
-	d.debugf("VM stopped status: %s", vmStoppedStatus)
-	d.debugf("VM stop completed: %s", vmStoppedCompleted)
+// unprotect clears the protection flag of the VM, see protected
+func (d *Driver) unprotect(force bool) error {
+	protected, err := d.protected(force)
+	if err != nil || !protected {
+		return err
+	}
 
-	deleteTask, err4 := vm.Delete(context.Background())
-	if err4 != nil {
-		return err4
+	d.debugf("clearing the protection of VM %d", d.VMID)
+	return d.ConfigureVM("protection", "0")
+}
+
+// destroyVM stops the VM unless it is stopped already and deletes it. The
+// delete purges the VM from backup and replication jobs and destroys disks
+// not referenced by its config, so no orphaned volumes pile up.
+func (d *Driver) destroyVM() error {
+	if err := d.checkRemovable(); err != nil {
+		return err
 	}
 
-	// wait for the delete task
-	vmDelStatus, vmDelCompleted, vmDelErr := deleteTask.WaitForCompleteStatus(context.Background(), int(d.taskTimeout.Seconds()))
-	if vmDelErr != nil {
-		return vmDelErr
+	vm, err := d.GetVM()
+	if err != nil {
+		return err
+	}
+
+	if err := d.deregisterHA(); err != nil {
+		return err
+	}
+
+	if vm.Status == "stopped" {
+		d.debugf("VM %d is stopped already", d.VMID)
+	} else {
+		stopTask, err := vm.Stop(context.Background())
+		if err != nil {
+			return err
+		}
+		// wait for the stop task
+		vmStoppedStatus, vmStoppedCompleted, vmStoppedErr := stopTask.WaitForCompleteStatus(context.Background(), int(d.taskTimeout.Seconds()))
+		if vmStoppedErr != nil {
+			return vmStoppedErr
+		}
+
+		d.debugf("VM stopped status: %t", vmStoppedStatus)
+		d.debugf("VM stop completed: %t", vmStoppedCompleted)
+	}
+
+	var upid proxmox.UPID
+	path := fmt.Sprintf("/nodes/%s/qemu/%d?%s", d.Node, d.VMID, destroyParams().Encode())
+	if err := d.client.Delete(context.Background(), path, &upid); err != nil {
+		return err
 	}
 
-	d.debugf("VM delete status: %s", vmDelStatus)
-	d.debugf("VM delete completed: %s", vmDelCompleted)
+	// wait for the delete task
+	if err := proxmox.NewTask(upid, d.client).Wait(context.Background(), d.taskInterval, d.taskTimeout); err != nil {
+		return err
+	}
+	d.debugf("VM %d deleted", d.VMID)
 
+	if err := d.deleteCloudInitSeed(); err != nil {
+		log.Warnf("unable to delete the cloud-init seed of VM %d: %s", d.VMID, err)
+	}
 	return nil
 }
 
-func (d *Driver) GetVmidInRange() (int, error) {
+// destroyParams returns the parameters of the deletion of the VM. purge
+// removes it from backup jobs, replication and HA as well, and disks not
+// referenced in its config, e.g. left by a failed import, are deleted too.
+func destroyParams() url.Values {
+	return url.Values{"purge": {"1"}, "destroy-unreferenced-disks": {"1"}}
+}
+
+// maxVMID is the largest VMID Proxmox VE accepts
+const maxVMID = 999999999
+
+func (d *Driver) parseVmidRange() (int, int, error) {
 	// split d.VMIDRange into two parts by separating through ":"
 	vmidRange := strings.Split(d.VMIDRange, ":")
 	if len(vmidRange) != 2 {
-		return 0, fmt.Errorf("VMIDRange must be in the form of <min>:<max>. Given: %s", d.VMIDRange)
+		return 0, 0, fmt.Errorf("VMIDRange must be in the form of <min>:<max>. Given: %s", d.VMIDRange)
 	}
 
 	min, err := strconv.Atoi(vmidRange[0])
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 
 	max, err := strconv.Atoi(vmidRange[1])
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 
 	if min > max {
-		return 0, fmt.Errorf("VMIDRange :<max> must be greater than <min>. Given: %s", d.VMIDRange)
+		return 0, 0, fmt.Errorf("VMIDRange :<max> must be greater than <min>. Given: %s", d.VMIDRange)
 	}
-	// now randomly choose from min max range
-	return rand.Intn(max-min) + min, nil
+
+	if max > maxVMID {
+		return 0, 0, fmt.Errorf("VMIDRange :<max> must not exceed %d. Given: %s", maxVMID, d.VMIDRange)
+	}
+
+	return min, max, nil
 }
 
 func (d *Driver) createSSHKey() (string, error) {
 	var sshKeyPath = d.GetSSHKeyPath()
-	d.debugf("Creating SSH key at %s", sshKeyPath)
-
-	if err := ssh.GenerateSSHKey(sshKeyPath); err != nil {
-		return "", err
+	if len(d.SSHKeySource) > 0 {
+		d.debugf("Copying SSH key %s to %s", d.SSHKeySource, sshKeyPath)
+		if err := mcnutils.CopyFile(d.SSHKeySource, sshKeyPath); err != nil {
+			return "", fmt.Errorf("unable to copy the ssh key: %w", err)
+		}
+		if err := mcnutils.CopyFile(d.SSHKeySource+".pub", sshKeyPath+".pub"); err != nil {
+			return "", fmt.Errorf("unable to copy the ssh key: %w", err)
+		}
+	} else {
+		d.debugf("Creating SSH key at %s", sshKeyPath)
+		if err := ssh.GenerateSSHKey(sshKeyPath); err != nil {
+			return "", err
+		}
 	}
 
 	key, err := os.ReadFile(sshKeyPath + ".pub")
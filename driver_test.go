@@ -1,10 +1,18 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/luthermonson/go-proxmox"
+	"github.com/rancher/machine/libmachine/state"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,6 +23,24 @@ func createDriver() *Driver {
 	return d
 }
 
+// testUPID is the task id answered by fake APIs, whose tasks finish at once
+const testUPID = "UPID:pve1:00001234:00005678:65A1B2C3:qmdestroy:101:root@pam:"
+
+// createAPIDriver returns a driver for VM 101 on pve1 connected to a fake API
+// served by the handler
+func createAPIDriver(t *testing.T, handler http.HandlerFunc) *Driver {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	d := createDriver()
+	d.client = proxmox.NewClient(server.URL+"/api2/json", proxmox.WithHTTPClient(server.Client()))
+	d.Node = "pve1"
+	d.VMID = 101
+	d.taskInterval = time.Millisecond
+	d.taskTimeout = time.Minute
+	return d
+}
+
 func Test_SSHKeyGeneration(t *testing.T) {
 	var driver = createDriver()
 
@@ -31,10 +57,10 @@ func Test_VMIDRange(t *testing.T) {
 	var driver = createDriver()
 	driver.VMIDRange = "100:200"
 
-	vmid, err := driver.GetVmidInRange()
-
+	min, max, err := driver.parseVmidRange()
+	assert.Nil(t, err)
+	vmid, err := pickVMID(min, max, nil)
 	assert.Nil(t, err)
-	assert.NotEmpty(t, vmid)
 
 	// assert that vmid is an int between 100 and 200
 	assert.True(t, vmid >= 100 && vmid <= 200)
@@ -44,19 +70,16 @@ func Test_VMIDRangeBroken(t *testing.T) {
 	var driver = createDriver()
 	driver.VMIDRange = "100"
 
-	s, err := driver.GetVmidInRange()
-
-	assert.NotNil(t, err)
+	_, _, err := driver.parseVmidRange()
 	assert.EqualError(t, err, "VMIDRange must be in the form of <min>:<max>. Given: 100")
-	assert.Empty(t, s)
 
 	driver.VMIDRange = "100:50"
+	_, _, err = driver.parseVmidRange()
+	assert.EqualError(t, err, "VMIDRange :<max> must be greater than <min>. Given: 100:50")
 
-	s2, err2 := driver.GetVmidInRange()
-
-	assert.NotNil(t, err2)
-	assert.EqualError(t, err2, "VMIDRange :<max> must be greater than <min>. Given: 100:50")
-	assert.Empty(t, s2)
+	driver.VMIDRange = "100:1000000000"
+	_, _, err = driver.parseVmidRange()
+	assert.EqualError(t, err, "VMIDRange :<max> must not exceed 999999999. Given: 100:1000000000")
 }
 
 func Test_AppendSshKeys(t *testing.T) {
@@ -76,3 +99,406 @@ func Test_AppendSshKeys(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Contains(t, SSHKeys, "asd%0Assh-rsa")
 }
+
+func Test_ValidateFlags(t *testing.T) {
+	var driver = createDriver()
+	driver.DiskSize = "16"
+	driver.Memory = 8 * 1024
+	driver.GuestSSHPort = 22
+	driver.CloneVMID = "9000"
+	driver.VMIDRange = "100:200"
+
+	assert.Empty(t, driver.validateFlags())
+
+	driver.Onboot = "yes"
+	driver.DiskSize = "16G"
+	driver.CloneVMID = "template"
+	driver.VMIDRange = "1:50"
+
+	problems := driver.validateFlags()
+
+	assert.Len(t, problems, 4)
+	assert.Contains(t, validationError(problems).Error(), "proxmoxve-vm-start-onboot must be 0 or 1, got 'yes'")
+	assert.Contains(t, validationError(problems).Error(), "proxmoxve-vm-vmid-range must start at 100 or above, got '1:50'")
+
+	// reported along with the host which can't be connected to
+	err := driver.PreCreateCheck()
+	assert.Contains(t, err.Error(), "proxmoxve-vm-start-onboot must be 0 or 1, got 'yes'")
+	assert.Contains(t, err.Error(), "proxmoxve-proxmox-host: ")
+}
+
+func Test_AgentEnabled(t *testing.T) {
+	assert.True(t, agentEnabled("1"))
+	assert.True(t, agentEnabled("enabled=1,fstrim_cloned_disks=1"))
+	assert.True(t, agentEnabled("fstrim_cloned_disks=1,enabled=1"))
+	assert.False(t, agentEnabled("0"))
+	assert.False(t, agentEnabled("enabled=0"))
+	assert.False(t, agentEnabled("<nil>"))
+}
+
+func Test_UserRealm(t *testing.T) {
+	var driver = createDriver()
+
+	err := driver.SetConfigFromFlags(newTestOptions(driver, map[string]interface{}{
+		"proxmoxve-proxmox-user-name": "terraform@pve",
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "terraform", driver.User)
+	assert.Equal(t, "pve", driver.Realm)
+
+	err = driver.SetConfigFromFlags(newTestOptions(driver, map[string]interface{}{
+		"proxmoxve-proxmox-user-name": "root",
+		"proxmoxve-proxmox-realm":     "pve",
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "root", driver.User)
+	assert.Equal(t, "pve", driver.Realm)
+}
+
+func Test_ValidateMemoryShares(t *testing.T) {
+	var driver = createDriver()
+	driver.DiskSize = "16"
+	driver.Memory = 8 * 1024
+	driver.GuestSSHPort = 22
+	driver.CloneVMID = "9000"
+	driver.VMIDRange = "100:200"
+	driver.MemoryBalloon = "4"
+	driver.MemoryShares = "2000"
+
+	assert.Empty(t, driver.validateFlags())
+
+	driver.MemoryBalloon = "0"
+	assert.Equal(t, []string{"proxmoxve-vm-memory-shares requires ballooning, but proxmoxve-vm-memory-balloon is 0"}, driver.validateFlags())
+
+	driver.MemoryBalloon = "16"
+	driver.MemoryShares = "60000"
+	assert.Len(t, driver.validateFlags(), 2)
+}
+
+func Test_RemoveRolledBack(t *testing.T) {
+	var driver = createDriver()
+	driver.VMID = 0
+
+	// the VM of a failed Create is already gone
+	assert.Nil(t, driver.Remove())
+}
+
+func Test_ValidateEmptyVMIDRange(t *testing.T) {
+	var driver = createDriver()
+	driver.DiskSize = "16"
+	driver.Memory = 8 * 1024
+	driver.GuestSSHPort = 22
+	driver.CloneVMID = "9000"
+	driver.VMIDRange = ""
+
+	// the VMID is allocated by the cluster
+	assert.Empty(t, driver.validateFlags())
+}
+
+func Test_PickVMID(t *testing.T) {
+	used := map[int]bool{100: true, 101: true, 103: true}
+
+	for i := 0; i < 20; i++ {
+		id, err := pickVMID(100, 103, used)
+		assert.Nil(t, err)
+		assert.Equal(t, 102, id)
+	}
+
+	used[102] = true
+	_, err := pickVMID(100, 103, used)
+	assert.EqualError(t, err, "all VMIDs between 100 and 103 are in use")
+
+	// the whole range of Proxmox VE
+	id, err := pickVMID(100, maxVMID, used)
+	assert.Nil(t, err)
+	assert.True(t, id >= 100 && id <= maxVMID && !used[id])
+
+	assert.True(t, isVMIDCollision(errors.New("unable to create VM 102: config file already exists"), 102))
+	assert.True(t, isVMIDCollision(errors.New("500 VM 102 already exists on node 'pve2'"), 102))
+	assert.False(t, isVMIDCollision(errors.New("500 VM 101 already exists on node 'pve2'"), 102))
+	assert.False(t, isVMIDCollision(errors.New("volume 'local-lvm:vm-102-disk-0' already exists"), 102))
+	assert.False(t, isVMIDCollision(errors.New("storage 'ceph' does not exist"), 102))
+}
+
+func Test_ValidateCPUOptions(t *testing.T) {
+	var driver = createDriver()
+	driver.DiskSize = "16"
+	driver.Memory = 8 * 1024
+	driver.GuestSSHPort = 22
+	driver.CloneVMID = "9000"
+	driver.VMIDRange = "100:200"
+	driver.CPUSockets = "1"
+	driver.CPUCores = "4"
+	driver.CPULimit = "1.5"
+	driver.CPUUnits = "50"
+	driver.VCPUs = "2"
+
+	assert.Empty(t, driver.validateFlags())
+
+	driver.VCPUs = "8"
+	assert.Equal(t, []string{"proxmoxve-vm-vcpus must not exceed sockets * cores (4), got '8'"}, driver.validateFlags())
+
+	driver.VCPUs = ""
+	driver.CPULimit = "200"
+	driver.CPUUnits = "0"
+	assert.Len(t, driver.validateFlags(), 2)
+}
+
+func Test_ValidateCloneMinimal(t *testing.T) {
+	var driver = createDriver()
+	driver.DiskSize = "16"
+	driver.Memory = 8 * 1024
+	driver.GuestSSHPort = 22
+	driver.CloneVMID = "9000"
+	driver.VMIDRange = "100:200"
+	driver.CloneMinimal = true
+
+	assert.Empty(t, driver.validateFlags())
+
+	driver.CPUCores = "4"
+	driver.Protection = "1"
+	assert.Equal(t, []string{
+		"proxmoxve-vm-protection can't be set with proxmoxve-vm-clone-minimal, which keeps the protection of the template",
+		"proxmoxve-vm-cpu-cores can't be set with proxmoxve-vm-clone-minimal, which keeps memory and cpus of the template",
+	}, driver.validateFlags())
+
+	// every other config write is rejected as well
+	driver.CPUCores = ""
+	driver.Protection = ""
+	driver.RancherCluster = "prod"
+	driver.RancherNodePool = "workers"
+	driver.NetBridge = "vmbr1"
+	driver.Nameserver = "10.0.0.53"
+	driver.Searchdomain = "example.com"
+	driver.CIUser = "rancher"
+	driver.CIPassword = "secret"
+	driver.CloudInitIP = "10.0.0.5/24"
+	driver.ScsiController = "virtio-scsi-single"
+	driver.DiskCache = "writeback"
+	driver.DiskIOPSRd = "1000"
+	driver.CloudInitDriveAdd = true
+	assert.Equal(t, []string{
+		"proxmoxve-rancher-cluster can't be set with proxmoxve-vm-clone-minimal, which doesn't write the config of the clone",
+		"proxmoxve-rancher-node-pool can't be set with proxmoxve-vm-clone-minimal, which doesn't write the config of the clone",
+		"proxmoxve-vm-net-bridge can't be set with proxmoxve-vm-clone-minimal, which doesn't write the config of the clone",
+		"proxmoxve-vm-nameserver can't be set with proxmoxve-vm-clone-minimal, which doesn't write the config of the clone",
+		"proxmoxve-vm-searchdomain can't be set with proxmoxve-vm-clone-minimal, which doesn't write the config of the clone",
+		"proxmoxve-vm-ci-user can't be set with proxmoxve-vm-clone-minimal, which doesn't write the config of the clone",
+		"proxmoxve-vm-ci-password can't be set with proxmoxve-vm-clone-minimal, which doesn't write the config of the clone",
+		"proxmoxve-vm-cloud-init-ip can't be set with proxmoxve-vm-clone-minimal, which doesn't write the config of the clone",
+		"proxmoxve-vm-scsi-controller can't be set with proxmoxve-vm-clone-minimal, which doesn't write the config of the clone",
+		"proxmoxve-vm-disk-cache can't be set with proxmoxve-vm-clone-minimal, which doesn't write the config of the clone",
+		"proxmoxve-vm-disk-iops-rd can't be set with proxmoxve-vm-clone-minimal, which doesn't write the config of the clone",
+		"proxmoxve-vm-cloud-init-drive-add can't be set with proxmoxve-vm-clone-minimal, which doesn't write the config of the clone",
+	}, driver.validateFlags())
+}
+
+func Test_ValidateCloneSourceCloudInitDrive(t *testing.T) {
+	driver := createAPIDriver(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api2/json/cluster/resources":
+			w.Write([]byte(`{"data":[{"vmid":9000,"node":"pve1","template":1}]}`))
+		case "/api2/json/nodes/pve1/qemu/9000/config":
+			w.Write([]byte(`{"data":{"template":1,"scsi0":"local-lvm:base-9000-disk-0,size=8G"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	driver.CloneVMID = "9000"
+	driver.DiskSize = "16"
+
+	assert.Equal(t, []string{"proxmoxve-vm-clone-vmid: VM 9000 has no cloud-init drive, so the ssh key can't be injected; " +
+		"add one to the template (qm set 9000 --ide2 <storage>:cloudinit) or use --proxmoxve-vm-cloud-init-drive-add"}, driver.validateCloneSource())
+
+	// the template of a minimal clone has to authorize the key itself
+	driver.CloneMinimal = true
+	assert.Empty(t, driver.validateCloneSource())
+}
+
+func Test_ValidateKVMAutostart(t *testing.T) {
+	var driver = createDriver()
+	driver.DiskSize = "16"
+	driver.Memory = 8 * 1024
+	driver.GuestSSHPort = 22
+	driver.CloneVMID = "9000"
+	driver.VMIDRange = "100:200"
+	driver.KVM = "0"
+	driver.Autostart = "0"
+
+	assert.Empty(t, driver.validateFlags())
+
+	driver.KVM = "true"
+	driver.Autostart = "yes"
+	assert.Equal(t, []string{
+		"proxmoxve-vm-kvm must be 0 or 1, got 'true'",
+		"proxmoxve-vm-autostart must be 0 or 1, got 'yes'",
+	}, driver.validateFlags())
+
+	driver.KVM = "1"
+	driver.Autostart = ""
+	driver.ArchEmulate = true
+	assert.Equal(t, []string{"proxmoxve-vm-kvm can't be 1 with proxmoxve-vm-arch-emulate"}, driver.validateFlags())
+}
+
+func Test_MatchVM(t *testing.T) {
+	vms := []clusterVM{
+		{VMID: 100, Name: "worker-1", Node: "pve1", Template: 1},
+		{VMID: 101, Name: "worker-1", Node: "pve1", Tags: "prod;pool-a"},
+		{VMID: 102, Name: "worker-2", Node: "pve2"},
+		{VMID: 103, Name: "worker-2", Node: "pve3", Tags: "staging"},
+	}
+
+	vm, err := matchVM(vms, "worker-1", "")
+	assert.Nil(t, err)
+	assert.Equal(t, 101, vm.VMID)
+
+	_, err = matchVM(vms, "worker-2", "")
+	assert.EqualError(t, err, "VMs 102, 103 are all named 'worker-2', set --proxmoxve-vm-lookup-tag to tell them apart")
+
+	vm, err = matchVM(vms, "worker-2", "staging")
+	assert.Nil(t, err)
+	assert.Equal(t, "pve3", vm.Node)
+
+	_, err = matchVM(vms, "worker-1", "staging")
+	assert.EqualError(t, err, "no VM named 'worker-1' found")
+}
+
+func Test_RecoveredVMIDNotRemoved(t *testing.T) {
+	var driver = createDriver()
+	assert.EqualError(t, driver.recoverVMID(), "machine has no VMID, set --proxmoxve-vm-lookup-tag to look its VM up by name")
+
+	driver.VMID = 101
+	driver.VMIDRecovered = true
+	assert.Contains(t, driver.Remove().Error(), "VM 101 was only found by name")
+}
+
+func Test_KillParams(t *testing.T) {
+	var driver = createDriver()
+	driver.User = "root"
+	driver.Realm = "pam"
+	driver.pveVersion = pveVersion{7, 4}
+	assert.Equal(t, map[string]interface{}{"skiplock": 1}, driver.killParams())
+
+	driver.Realm = "pve"
+	driver.pveVersion = pveVersion{8, 1}
+	assert.Equal(t, map[string]interface{}{"overrule-shutdown": 1}, driver.killParams())
+}
+
+func Test_DestroyVM(t *testing.T) {
+	assert.Equal(t, "destroy-unreferenced-disks=1&purge=1", destroyParams().Encode())
+
+	for _, status := range []string{"stopped", "running"} {
+		var requests []string
+		driver := createAPIDriver(t, func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Method+" "+r.URL.RequestURI())
+			switch {
+			case r.URL.Path == "/api2/json/nodes/pve1/qemu/101/status/current":
+				fmt.Fprintf(w, `{"data":{"vmid":101,"status":"%s"}}`, status)
+			case r.Method == http.MethodPost || r.Method == http.MethodDelete:
+				fmt.Fprintf(w, `{"data":"%s"}`, testUPID)
+			case strings.HasPrefix(r.URL.Path, "/api2/json/nodes/pve1/tasks/"):
+				fmt.Fprintf(w, `{"data":{"upid":"%s","status":"stopped","exitstatus":"OK"}}`, testUPID)
+			default:
+				w.Write([]byte(`{"data":{}}`))
+			}
+		})
+
+		assert.Nil(t, driver.destroyVM(), status)
+		assert.Contains(t, requests, "DELETE /api2/json/nodes/pve1/qemu/101?destroy-unreferenced-disks=1&purge=1", status)
+		if status == "stopped" {
+			assert.NotContains(t, requests, "POST /api2/json/nodes/pve1/qemu/101/status/stop")
+		} else {
+			assert.Contains(t, requests, "POST /api2/json/nodes/pve1/qemu/101/status/stop")
+		}
+	}
+}
+
+func Test_RemoveProtected(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		protection string
+		override   bool
+		err        string
+		config     string // body of the config write, empty if there is none
+	}{
+		{name: "protected", protection: "1", err: "VM 101 is protected, clear the protection in Proxmox VE or use --proxmoxve-vm-protection-override to remove it"},
+		{name: "override", protection: "1", override: true, config: `{"protection":"0"}`},
+		{name: "unprotected", protection: "0"},
+	} {
+		var requests []string
+		config := ""
+		driver := createAPIDriver(t, func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			switch {
+			case r.Method == http.MethodPost && r.URL.Path == "/api2/json/nodes/pve1/qemu/101/config":
+				body, _ := io.ReadAll(r.Body)
+				config = string(body)
+				fmt.Fprintf(w, `{"data":"%s"}`, testUPID)
+			case r.URL.Path == "/api2/json/nodes/pve1/qemu/101/config":
+				fmt.Fprintf(w, `{"data":{"protection":%s}}`, c.protection)
+			case r.URL.Path == "/api2/json/nodes/pve1/qemu/101/status/current":
+				w.Write([]byte(`{"data":{"vmid":101,"status":"stopped"}}`))
+			case r.Method == http.MethodDelete:
+				fmt.Fprintf(w, `{"data":"%s"}`, testUPID)
+			case strings.HasPrefix(r.URL.Path, "/api2/json/nodes/pve1/tasks/"):
+				fmt.Fprintf(w, `{"data":{"upid":"%s","status":"stopped","exitstatus":"OK"}}`, testUPID)
+			default:
+				w.Write([]byte(`{"data":{}}`))
+			}
+		})
+		driver.ProtectionOverride = c.override
+
+		err := driver.Remove()
+		if len(c.err) > 0 {
+			assert.EqualError(t, err, c.err, c.name)
+			assert.NotContains(t, requests, "DELETE /api2/json/nodes/pve1/qemu/101", c.name)
+		} else {
+			assert.Nil(t, err, c.name)
+			assert.Contains(t, requests, "DELETE /api2/json/nodes/pve1/qemu/101", c.name)
+		}
+		if len(c.config) > 0 {
+			assert.JSONEq(t, c.config, config, c.name)
+		} else {
+			assert.NotContains(t, requests, "POST /api2/json/nodes/pve1/qemu/101/config", c.name)
+		}
+	}
+}
+
+func Test_VMState(t *testing.T) {
+	assert.Equal(t, state.Running, vmState("running", "running", ""))
+	assert.Equal(t, state.Running, vmState("running", "", "backup"))
+	assert.Equal(t, state.Stopped, vmState("stopped", "stopped", ""))
+	assert.Equal(t, state.Paused, vmState("running", "paused", ""))
+	assert.Equal(t, state.Starting, vmState("running", "prelaunch", ""))
+	assert.Equal(t, state.Stopping, vmState("running", "shutdown", ""))
+	assert.Equal(t, state.Saved, vmState("stopped", "stopped", "suspended"))
+	assert.Equal(t, state.Error, vmState("running", "io-error", ""))
+	assert.Equal(t, state.Error, vmState("stopped", "stopped", "create"))
+	assert.Equal(t, state.None, vmState("unknown", "", ""))
+}
+
+func Test_APIURL(t *testing.T) {
+	var driver = createDriver()
+	driver.Host = "pve.example.com"
+	driver.Port = "8006"
+
+	u, err := driver.apiURL()
+	assert.Nil(t, err)
+	assert.Equal(t, "https://pve.example.com:8006/api2/json", u)
+
+	driver.URL = "https://proxy.example.com/pve/"
+	u, err = driver.apiURL()
+	assert.Nil(t, err)
+	assert.Equal(t, "https://proxy.example.com/pve/api2/json", u)
+
+	driver.URL = "http://proxy.example.com:8080/pve/api2/json"
+	u, err = driver.apiURL()
+	assert.Nil(t, err)
+	assert.Equal(t, "http://proxy.example.com:8080/pve/api2/json", u)
+
+	driver.URL = "proxy.example.com/pve"
+	_, err = driver.apiURL()
+	assert.EqualError(t, err, "'proxy.example.com/pve' is not a http(s) url")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// defaultEnginePort is the port docker-machine configures the docker daemon
+// to listen on with TLS
+const defaultEnginePort = 2376
+
+// engineProbeInterval is the time between two connection attempts to the
+// docker daemon
+const engineProbeInterval = 2 * time.Second
+
+// enginePort returns the port of the docker daemon
+func (d *Driver) enginePort() int {
+	if d.EnginePort > 0 {
+		return d.EnginePort
+	}
+	return defaultEnginePort
+}
+
+// waitForPort tries to connect to the address until it accepts connections
+// or the timeout passed
+func waitForPort(address string, timeout, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", address, interval)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("%s does not accept connections after %s: %w", address, timeout, err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// waitForEngine waits up to EngineWait seconds at the end of Create for the
+// docker daemon of templates with docker preinstalled to accept connections,
+// so docker-machine doesn't give up on a slowly booting VM. A daemon not
+// ready in time is reported by docker-machine itself. GetURL never waits, it
+// is called before the provisioning configured the daemon and by ls and env.
+func (d *Driver) waitForEngine() {
+	if d.EngineWait <= 0 {
+		return
+	}
+	address, err := d.engineURLAddress()
+	if err != nil || address == "" {
+		log.Warnf("docker daemon not ready, the VM has no address: %v", err)
+		return
+	}
+	d.debugf("waiting up to %ds for the docker daemon on %s", d.EngineWait, address)
+	if err := waitForPort(address, time.Duration(d.EngineWait)*time.Second, engineProbeInterval); err != nil {
+		log.Warnf("docker daemon not ready: %s", err)
+	}
+}
+
+// engineAddress returns host:port of the docker daemon on the ip
+func (d *Driver) engineAddress(ip string) string {
+	return net.JoinHostPort(ip, strconv.Itoa(d.enginePort()))
+}
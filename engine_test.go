@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WaitForPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := listener.Addr().String()
+
+	assert.Nil(t, waitForPort(address, time.Second, 10*time.Millisecond))
+
+	listener.Close()
+	assert.Error(t, waitForPort(address, 50*time.Millisecond, 10*time.Millisecond))
+}
+
+func Test_EngineAddress(t *testing.T) {
+	var driver = createDriver()
+	assert.Equal(t, "10.0.0.5:2376", driver.engineAddress("10.0.0.5"))
+
+	driver.EnginePort = 2375
+	assert.Equal(t, "[fd00::5]:2375", driver.engineAddress("fd00::5"))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/labstack/gommon/log"
+)
+
+// failoverTransport sends API requests to the first endpoint answering, in
+// the order given, and sticks to it until it goes down. The ticket of the
+// session is valid on all nodes of the cluster.
+type failoverTransport struct {
+	base      http.RoundTripper
+	endpoints []string // host:port of the nodes
+
+	mu      sync.Mutex
+	current int
+}
+
+// isEndpointDown returns true if the endpoint can't be reached at all, as
+// opposed to errors of the request itself. Unless the request is idempotent,
+// only errors before it was sent count, the node may have accepted a clone
+// already before the connection broke down.
+func isEndpointDown(err error, idempotent bool) bool {
+	if !idempotent {
+		return isDialError(err)
+	}
+	var netErr net.Error
+	return isTransientError(err) || isDialError(err) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// apiEndpoints returns host:port of the comma separated Host, Port is the
+// default port
+func (d *Driver) apiEndpoints() []string {
+	var endpoints []string
+	for _, host := range strings.Split(d.Host, ",") {
+		host = strings.TrimSpace(host)
+		if len(host) == 0 {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), d.Port)
+		}
+		endpoints = append(endpoints, host)
+	}
+	return endpoints
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	current := t.current
+	t.mu.Unlock()
+
+	var resp *http.Response
+	var err error
+	for i := range t.endpoints {
+		endpoint := t.endpoints[(current+i)%len(t.endpoints)]
+		r := req.Clone(req.Context())
+		r.URL.Host = endpoint
+		r.Host = endpoint
+		if i > 0 && req.GetBody != nil {
+			if r.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err = t.base.RoundTrip(r)
+		if err == nil || !isEndpointDown(err, isIdempotent(req)) || (req.Body != nil && req.GetBody == nil) {
+			if i > 0 {
+				t.mu.Lock()
+				t.current = (current + i) % len(t.endpoints)
+				t.mu.Unlock()
+			}
+			return resp, err
+		}
+		if i < len(t.endpoints)-1 {
+			log.Warnf("API endpoint %s is down, failing over to %s: %s", endpoint, t.endpoints[(current+i+1)%len(t.endpoints)], err)
+		}
+	}
+	return resp, err
+}
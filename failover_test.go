@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_APIEndpoints(t *testing.T) {
+	var driver = createDriver()
+	driver.Host = "pve1, pve2:8007,[fd00::3]"
+	driver.Port = "8006"
+	assert.Equal(t, []string{"pve1:8006", "pve2:8007", "[fd00::3]:8006"}, driver.apiEndpoints())
+
+	u, err := driver.apiURL()
+	assert.Nil(t, err)
+	assert.Equal(t, "https://pve1:8006/api2/json", u)
+}
+
+func Test_FailoverTransport(t *testing.T) {
+	// an endpoint refusing connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	down := listener.Addr().String()
+	listener.Close()
+
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	up, _ := url.Parse(server.URL)
+
+	transport := &failoverTransport{base: http.DefaultTransport, endpoints: []string{down, up.Host}}
+	client := &http.Client{Transport: transport}
+	resp, err := client.Post("http://"+down+"/api2/json/nodes", "application/x-www-form-urlencoded", strings.NewReader("newid=101"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"newid=101"}, bodies)
+	// sticks to the endpoint which answered
+	assert.Equal(t, 1, transport.current)
+
+	transport.endpoints = []string{down}
+	transport.current = 0
+	_, err = client.Get("http://" + down + "/api2/json/version")
+	assert.NotNil(t, err)
+}
+
+func Test_IsEndpointDown(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+	assert.True(t, isEndpointDown(refused, false))
+	assert.True(t, isEndpointDown(&net.DNSError{Err: "no such host", Name: "pve1"}, false))
+	// the node may have accepted the request already
+	assert.False(t, isEndpointDown(&net.OpError{Op: "read", Err: syscall.ECONNRESET}, false))
+	assert.False(t, isEndpointDown(io.ErrUnexpectedEOF, false))
+	assert.True(t, isEndpointDown(io.ErrUnexpectedEOF, true))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+var (
+	firewallPolicies  = []string{"ACCEPT", "REJECT", "DROP"}
+	firewallLogLevels = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug", "nolog"}
+)
+
+// firewallOptions returns the VM firewall options given by flags, options not
+// given keep the Proxmox VE defaults
+func (d *Driver) firewallOptions() map[string]interface{} {
+	options := make(map[string]interface{})
+	set := func(key, value string) {
+		if len(value) > 0 {
+			options[key] = value
+		}
+	}
+	set("enable", d.FirewallEnable)
+	set("policy_in", strings.ToUpper(d.FirewallPolicyIn))
+	set("policy_out", strings.ToUpper(d.FirewallPolicyOut))
+	set("log_level_in", strings.ToLower(d.FirewallLogLevelIn))
+	set("log_level_out", strings.ToLower(d.FirewallLogLevelOut))
+	set("macfilter", d.FirewallMacFilter)
+	return options
+}
+
+// validateFirewall returns the problems of the firewall flags
+func (d *Driver) validateFirewall() []string {
+	var problems []string
+	oneOf := func(flag, value string, allowed []string) {
+		if len(value) == 0 {
+			return
+		}
+		for _, a := range allowed {
+			if strings.EqualFold(value, a) {
+				return
+			}
+		}
+		problems = append(problems, fmt.Sprintf("%s must be one of %s, got '%s'", flag, strings.Join(allowed, ", "), value))
+	}
+	oneOf("proxmoxve-vm-firewall-enable", d.FirewallEnable, []string{"0", "1"})
+	oneOf("proxmoxve-vm-firewall-policy-in", d.FirewallPolicyIn, firewallPolicies)
+	oneOf("proxmoxve-vm-firewall-policy-out", d.FirewallPolicyOut, firewallPolicies)
+	oneOf("proxmoxve-vm-firewall-log-level-in", d.FirewallLogLevelIn, firewallLogLevels)
+	oneOf("proxmoxve-vm-firewall-log-level-out", d.FirewallLogLevelOut, firewallLogLevels)
+	oneOf("proxmoxve-vm-firewall-macfilter", d.FirewallMacFilter, []string{"0", "1"})
+	return problems
+}
+
+// applyFirewallOptions sets the firewall options of the VM
+func (d *Driver) applyFirewallOptions() error {
+	options := d.firewallOptions()
+	if len(options) == 0 {
+		return nil
+	}
+	if err := d.connect(); err != nil {
+		return err
+	}
+
+	d.debugf("setting firewall options %v", options)
+	path := fmt.Sprintf("/nodes/%s/qemu/%d/firewall/options", d.Node, d.VMID)
+	if err := d.client.Put(context.Background(), path, options, nil); err != nil {
+		return fmt.Errorf("unable to set the firewall options of VM %d: %w", d.VMID, err)
+	}
+	return nil
+}
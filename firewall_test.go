@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FirewallOptions(t *testing.T) {
+	var driver = createDriver()
+	assert.Empty(t, driver.firewallOptions())
+
+	driver.FirewallEnable = "1"
+	driver.FirewallPolicyIn = "drop"
+	driver.FirewallPolicyOut = "ACCEPT"
+	driver.FirewallLogLevelIn = "Info"
+
+	assert.Equal(t, map[string]interface{}{
+		"enable":       "1",
+		"policy_in":    "DROP",
+		"policy_out":   "ACCEPT",
+		"log_level_in": "info",
+	}, driver.firewallOptions())
+	assert.Empty(t, driver.validateFirewall())
+
+	driver.FirewallPolicyIn = "ALLOW"
+	driver.FirewallMacFilter = "yes"
+	assert.Len(t, driver.validateFirewall(), 2)
+}
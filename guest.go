@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// GuestExecResult is the outcome of a command run in the guest via the agent,
+// kept in the machine store for later inspection
+type GuestExecResult struct {
+	Command  string
+	ExitCode int
+	Stdout   string
+	Stderr   string
+}
+
+// agentExecStatus is the response of the agent exec-status endpoint
+type agentExecStatus struct {
+	Exited   int    `json:"exited"`
+	ExitCode int    `json:"exitcode"`
+	OutData  string `json:"out-data"`
+	ErrData  string `json:"err-data"`
+}
+
+// guestExecCommand returns the command line and stdin to run the given
+// --proxmoxve-vm-guest-exec value, file:<path> runs a local script
+func guestExecCommand(value string) ([]string, string, error) {
+	if file, ok := strings.CutPrefix(value, "file:"); ok {
+		script, err := os.ReadFile(file)
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to read guest script: %w", err)
+		}
+		return []string{"/bin/sh"}, string(script), nil
+	}
+	return []string{"/bin/sh", "-c", value}, "", nil
+}
+
+// agentExec runs the command in the guest and waits for it to finish
+func (d *Driver) agentExec(command []string, input string) (*agentExecStatus, error) {
+	if err := d.connect(); err != nil {
+		return nil, err
+	}
+
+	params := map[string]interface{}{"command": command}
+	if len(input) > 0 {
+		params["input-data"] = input
+	}
+
+	var pid struct {
+		Pid int `json:"pid"`
+	}
+	agent := fmt.Sprintf("/nodes/%s/qemu/%d/agent", d.Node, d.VMID)
+	if err := d.client.Post(context.Background(), agent+"/exec", params, &pid); err != nil {
+		return nil, err
+	}
+
+	interval := d.taskInterval
+	if interval < time.Second {
+		interval = time.Second
+	}
+	deadline := time.Now().Add(d.taskTimeout)
+	for {
+		var status agentExecStatus
+		if err := d.client.Get(context.Background(), fmt.Sprintf("%s/exec-status?pid=%d", agent, pid.Pid), &status); err != nil {
+			return nil, err
+		}
+		if status.Exited == 1 {
+			return &status, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("command did not finish within %s", d.taskTimeout)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// runGuestExec runs the --proxmoxve-vm-guest-exec commands in the guest in
+// the given order and stops at the first one failing
+func (d *Driver) runGuestExec() error {
+	d.GuestExecOutput = nil
+	for _, value := range d.GuestExec {
+		command, input, err := guestExecCommand(value)
+		if err != nil {
+			return err
+		}
+
+		d.debugf("running '%s' in the guest", value)
+		status, err := d.agentExec(command, input)
+		if err != nil {
+			return fmt.Errorf("unable to run '%s' in VM %d: %w", value, d.VMID, err)
+		}
+
+		d.GuestExecOutput = append(d.GuestExecOutput, GuestExecResult{
+			Command:  value,
+			ExitCode: status.ExitCode,
+			Stdout:   status.OutData,
+			Stderr:   status.ErrData,
+		})
+		d.debugf("'%s' exited with %d:\n%s%s", value, status.ExitCode, status.OutData, status.ErrData)
+
+		if status.ExitCode != 0 {
+			return fmt.Errorf("'%s' failed in VM %d with exit code %d: %s", value, d.VMID, status.ExitCode, strings.TrimSpace(status.ErrData))
+		}
+	}
+	return nil
+}
+
+// maxGuestFileSize is the largest file the agent file-write endpoint accepts.
+// Its limit of 61440 bytes applies to the base64 encoded content.
+const maxGuestFileSize = 61440 / 4 * 3
+
+// parseGuestFile splits a --proxmoxve-vm-guest-file value into the local source
+// and the absolute destination path in the guest
+func parseGuestFile(value string) (string, string, error) {
+	i := strings.LastIndex(value, ":")
+	if i <= 0 || i == len(value)-1 {
+		return "", "", fmt.Errorf("'%s' must be given as <src>:<dest>", value)
+	}
+	src, dest := value[:i], value[i+1:]
+	if !strings.HasPrefix(dest, "/") {
+		return "", "", fmt.Errorf("destination of '%s' must be an absolute path", value)
+	}
+	return src, dest, nil
+}
+
+// validateGuestFile checks that the source of a guest file is readable and
+// small enough for the agent
+func validateGuestFile(value string) error {
+	src, _, err := parseGuestFile(value)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.Size() > maxGuestFileSize {
+		return fmt.Errorf("%s is larger than %d bytes", src, maxGuestFileSize)
+	}
+	return nil
+}
+
+// copyGuestFiles writes the --proxmoxve-vm-guest-file sources into the guest
+func (d *Driver) copyGuestFiles() error {
+	for _, value := range d.GuestFiles {
+		src, dest, err := parseGuestFile(value)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(src)
+		if err != nil {
+			return fmt.Errorf("unable to read guest file: %w", err)
+		}
+
+		// file-write doesn't create missing directories
+		status, err := d.agentExec([]string{"mkdir", "-p", path.Dir(dest)}, "")
+		if err != nil {
+			return fmt.Errorf("unable to create the directory of %s in VM %d: %w", dest, d.VMID, err)
+		}
+		if status.ExitCode != 0 {
+			return fmt.Errorf("unable to create the directory of %s in VM %d: %s", dest, d.VMID, strings.TrimSpace(status.ErrData))
+		}
+
+		d.debugf("copying %s to %s in the guest", src, dest)
+		params := map[string]interface{}{
+			"file":    dest,
+			"content": base64.StdEncoding.EncodeToString(content),
+			"encode":  0,
+		}
+		if err := d.client.Post(context.Background(), fmt.Sprintf("/nodes/%s/qemu/%d/agent/file-write", d.Node, d.VMID), params, nil); err != nil {
+			return fmt.Errorf("unable to copy %s to %s in VM %d: %w", src, dest, d.VMID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GuestExecCommand(t *testing.T) {
+	command, input, err := guestExecCommand("echo hello")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/bin/sh", "-c", "echo hello"}, command)
+	assert.Equal(t, "", input)
+
+	path := filepath.Join(t.TempDir(), "setup.sh")
+	assert.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\necho hello\n"), 0600))
+
+	command, input, err = guestExecCommand("file:" + path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/bin/sh"}, command)
+	assert.Equal(t, "#!/bin/sh\necho hello\n", input)
+
+	_, _, err = guestExecCommand("file:" + path + ".missing")
+	assert.Error(t, err)
+}
+
+func Test_ParseGuestFile(t *testing.T) {
+	src, dest, err := parseGuestFile("./registries.yaml:/etc/rancher/rke2/registries.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "./registries.yaml", src)
+	assert.Equal(t, "/etc/rancher/rke2/registries.yaml", dest)
+
+	_, _, err = parseGuestFile("registries.yaml")
+	assert.Error(t, err)
+	_, _, err = parseGuestFile("registries.yaml:etc/registries.yaml")
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "ca.crt")
+	assert.NoError(t, os.WriteFile(path, make([]byte, maxGuestFileSize+1), 0600))
+	assert.Error(t, validateGuestFile(path+":/usr/local/share/ca-certificates/ca.crt"))
+	assert.NoError(t, os.WriteFile(path, make([]byte, maxGuestFileSize), 0600))
+	assert.NoError(t, validateGuestFile(path+":/usr/local/share/ca-certificates/ca.crt"))
+	assert.Equal(t, 46080, maxGuestFileSize)
+}
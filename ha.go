@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// haStates are the states an HA resource can be requested in
+var haStates = []string{"started", "stopped", "enabled", "disabled", "ignored"}
+
+// defaultHAState is the state of the HA resource if only the group is given
+const defaultHAState = "started"
+
+// haEnabled returns true if the VM is to be managed by Proxmox VE HA
+func (d *Driver) haEnabled() bool {
+	return len(d.HAGroup) > 0 || len(d.HAState) > 0
+}
+
+// haResourceID returns the id of the VM as HA resource
+func (d *Driver) haResourceID() string {
+	return fmt.Sprintf("vm:%d", d.VMID)
+}
+
+// haParams returns the parameters registering the VM as HA resource
+func (d *Driver) haParams() map[string]interface{} {
+	params := map[string]interface{}{
+		"sid":     d.haResourceID(),
+		"state":   defaultHAState,
+		"comment": "docker-machine " + d.VMName,
+	}
+	if len(d.HAState) > 0 {
+		params["state"] = d.HAState
+	}
+	if len(d.HAGroup) > 0 {
+		params["group"] = d.HAGroup
+	}
+	return params
+}
+
+// validateHAState checks the requested state of the HA resource
+func validateHAState(state string) []string {
+	if len(state) == 0 {
+		return nil
+	}
+	for _, s := range haStates {
+		if s == state {
+			return nil
+		}
+	}
+	return []string{fmt.Sprintf("proxmoxve-vm-ha-state must be one of %v, got '%s'", haStates, state)}
+}
+
+// validateHAGroup checks that the HA group exists
+func (d *Driver) validateHAGroup() []string {
+	if len(d.HAGroup) == 0 {
+		return nil
+	}
+
+	var groups []struct {
+		Group string `json:"group"`
+	}
+	if err := d.client.Get(context.Background(), "/cluster/ha/groups", &groups); err != nil {
+		return []string{fmt.Sprintf("proxmoxve-vm-ha-group: unable to list HA groups: %s", err)}
+	}
+	for _, g := range groups {
+		if g.Group == d.HAGroup {
+			return nil
+		}
+	}
+	return []string{fmt.Sprintf("proxmoxve-vm-ha-group: HA group '%s' does not exist", d.HAGroup)}
+}
+
+// registerHA adds the VM as HA resource, so Proxmox VE restarts it on another
+// node if its node fails
+func (d *Driver) registerHA() error {
+	d.debugf("registering VM %d as HA resource %v", d.VMID, d.haParams())
+	if err := d.client.Post(context.Background(), "/cluster/ha/resources", d.haParams(), nil); err != nil {
+		return fmt.Errorf("unable to register VM %d as HA resource: %w", d.VMID, err)
+	}
+	return nil
+}
+
+// deregisterHA removes the HA resource of the VM before it is stopped and
+// destroyed, so HA doesn't handle the stop or restart the VM. VMs added to HA
+// out of band are deregistered as well, for them a user without access to
+// the HA resources relies on the purge of the delete.
+func (d *Driver) deregisterHA() error {
+	var resources []struct {
+		SID string `json:"sid"`
+	}
+	if err := d.client.Get(context.Background(), "/cluster/ha/resources", &resources); err != nil {
+		if !d.haEnabled() {
+			d.debugf("unable to list HA resources, leaving them to the purge: %s", err)
+			return nil
+		}
+		return fmt.Errorf("unable to list HA resources: %w", err)
+	}
+	for _, r := range resources {
+		if r.SID != d.haResourceID() {
+			continue
+		}
+		d.debugf("removing HA resource %s", r.SID)
+		err := d.client.Delete(context.Background(), "/cluster/ha/resources/"+url.PathEscape(r.SID), nil)
+		if err != nil && !d.haEnabled() {
+			d.debugf("unable to remove HA resource %s, leaving it to the purge: %s", r.SID, err)
+		} else if err != nil {
+			return fmt.Errorf("unable to remove HA resource %s: %w", r.SID, err)
+		}
+	}
+	return nil
+}
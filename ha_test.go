@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HAParams(t *testing.T) {
+	var driver = createDriver()
+	driver.VMID = 105
+	driver.VMName = "worker-1"
+	assert.False(t, driver.haEnabled())
+
+	driver.HAGroup = "rancher"
+	assert.True(t, driver.haEnabled())
+	assert.Equal(t, map[string]interface{}{
+		"sid":     "vm:105",
+		"state":   "started",
+		"group":   "rancher",
+		"comment": "docker-machine worker-1",
+	}, driver.haParams())
+
+	driver.HAGroup = ""
+	driver.HAState = "stopped"
+	assert.True(t, driver.haEnabled())
+	assert.Equal(t, map[string]interface{}{
+		"sid":     "vm:105",
+		"state":   "stopped",
+		"comment": "docker-machine worker-1",
+	}, driver.haParams())
+}
+
+func Test_ValidateHAState(t *testing.T) {
+	assert.Empty(t, validateHAState(""))
+	assert.Empty(t, validateHAState("ignored"))
+	assert.Equal(t, []string{"proxmoxve-vm-ha-state must be one of [started stopped enabled disabled ignored], got 'running'"}, validateHAState("running"))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// parseHeader splits a --proxmoxve-proxmox-header value given as "Name: value"
+func parseHeader(entry string) (string, string, error) {
+	name, value, ok := strings.Cut(entry, ":")
+	name = strings.TrimSpace(name)
+	if !ok || len(name) == 0 || strings.ContainsAny(name, " \t") {
+		return "", "", fmt.Errorf("header '%s' must be given as 'Name: value'", entry)
+	}
+	return http.CanonicalHeaderKey(name), strings.TrimSpace(value), nil
+}
+
+// apiHeaders returns the headers added to every API request, values can be
+// secret references like env:CF_ACCESS_CLIENT_SECRET
+func (d *Driver) apiHeaders() (http.Header, error) {
+	header := make(http.Header)
+	for _, entry := range d.Headers {
+		name, value, err := parseHeader(entry)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = resolveSecret(value); err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		header.Add(name, value)
+	}
+	return header, nil
+}
+
+// headerTransport adds headers to every request, e.g. for Proxmox VE
+// published behind a zero-trust gateway like Cloudflare Access
+type headerTransport struct {
+	base   http.RoundTripper
+	header http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range t.header {
+		req.Header.Del(name)
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HeaderTransport(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer server.Close()
+
+	var driver = createDriver()
+	driver.Headers = []string{"X-Auth-Token: abc", "cf-access-client-id:client.access"}
+	header, err := driver.apiHeaders()
+	assert.Nil(t, err)
+
+	client := &http.Client{Transport: &headerTransport{base: http.DefaultTransport, header: header}}
+	resp, err := client.Get(server.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "abc", got.Get("X-Auth-Token"))
+	assert.Equal(t, "client.access", got.Get("Cf-Access-Client-Id"))
+
+	_, _, err = parseHeader("X-Auth-Token")
+	assert.Error(t, err)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// sources of the IP of the VM
+const (
+	ipSourceAgent  = "agent"
+	ipSourceLease  = "dhcp-lease"
+	ipSourceConfig = "config"
+)
+
+// discoverIP discovers the ip of the VM from IPSource. An empty ip means the
+// VM has none yet.
+func (d *Driver) discoverIP() (string, error) {
+	var ip string
+	var err error
+	switch d.IPSource {
+	case ipSourceConfig:
+		ip, err = d.configIP()
+	case ipSourceLease:
+		ip, err = d.leaseIP()
+	default:
+		return d.agentIP()
+	}
+	if err != nil || ip == "" {
+		return "", err
+	}
+
+	if ip != d.IPAddress {
+		d.debugf("discovered IP address %s via %s (was: '%s')", ip, d.IPSource, d.IPAddress)
+	}
+	d.IPAddress = ip
+	return d.IPAddress, nil
+}
+
+// configAddress returns the static address of an ipconfigN value like
+// ip=10.0.0.5/24,gw=10.0.0.1 for the ip protocol
+func configAddress(ipconfig, protocol string) string {
+	values := parsePropertyString(ipconfig)
+	for _, ipType := range ipAddressTypes(protocol) {
+		key := "ip"
+		if ipType == "ipv6" {
+			key = "ip6"
+		}
+		address, _, _ := strings.Cut(values[key], "/")
+		if net.ParseIP(address) != nil {
+			return address
+		}
+	}
+	return ""
+}
+
+// configIP returns the static address of ipconfig0, set by the template
+func (d *Driver) configIP() (string, error) {
+	config, err := d.getVMConfig(d.Node, d.VMID)
+	if err != nil {
+		return "", err
+	}
+	ipconfig, _ := config["ipconfig0"].(string)
+	ip := configAddress(ipconfig, d.IPProtocol)
+	if ip == "" {
+		return "", fmt.Errorf("ipconfig0 of VM %d has no static %s address: '%s'", d.VMID, d.IPProtocol, ipconfig)
+	}
+	return ip, nil
+}
+
+// ipamEntry is an address of the status of the Proxmox VE IPAM
+type ipamEntry struct {
+	IP  string `json:"ip"`
+	MAC string `json:"mac"`
+}
+
+// leaseAddress returns the address leased to the MAC address for the ip protocol
+func leaseAddress(entries []ipamEntry, mac, protocol string) string {
+	for _, ipType := range ipAddressTypes(protocol) {
+		for _, entry := range entries {
+			ip := net.ParseIP(entry.IP)
+			if ip == nil || !strings.EqualFold(entry.MAC, mac) {
+				continue
+			}
+			if (ip.To4() != nil) == (ipType == "ipv4") {
+				return ip.String()
+			}
+		}
+	}
+	return ""
+}
+
+// hasIPAMEntry returns true if the IPAM tracks the MAC address at all
+func hasIPAMEntry(entries []ipamEntry, mac string) bool {
+	for _, entry := range entries {
+		if strings.EqualFold(entry.MAC, mac) {
+			return true
+		}
+	}
+	return false
+}
+
+// leaseIP returns the address the DHCP server of an SDN zone leased to net0.
+// The node API exposes neither the ARP table nor leases of an external DHCP
+// server on a plain bridge, so this needs a zone with DHCP (Proxmox VE 8.1
+// and later), whose leases are tracked by the pve IPAM. The IPAM entry exists
+// once the VM is started on such a zone, so a missing one is an error rather
+// than waited for.
+func (d *Driver) leaseIP() (string, error) {
+	config, err := d.getVMConfig(d.Node, d.VMID)
+	if err != nil {
+		return "", err
+	}
+	net0, _ := config["net0"].(string)
+	mac := netMACAddress(net0)
+	if mac == "" {
+		return "", fmt.Errorf("net0 of VM %d has no MAC address: '%s'", d.VMID, net0)
+	}
+
+	var entries []ipamEntry
+	if err := d.client.Get(context.Background(), "/cluster/sdn/ipams/pve/status", &entries); err != nil {
+		return "", fmt.Errorf("unable to read the DHCP leases of the SDN IPAM: %w", err)
+	}
+	if !hasIPAMEntry(entries, mac) {
+		return "", fmt.Errorf("the SDN IPAM has no entry for net0 (%s) of VM %d, dhcp-lease needs net0 on an SDN zone with DHCP, use agent or config on other bridges", mac, d.VMID)
+	}
+	return leaseAddress(entries, mac, d.IPProtocol), nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ConfigAddress(t *testing.T) {
+	ipconfig := "ip=10.0.0.5/24,gw=10.0.0.1,ip6=fd00::5/64"
+	assert.Equal(t, "10.0.0.5", configAddress(ipconfig, "ipv4"))
+	assert.Equal(t, "fd00::5", configAddress(ipconfig, "ipv6"))
+	assert.Equal(t, "fd00::5", configAddress("ip=dhcp,ip6=fd00::5/64", "dual"))
+	assert.Equal(t, "", configAddress("ip=dhcp", "ipv4"))
+	assert.Equal(t, "", configAddress("", "ipv4"))
+}
+
+func Test_LeaseAddress(t *testing.T) {
+	entries := []ipamEntry{
+		{IP: "10.0.0.1"},
+		{IP: "10.0.0.20", MAC: "bc:24:11:00:00:02"},
+		{IP: "fd00::21", MAC: "BC:24:11:00:00:01"},
+		{IP: "10.0.0.21", MAC: "bc:24:11:00:00:01"},
+	}
+	assert.Equal(t, "10.0.0.21", leaseAddress(entries, "BC:24:11:00:00:01", "ipv4"))
+	assert.Equal(t, "fd00::21", leaseAddress(entries, "BC:24:11:00:00:01", "ipv6"))
+	assert.Equal(t, "10.0.0.21", leaseAddress(entries, "BC:24:11:00:00:01", "dual"))
+	assert.Equal(t, "", leaseAddress(entries, "BC:24:11:00:00:03", "dual"))
+	assert.True(t, hasIPAMEntry(entries, "bc:24:11:00:00:01"))
+	assert.False(t, hasIPAMEntry(entries, "BC:24:11:00:00:03"))
+
+	var driver = createDriver()
+	driver.IPSource = "arp"
+	assert.Contains(t, driver.validateFlags(), "proxmoxve-ip-source must be agent, dhcp-lease or config, got 'arp'")
+}
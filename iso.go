@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/luthermonson/go-proxmox"
+)
+
+// defaultBridge is used for VMs created from an iso without --proxmoxve-vm-net-bridge
+const defaultBridge = "vmbr0"
+
+// isoOptions returns the options of a VM created from scratch with ImageFile
+// attached. The empty disk comes first in the boot order, so the iso is
+// booted until something is installed to the disk.
+func (d *Driver) isoOptions() []proxmox.VirtualMachineOption {
+	disk := fmt.Sprintf("%s:%s", d.Storage, d.DiskSize)
+	if len(d.StorageType) > 0 {
+		disk += ",format=" + d.StorageType
+	}
+	disk = setDiskOptions(disk, d.bootDiskOptions())
+	net := d.generateNetString()
+	if len(d.NetBridge) == 0 {
+		net = fmt.Sprintf("model=%s,bridge=%s", d.NetModel, defaultBridge)
+	}
+
+	options := []proxmox.VirtualMachineOption{
+		{Name: "name", Value: d.VMName},
+		{Name: "ostype", Value: "l26"},
+		{Name: "memory", Value: d.Memory},
+		{Name: "scsihw", Value: d.scsiController()},
+		{Name: "scsi0", Value: disk},
+		{Name: "ide2", Value: d.ImageFile + ",media=cdrom"},
+		{Name: "boot", Value: "order=scsi0;ide2;net0"},
+		{Name: "net0", Value: net},
+	}
+	options = append(options, d.biosOptions()...)
+	if len(d.Pool) > 0 {
+		options = append(options, proxmox.VirtualMachineOption{Name: "pool", Value: d.Pool})
+	}
+	return options
+}
+
+// createFromISO creates a new VM with an empty disk on Storage booting
+// ImageFile. The iso has to support cloud-init (NoCloud) to receive the ssh
+// key, a cloud-init drive is added for it.
+func (d *Driver) createFromISO(newId int) error {
+	node, err := d.client.Node(context.Background(), d.Node)
+	if err != nil {
+		return err
+	}
+
+	d.debugf("creating new vm %d from iso '%s'", newId, d.ImageFile)
+	task, err := node.NewVirtualMachine(context.Background(), newId, d.isoOptions()...)
+	if err != nil {
+		return err
+	}
+	// from here on a failed creation leaves a VM to clean up
+	d.VMID = newId
+
+	if err := task.Wait(context.Background(), d.taskInterval, d.taskTimeout); err != nil {
+		return err
+	}
+	d.debugf("vm %d created", newId)
+
+	return d.ensureCloudInitDrive()
+}
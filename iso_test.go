@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/luthermonson/go-proxmox"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ISOOptions(t *testing.T) {
+	var driver = createDriver()
+	driver.VMName = "worker-1"
+	driver.Memory = 4 * 1024
+	driver.Storage = "local-lvm"
+	driver.DiskSize = "32"
+	driver.ImageFile = "local:iso/rancheros.iso"
+	driver.ScsiController = "virtio-scsi-single"
+	driver.NetModel = "virtio"
+	driver.Pool = "rancher"
+
+	assert.Equal(t, []proxmox.VirtualMachineOption{
+		{Name: "name", Value: "worker-1"},
+		{Name: "ostype", Value: "l26"},
+		{Name: "memory", Value: 4096},
+		{Name: "scsihw", Value: "virtio-scsi-single"},
+		{Name: "scsi0", Value: "local-lvm:32"},
+		{Name: "ide2", Value: "local:iso/rancheros.iso,media=cdrom"},
+		{Name: "boot", Value: "order=scsi0;ide2;net0"},
+		{Name: "net0", Value: "model=virtio,bridge=vmbr0"},
+		{Name: "pool", Value: "rancher"},
+	}, driver.isoOptions())
+}
+
+func Test_BIOSOptions(t *testing.T) {
+	var driver = createDriver()
+	driver.Storage = "local-lvm"
+
+	assert.Empty(t, driver.biosOptions())
+
+	driver.BIOS = "ovmf"
+	assert.Equal(t, []proxmox.VirtualMachineOption{
+		{Name: "bios", Value: "ovmf"},
+		{Name: "efidisk0", Value: "local-lvm:1,efitype=4m"},
+	}, driver.biosOptions())
+
+	// clones without a storage get the efidisk next to their boot disk
+	driver.Storage = ""
+	assert.Equal(t, "ceph:1,efitype=4m", driver.efiDisk(map[string]interface{}{"boot": "order=scsi0", "scsi0": "ceph:vm-100-disk-0,size=8G"}))
+}
+
+func Test_MachineType(t *testing.T) {
+	var driver = createDriver()
+
+	driver.MachineType = "i440fx"
+	assert.Equal(t, []proxmox.VirtualMachineOption{{Name: "machine", Value: "pc"}}, driver.biosOptions())
+	assert.Empty(t, driver.validateMachineType())
+
+	driver.MachineType = "pc-q35-8.1"
+	driver.HostPci0 = "0000:01:00.0,pcie=1"
+	assert.Empty(t, driver.validateMachineType())
+
+	driver.MachineType = "pc"
+	assert.Equal(t, []string{"proxmoxve-vm-machine-type: devices passed through with pcie=1 require q35, got 'pc'"}, driver.validateMachineType())
+
+	driver.MachineType = "virt"
+	assert.Len(t, driver.validateMachineType(), 1)
+}
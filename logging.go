@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// log formats of the driver debug output
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// redacted replaces secrets in the debug output
+const redacted = "********"
+
+// sshKeyPattern matches public keys, also url encoded as in the sshkeys option
+var sshKeyPattern = regexp.MustCompile(`((?:ssh-(?:rsa|ed25519|dss)|ecdsa-sha2-nistp\d+|sk-[a-z0-9@.-]+)(?:\s|%20)+)AAAA[0-9A-Za-z+/=%]+`)
+
+// logEntry is a line of the json debug output
+type logEntry struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Machine string `json:"machine,omitempty"`
+	Node    string `json:"node,omitempty"`
+	VMID    int    `json:"vmid,omitempty"`
+	Message string `json:"msg"`
+}
+
+// secrets returns the passwords of the driver, as given and resolved
+func (d *Driver) secrets() []string {
+	var secrets []string
+	for _, secret := range []string{d.Password, d.GuestPassword, d.CIPassword} {
+		if len(secret) == 0 {
+			continue
+		}
+		secrets = append(secrets, secret)
+		if plain, err := resolveSecret(secret); err == nil && len(plain) > 0 && plain != secret {
+			secrets = append(secrets, plain)
+		}
+	}
+	return secrets
+}
+
+// redact removes the passwords and the key material of ssh keys from a
+// debug message
+func (d *Driver) redact(message string) string {
+	for _, secret := range d.secrets() {
+		message = strings.ReplaceAll(message, secret, redacted)
+	}
+	return sshKeyPattern.ReplaceAllString(message, "${1}"+redacted)
+}
+
+// logDebug writes a debug message as text or, with LogFormat json, as one
+// json object per line
+func (d *Driver) logDebug(message string) {
+	message = d.redact(message)
+	if d.LogFormat != logFormatJSON {
+		log.Info(message)
+		return
+	}
+
+	entry := logEntry{
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Level:   "debug",
+		Node:    d.Node,
+		VMID:    d.VMID,
+		Message: message,
+	}
+	if d.BaseDriver != nil {
+		entry.Machine = d.MachineName
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Info(message)
+		return
+	}
+	fmt.Fprintln(log.Output(), string(line))
+}
+
+func (d *Driver) debugf(format string, v ...interface{}) {
+	if d.driverDebug {
+		d.logDebug(fmt.Sprintf(format, v...))
+	}
+}
+
+func (d *Driver) debug(v ...interface{}) {
+	if d.driverDebug {
+		d.logDebug(fmt.Sprint(v...))
+	}
+}
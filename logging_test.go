@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Redact(t *testing.T) {
+	var driver = createDriver()
+	driver.Password = "env:TEST_PVE_PASSWORD"
+	driver.GuestPassword = "tcuser"
+	t.Setenv("TEST_PVE_PASSWORD", "s3cret")
+
+	assert.Equal(t, "login with ******** and ********", driver.redact("login with s3cret and tcuser"))
+	assert.Equal(t, "sshkeys: ssh-ed25519%20******** default-1", driver.redact("sshkeys: ssh-ed25519%20AAAAC3NzaC1lZDI1NTE5AAAAI%2Bx%3D default-1"))
+	assert.Equal(t, "- ssh-rsa ******** default-1", driver.redact("- ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQ+/= default-1"))
+}
+
+func Test_LogFormatJSON(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stdout)
+
+	var driver = createDriver()
+	driver.LogFormat = logFormatJSON
+	driver.Node = "pve1"
+	driver.VMID = 123
+	driver.GuestPassword = "tcuser"
+	driver.debugf("password is %s", "tcuser")
+
+	var entry logEntry
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "debug", entry.Level)
+	assert.Equal(t, "default", entry.Machine)
+	assert.Equal(t, "pve1", entry.Node)
+	assert.Equal(t, 123, entry.VMID)
+	assert.Equal(t, "password is ********", entry.Message)
+}
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"os"
+
 	"github.com/rancher/machine/libmachine/drivers/plugin"
 )
 
+// version of the driver, set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
+	}
 	plugin.RegisterDriver(NewDriver("default", ""))
 }
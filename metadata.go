@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var invalidTagChars = regexp.MustCompile(`[^a-z0-9_+.-]+`)
+
+// sanitizeTag turns the given value into a valid Proxmox VE tag
+func sanitizeTag(value string) string {
+	tag := invalidTagChars.ReplaceAllString(strings.ToLower(strings.TrimSpace(value)), "-")
+	return strings.TrimLeft(tag, "-+.")
+}
+
+// splitTags splits the tags of a VM config, which are separated by ; , or space
+func splitTags(tags string) []string {
+	return strings.FieldsFunc(tags, func(r rune) bool {
+		return r == ';' || r == ',' || r == ' '
+	})
+}
+
+// mergeTags adds the given tags to the existing ones, skipping duplicates
+func mergeTags(existing string, tags ...string) string {
+	merged := splitTags(existing)
+	for _, tag := range tags {
+		found := false
+		for _, t := range merged {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found && len(tag) > 0 {
+			merged = append(merged, tag)
+		}
+	}
+	return strings.Join(merged, ";")
+}
+
+// clusterTag returns the tag identifying the owning Rancher cluster, prefixed
+// so it can't be mistaken for a node pool or a tag set by hand
+func (d *Driver) clusterTag() string {
+	if tag := sanitizeTag(d.RancherCluster); len(tag) > 0 {
+		return "rancher-cluster-" + tag
+	}
+	return ""
+}
+
+// nodePoolTag returns the tag identifying the owning Rancher node pool, which
+// includes the cluster as pools of different clusters may share the name
+func (d *Driver) nodePoolTag() string {
+	pool := sanitizeTag(d.RancherNodePool)
+	if len(pool) == 0 {
+		return ""
+	}
+	if cluster := sanitizeTag(d.RancherCluster); len(cluster) > 0 {
+		pool = cluster + "-" + pool
+	}
+	return "rancher-pool-" + pool
+}
+
+// clusterTags returns the tags identifying the owning Rancher cluster and node pool
+func (d *Driver) clusterTags() []string {
+	var tags []string
+	if tag := d.clusterTag(); len(tag) > 0 {
+		tags = append(tags, tag)
+	}
+	if tag := d.nodePoolTag(); len(tag) > 0 {
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// applyClusterIdentity tags the VM with the owning Rancher cluster and node pool
+func (d *Driver) applyClusterIdentity() error {
+	tags := d.clusterTags()
+	if len(tags) == 0 {
+		return nil
+	}
+
+	config, err := d.getVMConfig(d.Node, d.VMID)
+	if err != nil {
+		return err
+	}
+
+	existingTags, _ := config["tags"].(string)
+	return d.ConfigureVM("tags", mergeTags(existingTags, tags...))
+}
+
+// descriptionData holds the variables available in --proxmoxve-vm-description-template
+type descriptionData struct {
+	MachineName string // docker-machine name
+	VMName      string // name of the VM
+	Cluster     string // owning Rancher cluster
+	NodePool    string // owning Rancher node pool
+	Created     string // creation time, RFC 3339
+	Version     string // driver version
+	Template    string // VMID of the clone source, empty for VMs created from scratch
+	Node        string // proxmox node
+}
+
+// defaultDescriptionTemplate traces the VM back to the machine it was created for
+const defaultDescriptionTemplate = `machine: {{.MachineName}}
+{{- if .Cluster}}
+rancher-cluster: {{.Cluster}}
+{{- end}}
+{{- if .NodePool}}
+rancher-node-pool: {{.NodePool}}
+{{- end}}
+created: {{.Created}}
+driver: docker-machine-driver-proxmoxve {{.Version}}
+{{- if .Template}}
+template: {{.Template}}
+{{- end}}`
+
+// renderDescription returns the provisioning metadata written to the VM
+// description, rendered from the description template if one is given
+func (d *Driver) renderDescription(created time.Time) (string, error) {
+	text := d.DescriptionTemplate
+	if len(text) == 0 {
+		text = defaultDescriptionTemplate
+	}
+	tmpl, err := template.New("description").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	data := descriptionData{
+		MachineName: d.MachineName,
+		VMName:      d.VMName,
+		Cluster:     d.RancherCluster,
+		NodePool:    d.RancherNodePool,
+		Created:     created.UTC().Format(time.RFC3339),
+		Version:     version,
+		Template:    d.CloneVMID,
+		Node:        d.Node,
+	}
+
+	var description bytes.Buffer
+	if err := tmpl.Execute(&description, data); err != nil {
+		return "", err
+	}
+	return description.String(), nil
+}
+
+// applyDescription appends the provisioning metadata to the description the
+// VM inherited from its template. Minimal clones keep the description of the
+// template, their user may not write the config.
+func (d *Driver) applyDescription() error {
+	if d.CloneMinimal {
+		d.debugf("minimal clone mode, leaving the description of the template")
+		return nil
+	}
+	metadata, err := d.renderDescription(time.Now())
+	if err != nil {
+		return err
+	}
+
+	config, err := d.getVMConfig(d.Node, d.VMID)
+	if err != nil {
+		return err
+	}
+
+	description, _ := config["description"].(string)
+	if len(description) > 0 {
+		description = strings.TrimRight(description, "\n") + "\n\n"
+	}
+	return d.ConfigureVM("description", description+metadata)
+}
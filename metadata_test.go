@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ClusterTags(t *testing.T) {
+	var driver = createDriver()
+	driver.RancherCluster = "Prod Cluster"
+	driver.RancherNodePool = "workers"
+
+	assert.Equal(t, []string{"rancher-cluster-prod-cluster", "rancher-pool-prod-cluster-workers"}, driver.clusterTags())
+
+	driver.RancherCluster = ""
+	assert.Equal(t, []string{"rancher-pool-workers"}, driver.clusterTags())
+}
+
+func Test_RenderDescription(t *testing.T) {
+	var driver = createDriver()
+	driver.MachineName = "prod-worker-1"
+	driver.RancherCluster = "Prod Cluster"
+	driver.CloneVMID = "9000"
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	description, err := driver.renderDescription(created)
+	assert.Nil(t, err)
+	assert.Equal(t, "machine: prod-worker-1\nrancher-cluster: Prod Cluster\ncreated: 2024-05-01T12:00:00Z\ndriver: docker-machine-driver-proxmoxve dev\ntemplate: 9000", description)
+
+	driver.DescriptionTemplate = "{{.MachineName}} ({{.NodePool}})"
+	driver.RancherNodePool = "workers"
+	description, err = driver.renderDescription(created)
+	assert.Nil(t, err)
+	assert.Equal(t, "prod-worker-1 (workers)", description)
+}
+
+func Test_ApplyDescription(t *testing.T) {
+	var requests []string
+	driver := createAPIDriver(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"data":{"description":"template"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	// the config of a minimal clone is never written
+	driver.CloneMinimal = true
+	assert.Nil(t, driver.applyDescription())
+	assert.Empty(t, requests)
+
+	driver.CloneMinimal = false
+	assert.NotNil(t, driver.applyDescription())
+	assert.Contains(t, requests, "GET /api2/json/nodes/pve1/qemu/101/config")
+}
+
+func Test_MergeTags(t *testing.T) {
+	assert.Equal(t, "template;ubuntu;prod-cluster", mergeTags("template;ubuntu", "prod-cluster", "ubuntu"))
+	assert.Equal(t, "prod-cluster", mergeTags("", "prod-cluster"))
+	assert.Equal(t, "a;b", mergeTags("a,b", ""))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/luthermonson/go-proxmox"
+)
+
+// checkMigrationTarget checks that the target node is an online node of the
+// cluster
+func checkMigrationTarget(nodes []clusterNode, target string) error {
+	for _, n := range nodes {
+		if n.Node != target {
+			continue
+		}
+		if n.Status != "online" {
+			return fmt.Errorf("node %s is %s", target, n.Status)
+		}
+		return nil
+	}
+	return fmt.Errorf("node %s not found in the cluster", target)
+}
+
+// Migrate moves the VM to the target node, online if it is running, waits for
+// the migration and updates Node. The VM is looked up in the cluster first,
+// it may have been migrated out of band.
+func (d *Driver) Migrate(target string) error {
+	if err := d.connect(); err != nil {
+		return err
+	}
+
+	vm, err := d.getClusterVM()
+	if err != nil {
+		return err
+	}
+	d.Node = vm.Node
+	if target == d.Node {
+		d.debugf("VM %d is on node %s already", d.VMID, target)
+		return nil
+	}
+
+	nodes, err := d.getClusterNodes()
+	if err != nil {
+		return err
+	}
+	if err := checkMigrationTarget(nodes, target); err != nil {
+		return fmt.Errorf("unable to migrate VM %d: %w", d.VMID, err)
+	}
+	if d.NodeForward {
+		// the forward is added to the new node when the guest is reached next
+		d.removeForward()
+	}
+	return d.migrateVM(target, vm.Status == "running")
+}
+
+// migrateVM migrates the VM to the target node, including its local disks,
+// and waits for the task. A running VM is migrated online. The disks are moved
+// to Storage if given.
+func (d *Driver) migrateVM(target string, online bool) error {
+	if err := d.connect(); err != nil {
+		return err
+	}
+
+	params := map[string]interface{}{"target": target}
+	if online {
+		params["online"] = 1
+		params["with-local-disks"] = 1
+	}
+	if len(d.Storage) > 0 {
+		params["targetstorage"] = d.Storage
+	}
+
+	d.debugf("migrating VM %d from node %s to node %s (online: %t)", d.VMID, d.Node, target, online)
+	var upid proxmox.UPID
+	if err := d.client.Post(context.Background(), fmt.Sprintf("/nodes/%s/qemu/%d/migrate", d.Node, d.VMID), params, &upid); err != nil {
+		return fmt.Errorf("unable to migrate VM %d to node %s: %w", d.VMID, target, err)
+	}
+	if err := proxmox.NewTask(upid, d.client).Wait(context.Background(), d.taskInterval, d.taskTimeout); err != nil {
+		return fmt.Errorf("unable to migrate VM %d to node %s: %w", d.VMID, target, err)
+	}
+	d.Node = target
+	d.ConsoleURL = d.consoleURL()
+	return nil
+}
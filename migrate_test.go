@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CheckMigrationTarget(t *testing.T) {
+	nodes := []clusterNode{
+		{Node: "pve1", Status: "online"},
+		{Node: "pve2", Status: "offline"},
+	}
+
+	assert.Nil(t, checkMigrationTarget(nodes, "pve1"))
+	assert.EqualError(t, checkMigrationTarget(nodes, "pve2"), "node pve2 is offline")
+	assert.EqualError(t, checkMigrationTarget(nodes, "pve3"), "node pve3 not found in the cluster")
+}
+
+func Test_SaveMachine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	config := `{"ConfigVersion": 3, "DriverName": "proxmoxve", "Driver": {"Node": "pve1", "VMID": "105"}, "Name": "worker-1"}`
+	assert.Nil(t, os.WriteFile(path, []byte(config), 0600))
+
+	d, err := loadMachine(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 105, d.VMID)
+	d.Node = "pve2"
+	assert.Nil(t, saveMachine(dir, d))
+
+	d, err = loadMachine(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "pve2", d.Node)
+	assert.Equal(t, 105, d.VMID)
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"Name": "worker-1"`)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// maxVMNameLength is the maximum length of a dns name label accepted by Proxmox VE
+const maxVMNameLength = 63
+
+var (
+	invalidNameChars  = regexp.MustCompile(`[^a-z0-9.-]+`)
+	repeatedNameDelim = regexp.MustCompile(`-{2,}`)
+	trailingIndex     = regexp.MustCompile(`(\d+)$`)
+)
+
+// vmNameData holds the variables available in --proxmoxve-vm-name-template
+type vmNameData struct {
+	Name   string // machine name
+	Pool   string // proxmox pool
+	Node   string // proxmox node
+	Index  string // trailing number of the machine name (if any)
+	Random string // random suffix of 5 characters
+}
+
+// renderVMName returns the sanitized name of the VM, rendered from the name
+// template if one is given
+func (d *Driver) renderVMName() (string, error) {
+	if len(d.VMNameTemplate) == 0 {
+		return sanitizeVMName(d.MachineName), nil
+	}
+
+	tmpl, err := template.New("name").Parse(d.VMNameTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	data := vmNameData{
+		Name:   d.MachineName,
+		Pool:   d.Pool,
+		Node:   d.Node,
+		Index:  trailingIndex.FindString(d.MachineName),
+		Random: randomSuffix(5),
+	}
+
+	var name bytes.Buffer
+	if err := tmpl.Execute(&name, data); err != nil {
+		return "", err
+	}
+
+	return sanitizeVMName(name.String()), nil
+}
+
+// sanitizeVMName turns the given name into a dns safe name. Long names keep
+// their unique tail, as generated names usually only differ at the end.
+func sanitizeVMName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = invalidNameChars.ReplaceAllString(name, "-")
+	name = repeatedNameDelim.ReplaceAllString(name, "-")
+	name = strings.Trim(name, "-.")
+
+	if len(name) > maxVMNameLength {
+		tail := name[len(name)-20:]
+		name = strings.TrimRight(name[:maxVMNameLength-len(tail)-1], "-.") + "-" + strings.TrimLeft(tail, "-.")
+	}
+
+	return name
+}
+
+func randomSuffix(n int) string {
+	const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = chars[rand.Intn(len(chars))]
+	}
+	return string(b)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SanitizeVMName(t *testing.T) {
+	assert.Equal(t, "my-machine-01", sanitizeVMName("My_Machine 01"))
+	assert.Equal(t, "rancher-pool.example", sanitizeVMName("--rancher--pool.example.--"))
+
+	long := "c-m-abcdefgh-" + strings.Repeat("workerpool", 6) + "-7d9f8c6b5-xk2lp"
+	name := sanitizeVMName(long)
+	assert.True(t, len(name) <= maxVMNameLength)
+	// the unique suffix is kept
+	assert.True(t, strings.HasSuffix(name, "-7d9f8c6b5-xk2lp"))
+}
+
+func Test_RenderVMName(t *testing.T) {
+	var driver = createDriver()
+	driver.MachineName = "Worker_3"
+	driver.Pool = "Rancher"
+	driver.Node = "pve01"
+
+	name, err := driver.renderVMName()
+	assert.Nil(t, err)
+	assert.Equal(t, "worker-3", name)
+
+	driver.VMNameTemplate = "{{.Pool}}-{{.Node}}-w{{.Index}}-{{.Random}}"
+	name, err = driver.renderVMName()
+	assert.Nil(t, err)
+	assert.Regexp(t, "^rancher-pve01-w3-[a-z0-9]{5}$", name)
+
+	driver.VMNameTemplate = "{{.Cluster}}"
+	_, err = driver.renderVMName()
+	assert.NotNil(t, err)
+}
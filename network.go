@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luthermonson/go-proxmox"
+)
+
+// netMACAddress returns the MAC address of a netN config value like
+// virtio=BC:24:11:00:00:01,bridge=vmbr0
+func netMACAddress(value string) string {
+	model, _, _ := strings.Cut(value, ",")
+	if _, mac, ok := strings.Cut(model, "="); ok {
+		if _, err := net.ParseMAC(mac); err == nil {
+			return mac
+		}
+	}
+	return ""
+}
+
+// staticIP returns true if the guest address is configured via cloud-init
+// instead of being leased by DHCP
+func (d *Driver) staticIP() bool {
+	return len(d.CloudInitIP) > 0
+}
+
+// staticIPAddress returns the configured guest address and its prefix length.
+// The address is either given in CIDR notation or combined with the netmask,
+// which may be a prefix length (24) or dotted (255.255.255.0).
+func (d *Driver) staticIPAddress() (net.IP, int, error) {
+	if ip, ipNet, err := net.ParseCIDR(d.CloudInitIP); err == nil {
+		// ipconfig0 takes IPv6 addresses as ip6= only
+		if ip.To4() == nil {
+			return nil, 0, fmt.Errorf("'%s' is not an IPv4 address", d.CloudInitIP)
+		}
+		if len(d.CloudInitNetmask) > 0 {
+			return nil, 0, fmt.Errorf("'%s' already contains a prefix length, drop the netmask '%s'", d.CloudInitIP, d.CloudInitNetmask)
+		}
+		prefix, _ := ipNet.Mask.Size()
+		return ip, prefix, nil
+	}
+
+	ip := net.ParseIP(d.CloudInitIP).To4()
+	if ip == nil {
+		return nil, 0, fmt.Errorf("'%s' is not an IPv4 address", d.CloudInitIP)
+	}
+	if len(d.CloudInitNetmask) == 0 {
+		return nil, 0, fmt.Errorf("'%s' needs a netmask, either in CIDR notation or via --proxmoxve-vm-cloud-init-netmask", d.CloudInitIP)
+	}
+	if prefix, err := strconv.Atoi(d.CloudInitNetmask); err == nil {
+		if prefix < 1 || prefix > 32 {
+			return nil, 0, fmt.Errorf("netmask '%s' must be between 1 and 32", d.CloudInitNetmask)
+		}
+		return ip, prefix, nil
+	}
+	mask := net.ParseIP(d.CloudInitNetmask).To4()
+	if mask == nil {
+		return nil, 0, fmt.Errorf("netmask '%s' is neither a prefix length nor dotted", d.CloudInitNetmask)
+	}
+	prefix, bits := net.IPMask(mask).Size()
+	if bits == 0 || prefix == 0 {
+		return nil, 0, fmt.Errorf("netmask '%s' is not contiguous", d.CloudInitNetmask)
+	}
+	return ip, prefix, nil
+}
+
+// staticIPConfig returns the ipconfig0 value for the configured address, like
+// ip=10.0.0.5/24,gw=10.0.0.1
+func (d *Driver) staticIPConfig() (string, error) {
+	ip, prefix, err := d.staticIPAddress()
+	if err != nil {
+		return "", err
+	}
+	config := fmt.Sprintf("ip=%s/%d", ip, prefix)
+	if len(d.CloudInitGateway) > 0 {
+		config += ",gw=" + d.CloudInitGateway
+	}
+	return config, nil
+}
+
+// validateStaticIP checks the static address, netmask and gateway
+func (d *Driver) validateStaticIP() []string {
+	if !d.staticIP() {
+		if len(d.CloudInitGateway) > 0 || len(d.CloudInitNetmask) > 0 {
+			return []string{"proxmoxve-vm-cloud-init-gateway and proxmoxve-vm-cloud-init-netmask require proxmoxve-vm-cloud-init-ip"}
+		}
+		return nil
+	}
+
+	ip, prefix, err := d.staticIPAddress()
+	if err != nil {
+		return []string{"proxmoxve-vm-cloud-init-ip: " + err.Error()}
+	}
+	if len(d.CloudInitGateway) > 0 {
+		gw := net.ParseIP(d.CloudInitGateway).To4()
+		if gw == nil {
+			return []string{fmt.Sprintf("proxmoxve-vm-cloud-init-gateway: '%s' is not an IPv4 address", d.CloudInitGateway)}
+		}
+		subnet := net.IPNet{IP: ip.Mask(net.CIDRMask(prefix, 32)), Mask: net.CIDRMask(prefix, 32)}
+		if !subnet.Contains(gw) {
+			return []string{fmt.Sprintf("proxmoxve-vm-cloud-init-gateway: %s is not within %s", gw, subnet.String())}
+		}
+	}
+	return nil
+}
+
+// nameservers returns the Nameserver addresses, which may be separated by
+// commas or spaces
+func (d *Driver) nameservers() []string {
+	return strings.FieldsFunc(d.Nameserver, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// searchdomains returns the Searchdomain domains, which may be separated by
+// commas or spaces
+func (d *Driver) searchdomains() []string {
+	return strings.FieldsFunc(d.Searchdomain, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// validateDNS checks that the nameservers are IP addresses
+func (d *Driver) validateDNS() []string {
+	var problems []string
+	for _, ns := range d.nameservers() {
+		if net.ParseIP(ns) == nil {
+			problems = append(problems, fmt.Sprintf("proxmoxve-vm-nameserver: '%s' is not an IP address", ns))
+		}
+	}
+	return problems
+}
+
+// dnsOptions returns the cloud-init DNS options of the VM, empty values
+// keep the resolvers of the template (or of the node)
+func (d *Driver) dnsOptions() []proxmox.VirtualMachineOption {
+	return []proxmox.VirtualMachineOption{
+		{Name: "nameserver", Value: strings.Join(d.nameservers(), " ")},
+		{Name: "searchdomain", Value: strings.Join(d.searchdomains(), " ")},
+	}
+}
+
+// getNodeBridges returns the bridges (linux and OVS) of the node
+func (d *Driver) getNodeBridges(node string) ([]string, error) {
+	if err := d.connect(); err != nil {
+		return nil, err
+	}
+
+	var ifaces []struct {
+		Iface string `json:"iface"`
+	}
+	if err := d.client.Get(context.Background(), fmt.Sprintf("/nodes/%s/network?type=any_bridge", node), &ifaces); err != nil {
+		return nil, err
+	}
+	var bridges []string
+	for _, i := range ifaces {
+		bridges = append(bridges, i.Iface)
+	}
+	return bridges, nil
+}
+
+// validateBridge checks that the bridge net0 is attached to exists on the node
+func (d *Driver) validateBridge() []string {
+	bridge := d.NetBridge
+	if len(bridge) == 0 {
+		if len(d.CloneVMID) > 0 {
+			// net0 of the template is kept
+			return nil
+		}
+		bridge = defaultBridge
+	}
+
+	bridges, err := d.getNodeBridges(d.Node)
+	if err != nil {
+		return []string{fmt.Sprintf("proxmoxve-vm-net-bridge: unable to list the bridges of node '%s': %s", d.Node, err)}
+	}
+	for _, b := range bridges {
+		if b == bridge {
+			return nil
+		}
+	}
+	return []string{fmt.Sprintf("proxmoxve-vm-net-bridge: bridge '%s' not found on node '%s' (bridges: %s)", bridge, d.Node, strings.Join(bridges, ", "))}
+}
+
+// virtualInterfacePrefixes are name prefixes of interfaces created inside the
+// guest by container runtimes, CNI plugins and VPNs
+var virtualInterfacePrefixes = []string{
+	"lo", "docker", "br-", "veth", "cni", "flannel", "cali", "vxlan", "kube-ipvs", "cilium", "lxc", "weave", "tun", "tap", "wg", "tailscale", "zt", "virbr",
+	// calico ipip, kube-router, node-local-dns, antrea, ovn-kubernetes and podman
+	"tunl", "kube-bridge", "kube-dummy", "nodelocaldns", "antrea", "genev", "ovn", "podman",
+}
+
+// virtualMACPrefixes are MAC address prefixes of such interfaces, e.g. the
+// docker bridge and the calico veths
+var virtualMACPrefixes = []string{
+	"02:42:", "ee:ee:ee:ee:ee:ee",
+}
+
+// isVirtualInterface returns true if the guest interface doesn't carry the
+// address of the node itself
+func isVirtualInterface(iface *proxmox.AgentNetworkIface) bool {
+	name := strings.ToLower(iface.Name)
+	for _, prefix := range virtualInterfacePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	mac := strings.ToLower(iface.HardwareAddress)
+	if mac == "" || mac == "00:00:00:00:00:00" {
+		return true
+	}
+	for _, prefix := range virtualMACPrefixes {
+		if strings.HasPrefix(mac, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipAddressTypes returns the agent address types accepted for the ip protocol,
+// in order of preference
+func ipAddressTypes(protocol string) []string {
+	switch protocol {
+	case "ipv6":
+		return []string{"ipv6"}
+	case "dual":
+		return []string{"ipv4", "ipv6"}
+	default:
+		return []string{"ipv4"}
+	}
+}
+
+// ipFilter restricts the guest addresses the IP is selected from
+type ipFilter struct {
+	Interface string     // name of the guest interface, any if empty
+	Network   *net.IPNet // subnet of the address, any if nil
+}
+
+// ipFilter returns the filter given by IPInterface and IPCIDR
+func (d *Driver) ipFilter() (ipFilter, error) {
+	filter := ipFilter{Interface: d.IPInterface}
+	if len(d.IPCIDR) > 0 {
+		_, network, err := net.ParseCIDR(d.IPCIDR)
+		if err != nil {
+			return filter, err
+		}
+		filter.Network = network
+	}
+	return filter, nil
+}
+
+// ipAddress returns the first routable address of the interface of the given
+// types, skipping loopback and link-local (169.254/16, fe80::/10) addresses
+// and those outside the subnet of the filter
+func ipAddress(iface *proxmox.AgentNetworkIface, types []string, filter ipFilter) string {
+	for _, ipType := range types {
+		for _, ip := range iface.IPAddresses {
+			if ip.IPAddressType != ipType {
+				continue
+			}
+			addr := net.ParseIP(ip.IPAddress)
+			if addr == nil || addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+				continue
+			}
+			if filter.Network != nil && !filter.Network.Contains(addr) {
+				continue
+			}
+			return ip.IPAddress
+		}
+	}
+	return ""
+}
+
+// selectInterface returns the address and MAC of the guest interface attached
+// to net0. If no interface matches the MAC of net0, the first interface that
+// isn't virtual is used instead. Interfaces of container runtimes and CNI
+// plugins are never used, so a re-detection after Kubernetes started doesn't
+// return an overlay address. With an interface name in the filter only
+// that interface is considered.
+func selectInterface(iFaces []*proxmox.AgentNetworkIface, net0, protocol string, filter ipFilter) (string, string) {
+	types := ipAddressTypes(protocol)
+	if len(filter.Interface) > 0 {
+		for _, iface := range iFaces {
+			if iface.Name == filter.Interface {
+				return ipAddress(iface, types, filter), iface.HardwareAddress
+			}
+		}
+		return "", ""
+	}
+
+	// a CNI plugin may reuse the MAC of net0 for its own interfaces, e.g. a
+	// bridge or the host side of a veth, so those are skipped in any case
+	net0 = strings.ToLower(net0)
+	for _, iface := range iFaces {
+		if iface.HardwareAddress == "" || !strings.Contains(net0, strings.ToLower(iface.HardwareAddress)) || isVirtualInterface(iface) {
+			continue
+		}
+		if ip := ipAddress(iface, types, filter); ip != "" {
+			return ip, iface.HardwareAddress
+		}
+	}
+
+	for _, iface := range iFaces {
+		if isVirtualInterface(iface) {
+			continue
+		}
+		if ip := ipAddress(iface, types, filter); ip != "" {
+			return ip, iface.HardwareAddress
+		}
+	}
+	return "", ""
+}
+
+// waitForStableIP polls the guest agent until the discovered IP address stayed
+// the same and reachable via SSH for IPStablePolls consecutive polls, as some
+// guests briefly hold a link-local or DHCP offered address before settling
+func (d *Driver) waitForStableIP() (string, error) {
+	interval := d.taskInterval
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return d.pollStableIP(d.discoverIP, d.isReachable, interval)
+}
+
+// pollStableIP polls discover every interval until the address stayed the same
+// and reachable for IPStablePolls consecutive polls, or taskTimeout elapsed
+func (d *Driver) pollStableIP(discover func() (string, error), reachable func(string) bool, interval time.Duration) (string, error) {
+	deadline := time.Now().Add(d.taskTimeout)
+
+	last, stable := "", 0
+	for {
+		ip, err := discover()
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case ip == "" || !reachable(ip):
+			stable = 0
+		case ip == last:
+			stable++
+		default:
+			stable = 1
+		}
+		last = ip
+		d.debugf("IP address '%s' stable for %d of %d polls", ip, stable, d.IPStablePolls)
+
+		if stable >= d.IPStablePolls {
+			return ip, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("IP address of VM %d did not settle within %s, last seen '%s'", d.VMID, d.taskTimeout, last)
+		}
+		time.Sleep(interval)
+	}
+}
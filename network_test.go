@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/luthermonson/go-proxmox"
+	"github.com/stretchr/testify/assert"
+)
+
+func iface(name, mac string, ips ...string) *proxmox.AgentNetworkIface {
+	i := &proxmox.AgentNetworkIface{Name: name, HardwareAddress: mac}
+	for _, ip := range ips {
+		i.IPAddresses = append(i.IPAddresses, &proxmox.AgentNetworkIPAddress{IPAddressType: "ipv4", IPAddress: ip})
+	}
+	return i
+}
+
+func Test_SelectInterface(t *testing.T) {
+	iFaces := []*proxmox.AgentNetworkIface{
+		iface("lo", "00:00:00:00:00:00", "127.0.0.1"),
+		iface("docker0", "02:42:ac:11:00:01", "172.17.0.1"),
+		iface("flannel.1", "5e:1c:3b:aa:00:01", "10.42.0.0"),
+		iface("eth0", "BC:24:11:00:00:01", "169.254.10.1", "192.168.1.10"),
+	}
+
+	ip, mac := selectInterface(iFaces, "virtio=BC:24:11:00:00:01,bridge=vmbr0", "ipv4", ipFilter{})
+	assert.Equal(t, "192.168.1.10", ip)
+	assert.Equal(t, "BC:24:11:00:00:01", mac)
+
+	// fallback when the MAC of net0 is not reported by the agent
+	ip, mac = selectInterface(iFaces, "virtio=BC:24:11:FF:FF:FF,bridge=vmbr0", "ipv4", ipFilter{})
+	assert.Equal(t, "192.168.1.10", ip)
+	assert.Equal(t, "BC:24:11:00:00:01", mac)
+
+	ip, _ = selectInterface(iFaces[:3], "virtio=BC:24:11:FF:FF:FF,bridge=vmbr0", "ipv4", ipFilter{})
+	assert.Equal(t, "", ip)
+}
+
+func Test_SelectInterfaceSkipsOverlays(t *testing.T) {
+	iFaces := []*proxmox.AgentNetworkIface{
+		// a bridge created by a CNI plugin holding the MAC of net0
+		iface("cni0", "BC:24:11:00:00:01", "10.42.0.1"),
+		iface("tunl0", "", "10.42.0.2"),
+		iface("cali1a2b3c", "ee:ee:ee:ee:ee:ee", "10.42.0.3"),
+		iface("flannel.1", "5e:1c:3b:aa:00:01", "10.42.0.0"),
+		iface("ens18", "BC:24:11:00:00:01", "192.168.1.10"),
+	}
+
+	ip, mac := selectInterface(iFaces, "virtio=BC:24:11:00:00:01,bridge=vmbr0", "ipv4", ipFilter{})
+	assert.Equal(t, "192.168.1.10", ip)
+	assert.Equal(t, "BC:24:11:00:00:01", mac)
+
+	for _, i := range iFaces[:4] {
+		assert.True(t, isVirtualInterface(i), i.Name)
+	}
+	assert.False(t, isVirtualInterface(iFaces[4]))
+}
+
+func Test_SelectInterfaceFilter(t *testing.T) {
+	iFaces := []*proxmox.AgentNetworkIface{
+		iface("eth0", "BC:24:11:00:00:01", "192.168.1.10"),
+		iface("eth1", "BC:24:11:00:00:02", "10.10.0.10"),
+	}
+	net0 := "virtio=BC:24:11:00:00:01,bridge=vmbr0"
+
+	var driver = createDriver()
+	driver.IPCIDR = "10.10.0.0/16"
+	filter, err := driver.ipFilter()
+	assert.Nil(t, err)
+	ip, mac := selectInterface(iFaces, net0, "ipv4", filter)
+	assert.Equal(t, "10.10.0.10", ip)
+	assert.Equal(t, "BC:24:11:00:00:02", mac)
+
+	ip, _ = selectInterface(iFaces, net0, "ipv4", ipFilter{Interface: "eth1"})
+	assert.Equal(t, "10.10.0.10", ip)
+	ip, _ = selectInterface(iFaces, net0, "ipv4", ipFilter{Interface: "eth2"})
+	assert.Equal(t, "", ip)
+
+	driver.IPCIDR = "10.10.0.0"
+	assert.Contains(t, driver.validateFlags(), "proxmoxve-ip-cidr must be a subnet like 10.0.0.0/24, got '10.10.0.0'")
+}
+
+func Test_SelectInterfaceIPv6(t *testing.T) {
+	eth0 := iface("eth0", "BC:24:11:00:00:01")
+	for _, ip := range []string{"fe80::be24:11ff:fe00:1", "2001:db8::10"} {
+		eth0.IPAddresses = append(eth0.IPAddresses, &proxmox.AgentNetworkIPAddress{IPAddressType: "ipv6", IPAddress: ip})
+	}
+	net0 := "virtio=BC:24:11:00:00:01,bridge=vmbr0"
+
+	ip, _ := selectInterface([]*proxmox.AgentNetworkIface{eth0}, net0, "ipv4", ipFilter{})
+	assert.Equal(t, "", ip)
+	ip, _ = selectInterface([]*proxmox.AgentNetworkIface{eth0}, net0, "ipv6", ipFilter{})
+	assert.Equal(t, "2001:db8::10", ip)
+	ip, _ = selectInterface([]*proxmox.AgentNetworkIface{eth0}, net0, "dual", ipFilter{})
+	assert.Equal(t, "2001:db8::10", ip)
+
+	// dual prefers ipv4
+	eth0.IPAddresses = append(eth0.IPAddresses, &proxmox.AgentNetworkIPAddress{IPAddressType: "ipv4", IPAddress: "192.168.1.10"})
+	ip, _ = selectInterface([]*proxmox.AgentNetworkIface{eth0}, net0, "dual", ipFilter{})
+	assert.Equal(t, "192.168.1.10", ip)
+}
+
+func Test_StaticIPConfig(t *testing.T) {
+	var driver = createDriver()
+	assert.False(t, driver.staticIP())
+	assert.Empty(t, driver.validateStaticIP())
+
+	driver.CloudInitIP = "10.0.0.5/24"
+	driver.CloudInitGateway = "10.0.0.1"
+	config, err := driver.staticIPConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, "ip=10.0.0.5/24,gw=10.0.0.1", config)
+	assert.Empty(t, driver.validateStaticIP())
+
+	ip, err := driver.GetIP()
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.5", ip)
+
+	driver.CloudInitIP = "10.0.0.5"
+	driver.CloudInitNetmask = "255.255.0.0"
+	config, err = driver.staticIPConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, "ip=10.0.0.5/16,gw=10.0.0.1", config)
+
+	driver.CloudInitGateway = "10.1.0.1"
+	assert.Len(t, driver.validateStaticIP(), 1)
+
+	driver.CloudInitGateway = ""
+	driver.CloudInitNetmask = ""
+	assert.Len(t, driver.validateStaticIP(), 1)
+
+	driver.CloudInitIP = "10.0.0.5/24"
+	driver.CloudInitNetmask = "24"
+	assert.Len(t, driver.validateStaticIP(), 1)
+
+	driver.CloudInitIP = "fd00::5/64"
+	driver.CloudInitNetmask = ""
+	_, err = driver.staticIPConfig()
+	assert.EqualError(t, err, "'fd00::5/64' is not an IPv4 address")
+}
+
+func Test_ValidateBridgeOfTemplate(t *testing.T) {
+	var driver = createDriver()
+	driver.CloneVMID = "9000"
+
+	// net0 of the template is kept, there is nothing to check
+	assert.Empty(t, driver.validateBridge())
+}
+
+func Test_DNSOptions(t *testing.T) {
+	var driver = createDriver()
+	assert.Equal(t, []proxmox.VirtualMachineOption{
+		{Name: "nameserver", Value: ""},
+		{Name: "searchdomain", Value: ""},
+	}, driver.dnsOptions())
+
+	driver.Nameserver = "10.0.0.2, 10.0.0.3"
+	driver.Searchdomain = "corp.example.com lab.example.com"
+	assert.Equal(t, []proxmox.VirtualMachineOption{
+		{Name: "nameserver", Value: "10.0.0.2 10.0.0.3"},
+		{Name: "searchdomain", Value: "corp.example.com lab.example.com"},
+	}, driver.dnsOptions())
+	assert.Nil(t, driver.validateDNS())
+
+	driver.Nameserver = "10.0.0.2,dns.example.com"
+	assert.Equal(t, []string{"proxmoxve-vm-nameserver: 'dns.example.com' is not an IP address"}, driver.validateDNS())
+}
+
+func Test_PollStableIP(t *testing.T) {
+	for _, c := range []struct {
+		name        string
+		polls       int
+		addresses   []string // discovered per poll, the last one repeats
+		unreachable string
+		ip          string
+		discovered  int
+	}{
+		{name: "stable", polls: 3, addresses: []string{"10.0.0.5"}, ip: "10.0.0.5", discovered: 3},
+		{name: "changing", polls: 2, addresses: []string{"", "169.254.0.7", "10.0.0.9", "10.0.0.5"}, ip: "10.0.0.5", discovered: 5},
+		{name: "unreachable resets", polls: 2, addresses: []string{"10.0.0.5", "10.0.0.6", "10.0.0.6", "10.0.0.5"}, unreachable: "10.0.0.6", ip: "10.0.0.5", discovered: 5},
+		{name: "single poll", polls: 1, addresses: []string{"", "10.0.0.5"}, ip: "10.0.0.5", discovered: 2},
+	} {
+		var driver = createDriver()
+		driver.IPStablePolls = c.polls
+		driver.taskTimeout = time.Minute
+
+		discovered := 0
+		discover := func() (string, error) {
+			ip := c.addresses[len(c.addresses)-1]
+			if discovered < len(c.addresses) {
+				ip = c.addresses[discovered]
+			}
+			discovered++
+			return ip, nil
+		}
+		reachable := func(ip string) bool { return ip != c.unreachable }
+
+		ip, err := driver.pollStableIP(discover, reachable, time.Millisecond)
+		assert.Nil(t, err, c.name)
+		assert.Equal(t, c.ip, ip, c.name)
+		assert.Equal(t, c.discovered, discovered, c.name)
+	}
+}
+
+func Test_PollStableIPTimeout(t *testing.T) {
+	var driver = createDriver()
+	driver.VMID = 101
+	driver.IPStablePolls = 3
+	driver.taskTimeout = 20 * time.Millisecond
+
+	// the address keeps flapping between two leases
+	addresses := []string{"10.0.0.5", "10.0.0.6"}
+	discovered := 0
+	discover := func() (string, error) {
+		discovered++
+		return addresses[discovered%2], nil
+	}
+	_, err := driver.pollStableIP(discover, func(string) bool { return true }, time.Millisecond)
+	assert.ErrorContains(t, err, "IP address of VM 101 did not settle within 20ms, last seen '10.0.0.")
+
+	// errors of the discovery end the wait at once
+	_, err = driver.pollStableIP(func() (string, error) { return "", errors.New("agent not running") }, func(string) bool { return true }, time.Millisecond)
+	assert.EqualError(t, err, "agent not running")
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Guests on host-only bridges can't be reached from where docker-machine
+// runs. With NodeForward the driver forwards ports of the node the VM runs on
+// to the ssh port and the docker daemon of the guest, by iptables rules it
+// adds on the node via ssh. The API has no way to run commands on a node.
+
+// defaultNodeForwardPortBase is the first node port forwarded to guests
+const defaultNodeForwardPortBase = 20000
+
+// nodeForwardSSHPort is the ssh port of the Proxmox VE nodes
+const nodeForwardSSHPort = 22
+
+// nodeForwardSSHTimeout is the time to connect to the ssh port of a node
+const nodeForwardSSHTimeout = 10 * time.Second
+
+// forwardedPorts returns the ports of the node forwarded to the ssh port and
+// the docker daemon of the guest, two per VMID above NodeForwardPortBase
+func (d *Driver) forwardedPorts() (int, int, error) {
+	sshPort := d.NodeForwardPortBase + 2*d.VMID
+	if sshPort+1 > 65535 {
+		return 0, 0, fmt.Errorf("VM %d has no node port to forward to it above %d, lower --proxmoxve-node-forward-port-base", d.VMID, d.NodeForwardPortBase)
+	}
+	return sshPort, sshPort + 1, nil
+}
+
+// nodeForwardComment tags the iptables rules of the forwards of a VM
+func nodeForwardComment(vmid int) string {
+	return fmt.Sprintf("docker-machine-%d", vmid)
+}
+
+// forwardRules returns the nat rules forwarding the node port to the port of
+// the guest ip. The masquerade routes the answers back via the node, also if
+// the node isn't the gateway of the guest.
+func forwardRules(nodePort int, ip string, port int, comment string) []string {
+	return []string{
+		fmt.Sprintf("PREROUTING -p tcp --dport %d -m comment --comment %s -j DNAT --to-destination %s", nodePort, comment, net.JoinHostPort(ip, strconv.Itoa(port))),
+		fmt.Sprintf("POSTROUTING -d %s -p tcp --dport %d -m comment --comment %s -j MASQUERADE", ip, port, comment),
+	}
+}
+
+// removeForwardScript deletes all nat rules with the comment
+func removeForwardScript(comment string) string {
+	return fmt.Sprintf("iptables-save -t nat | grep -- '--comment %s ' | sed 's/^-A /-D /' | while read -r rule; do eval iptables -t nat $rule; done", comment)
+}
+
+// forwardScript adds the rules, replacing the rules with the comment unless
+// all of them are in place already, e.g. for a new ip of the guest
+func forwardScript(rules []string, comment string) string {
+	var checks []string
+	for _, rule := range rules {
+		checks = append(checks, "iptables -t nat -C "+rule+" 2>/dev/null")
+	}
+	script := []string{
+		"set -e",
+		"if " + strings.Join(checks, " && ") + "; then exit 0; fi",
+		"sysctl -q -w net.ipv4.ip_forward=1",
+		removeForwardScript(comment),
+	}
+	for _, rule := range rules {
+		script = append(script, "iptables -t nat -A "+rule)
+	}
+	return strings.Join(script, "\n")
+}
+
+// nodeAddress returns the ip of the node in the cluster network
+func (d *Driver) nodeAddress(node string) (string, error) {
+	var members []struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+		IP   string `json:"ip"`
+	}
+	if err := d.client.Get(context.Background(), "/cluster/status", &members); err != nil {
+		return "", fmt.Errorf("unable to read the address of node %s: %w", node, err)
+	}
+	for _, m := range members {
+		if m.Type == "node" && m.Name == node && len(m.IP) > 0 {
+			return m.IP, nil
+		}
+	}
+	return "", fmt.Errorf("node %s has no address in the cluster status", node)
+}
+
+// runOnNode runs the script as NodeForwardSSHUser on the node address. The
+// host key of the node has to be in NodeForwardKnownHosts, the session runs
+// as a user allowed to change the firewall of the hypervisor.
+func (d *Driver) runOnNode(address, script string) error {
+	key, err := os.ReadFile(d.NodeForwardSSHKey)
+	if err != nil {
+		return err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("unable to read the ssh key %s: %w", d.NodeForwardSSHKey, err)
+	}
+	hostKeys, err := knownhosts.New(d.NodeForwardKnownHosts)
+	if err != nil {
+		return fmt.Errorf("unable to read the known hosts %s: %w", d.NodeForwardKnownHosts, err)
+	}
+
+	client, err := ssh.Dial("tcp", net.JoinHostPort(address, strconv.Itoa(nodeForwardSSHPort)), &ssh.ClientConfig{
+		User:            d.NodeForwardSSHUser,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeys,
+		Timeout:         nodeForwardSSHTimeout,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to connect to node %s via ssh: %w", address, err)
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("unable to connect to node %s via ssh: %w", address, err)
+	}
+	defer session.Close()
+
+	output, err := session.CombinedOutput(script)
+	if err != nil {
+		return fmt.Errorf("unable to configure the port forward on node %s: %w: %s", address, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// ensureForward forwards the ports of the node to the guest and returns the
+// node address, an empty one while the guest has no ip yet
+func (d *Driver) ensureForward() (string, error) {
+	if err := d.connect(); err != nil {
+		return "", err
+	}
+	address, err := d.nodeAddress(d.Node)
+	if err != nil {
+		return "", err
+	}
+	if d.forwardReady {
+		return address, nil
+	}
+
+	ip, err := d.GetIP()
+	if err != nil || ip == "" {
+		return "", err
+	}
+	if net.ParseIP(ip).To4() == nil {
+		return "", fmt.Errorf("the port forward needs an IPv4 address of VM %d, got '%s'", d.VMID, ip)
+	}
+	sshPort, enginePort, err := d.forwardedPorts()
+	if err != nil {
+		return "", err
+	}
+
+	comment := nodeForwardComment(d.VMID)
+	rules := append(forwardRules(sshPort, ip, d.GuestSSHPort, comment), forwardRules(enginePort, ip, d.enginePort(), comment)...)
+	d.debugf("forwarding ports %d and %d of node %s (%s) to %s", sshPort, enginePort, d.Node, address, ip)
+	if err := d.runOnNode(address, forwardScript(rules, comment)); err != nil {
+		return "", err
+	}
+	d.forwardReady = true
+	return address, nil
+}
+
+// removeForward removes the port forward of the VM from its node. Failures
+// only warn, leftover rules don't keep the VM from being removed.
+func (d *Driver) removeForward() {
+	address, err := d.nodeAddress(d.Node)
+	if err == nil {
+		err = d.runOnNode(address, removeForwardScript(nodeForwardComment(d.VMID)))
+	}
+	if err != nil {
+		log.Warnf("unable to remove the port forward of VM %d from node %s: %s", d.VMID, d.Node, err)
+	}
+	d.forwardReady = false
+}
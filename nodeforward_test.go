@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ForwardedPorts(t *testing.T) {
+	var driver = createDriver()
+	driver.NodeForwardPortBase = defaultNodeForwardPortBase
+	driver.VMID = 120
+
+	sshPort, enginePort, err := driver.forwardedPorts()
+	assert.Nil(t, err)
+	assert.Equal(t, 20240, sshPort)
+	assert.Equal(t, 20241, enginePort)
+
+	driver.VMID = 30000
+	_, _, err = driver.forwardedPorts()
+	assert.NotNil(t, err)
+}
+
+func Test_ForwardScript(t *testing.T) {
+	comment := nodeForwardComment(120)
+	rules := forwardRules(20240, "10.10.0.5", 22, comment)
+	assert.Equal(t, []string{
+		"PREROUTING -p tcp --dport 20240 -m comment --comment docker-machine-120 -j DNAT --to-destination 10.10.0.5:22",
+		"POSTROUTING -d 10.10.0.5 -p tcp --dport 22 -m comment --comment docker-machine-120 -j MASQUERADE",
+	}, rules)
+
+	script := forwardScript(rules, comment)
+	lines := strings.Split(script, "\n")
+	assert.Equal(t, "if iptables -t nat -C "+rules[0]+" 2>/dev/null && iptables -t nat -C "+rules[1]+" 2>/dev/null; then exit 0; fi", lines[1])
+	assert.Contains(t, script, "grep -- '--comment docker-machine-120 '")
+	assert.Equal(t, "iptables -t nat -A "+rules[1], lines[len(lines)-1])
+}
+
+func Test_NodeForwardFlags(t *testing.T) {
+	var driver = createDriver()
+	driver.DiskSize = "16"
+	driver.Memory = 2048
+	driver.GuestSSHPort = 22
+	driver.CloneVMID = "9000"
+	driver.NodeForward = true
+	driver.NodeForwardPortBase = defaultNodeForwardPortBase
+	driver.NodeForwardSSHUser = "root"
+
+	assert.Contains(t, validationError(driver.validateFlags()).Error(), "proxmoxve-node-forward-ssh-key is required with proxmoxve-node-forward")
+	assert.Contains(t, validationError(driver.validateFlags()).Error(), "proxmoxve-node-forward-known-hosts is required with proxmoxve-node-forward")
+
+	driver.IPStablePolls = 3
+	assert.Contains(t, validationError(driver.validateFlags()).Error(), "proxmoxve-ip-stable-polls can't be used with proxmoxve-node-forward")
+}
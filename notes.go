@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/labstack/gommon/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Templates can recommend defaults in their notes with a fenced yaml block,
+// keys are flag names like in the config file:
+//
+//	```proxmoxve
+//	vm-net-bridge: vmbr1
+//	vm-storage-path: ceph
+//	vm-min-memory: 4
+//	```
+var notesBlockPattern = regexp.MustCompile("(?s)```proxmoxve[ \t]*\r?\n(.*?)```")
+
+// templateNotesDefaults returns the defaults of the proxmoxve block in the
+// notes of a template, nil if there is none
+func templateNotesDefaults(notes string) (map[string]interface{}, error) {
+	match := notesBlockPattern.FindStringSubmatch(notes)
+	if match == nil {
+		return nil, nil
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal([]byte(match[1]), &values); err != nil {
+		return nil, fmt.Errorf("invalid proxmoxve block in template notes: %w", err)
+	}
+	return values, nil
+}
+
+// applyTemplateDefaults applies the defaults recommended by a template to the
+// options still set to their flag default. vm-min-memory raises the memory
+// to the given minimum.
+func (d *Driver) applyTemplateDefaults(values map[string]interface{}) error {
+	defaults := d.flagDefaults()
+	isDefault := func(key string, v interface{}) bool {
+		return fmt.Sprint(defaults[key]) == fmt.Sprint(v)
+	}
+
+	// the minimum applies after vm-memory, whatever the order of the map
+	var minMemory int
+	for k, v := range values {
+		key, value := configKey(k), fmt.Sprint(v)
+		var err error
+		switch key {
+		case "proxmoxve-vm-net-bridge":
+			if isDefault(key, d.NetBridge) {
+				d.NetBridge = value
+			}
+		case "proxmoxve-vm-net-tag":
+			if isDefault(key, d.NetVlanTag) {
+				d.NetVlanTag, err = strconv.Atoi(value)
+			}
+		case "proxmoxve-vm-storage-path":
+			if isDefault(key, d.Storage) {
+				d.Storage = value
+			}
+		case "proxmoxve-vm-storage-type":
+			if isDefault(key, d.StorageType) {
+				d.StorageType = value
+			}
+		case "proxmoxve-vm-storage-size":
+			if isDefault(key, d.DiskSize) {
+				d.DiskSize = value
+			}
+		case "proxmoxve-vm-memory":
+			if isDefault(key, d.Memory/1024) {
+				var memory int
+				memory, err = strconv.Atoi(value)
+				d.Memory = memory * 1024
+			}
+		case "proxmoxve-vm-min-memory":
+			minMemory, err = strconv.Atoi(value)
+		case "proxmoxve-vm-cpu-sockets":
+			if isDefault(key, d.CPUSockets) {
+				d.CPUSockets = value
+			}
+		case "proxmoxve-vm-cpu-cores":
+			if isDefault(key, d.CPUCores) {
+				d.CPUCores = value
+			}
+		case "proxmoxve-vm-citype":
+			if isDefault(key, d.Citype) {
+				d.Citype = value
+			}
+		case "proxmoxve-ssh-username":
+			if isDefault(key, d.GuestUsername) {
+				d.GuestUsername = value
+			}
+		default:
+			return fmt.Errorf("option '%s' can't be set by template notes", k)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value '%s' for '%s' in template notes: %w", value, k, err)
+		}
+	}
+
+	if d.Memory < minMemory*1024 {
+		log.Warnf("raising memory to %d GB as required by the template", minMemory)
+		d.Memory = minMemory * 1024
+	}
+	return nil
+}
+
+// applyTemplateNotes applies the defaults recommended in the notes of the
+// clone source, returns false if the notes have none
+func (d *Driver) applyTemplateNotes() (bool, error) {
+	cloneVmId, err := strconv.Atoi(d.CloneVMID)
+	if err != nil {
+		// already reported by validateFlags
+		return false, nil
+	}
+	if err := d.locateCloneSource(cloneVmId); err != nil {
+		// reported by validateCloneSource
+		return false, nil
+	}
+	config, err := d.getVMConfig(d.cloneSourceNode(), cloneVmId)
+	if err != nil {
+		// reported by validateCloneSource
+		return false, nil
+	}
+
+	notes, _ := config["description"].(string)
+	values, err := templateNotesDefaults(notes)
+	if err != nil || values == nil {
+		return false, err
+	}
+
+	d.debugf("applying %d default(s) from the notes of template %d", len(values), cloneVmId)
+	return true, d.applyTemplateDefaults(values)
+}
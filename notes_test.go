@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TemplateNotesDefaults(t *testing.T) {
+	notes := "Ubuntu 24.04 with qemu-guest-agent\n\n```proxmoxve\nvm-net-bridge: vmbr1\nvm-storage-path: ceph\nvm-memory: 4\nvm-min-memory: 2\nssh-username: ubuntu\n```\n"
+
+	values, err := templateNotesDefaults(notes)
+	assert.Nil(t, err)
+	assert.Len(t, values, 5)
+
+	var driver = createDriver()
+	driver.Memory = 8 * 1024
+	driver.Storage = "local-lvm" // given as flag, the template doesn't override it
+	assert.Nil(t, driver.applyTemplateDefaults(values))
+	assert.Equal(t, "vmbr1", driver.NetBridge)
+	assert.Equal(t, "local-lvm", driver.Storage)
+	assert.Equal(t, 4*1024, driver.Memory)
+	assert.Equal(t, "ubuntu", driver.GuestUsername)
+
+	driver.Memory = 1024
+	assert.Nil(t, driver.applyTemplateDefaults(map[string]interface{}{"vm-min-memory": 2}))
+	assert.Equal(t, 2*1024, driver.Memory)
+
+	// the minimum wins over vm-memory of the same template
+	for i := 0; i < 20; i++ {
+		driver.Memory = 8 * 1024
+		assert.Nil(t, driver.applyTemplateDefaults(map[string]interface{}{"vm-memory": 2, "vm-min-memory": 4}))
+		assert.Equal(t, 4*1024, driver.Memory)
+	}
+
+	assert.Error(t, driver.applyTemplateDefaults(map[string]interface{}{"proxmox-host": "pve"}))
+
+	values, err = templateNotesDefaults("no defaults here")
+	assert.Nil(t, err)
+	assert.Nil(t, values)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxHostPCIDevices is the number of hostpciN slots of a VM
+const maxHostPCIDevices = 16
+
+// hostPCIOptions are the options of a hostpciN value besides the device
+var hostPCIOptions = map[string]bool{
+	"host": true, "mapping": true, "mdev": true, "pcie": true, "rombar": true, "romfile": true, "x-vga": true,
+	"legacy-igd": true, "device-id": true, "vendor-id": true, "sub-device-id": true, "sub-vendor-id": true,
+}
+
+// hostPCIDevices returns the devices to pass through, hostpci0 first
+func (d *Driver) hostPCIDevices() []string {
+	var devices []string
+	if len(d.HostPci0) > 0 {
+		devices = append(devices, d.HostPci0)
+	}
+	return append(devices, d.HostPCI...)
+}
+
+// validateHostPCI checks the device and options of a hostpciN value
+func validateHostPCI(value string) error {
+	r := parsePCIRequest(value)
+	if len(r.Host) == 0 && len(r.Mapping) == 0 {
+		return fmt.Errorf("'%s' has neither a device id nor a mapping", value)
+	}
+	for i, part := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			if i == 0 {
+				continue
+			}
+			return fmt.Errorf("option '%s' of '%s' must be given as key=value", part, value)
+		}
+		if !hostPCIOptions[k] {
+			return fmt.Errorf("unknown option '%s' in '%s'", k, value)
+		}
+		if (k == "pcie" || k == "rombar" || k == "x-vga" || k == "legacy-igd") && v != "0" && v != "1" {
+			return fmt.Errorf("option %s of '%s' must be 0 or 1", k, value)
+		}
+	}
+	return nil
+}
+
+// validateHostPCIDevices checks all devices to pass through
+func (d *Driver) validateHostPCIDevices() []string {
+	var problems []string
+	devices := d.hostPCIDevices()
+	if len(devices) > maxHostPCIDevices {
+		problems = append(problems, fmt.Sprintf("proxmoxve-vm-hostpci: at most %d devices can be passed through, got %d", maxHostPCIDevices, len(devices)))
+	}
+	for _, device := range d.HostPCI {
+		if err := validateHostPCI(device); err != nil {
+			problems = append(problems, "proxmoxve-vm-hostpci: "+err.Error())
+		}
+	}
+	return problems
+}
+
+// pcieRequested returns true if any device is passed through as PCIe
+func (d *Driver) pcieRequested() bool {
+	for _, device := range d.hostPCIDevices() {
+		if strings.Contains(device, "pcie=1") {
+			return true
+		}
+	}
+	return false
+}
+
+// applyHostPCI attaches the devices to pass through as hostpci0, hostpci1, ...
+func (d *Driver) applyHostPCI() error {
+	for i, device := range d.hostPCIDevices() {
+		d.debugf("passing through hostpci%d=%s", i, device)
+		if err := d.ConfigureVM(fmt.Sprintf("hostpci%d", i), device); err != nil {
+			return fmt.Errorf("unable to pass through %s: %w", device, err)
+		}
+	}
+	return nil
+}
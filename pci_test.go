@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HostPCIDevices(t *testing.T) {
+	var driver = createDriver()
+	driver.HostPci0 = "0000:01:00.0,pcie=1"
+	driver.HostPCI = []string{"mapping=gpu,mdev=nvidia-63", "0000:02:00,rombar=0,x-vga=1"}
+
+	assert.Equal(t, []string{"0000:01:00.0,pcie=1", "mapping=gpu,mdev=nvidia-63", "0000:02:00,rombar=0,x-vga=1"}, driver.hostPCIDevices())
+	assert.Empty(t, driver.validateHostPCIDevices())
+	assert.True(t, driver.pcieRequested())
+
+	assert.EqualError(t, validateHostPCI("pcie=1"), "'pcie=1' has neither a device id nor a mapping")
+	assert.EqualError(t, validateHostPCI("0000:01:00.0,pcie=yes"), "option pcie of '0000:01:00.0,pcie=yes' must be 0 or 1")
+	assert.EqualError(t, validateHostPCI("0000:01:00.0,foo=1"), "unknown option 'foo' in '0000:01:00.0,foo=1'")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+)
+
+// vmPrivileges are needed on the new VM to create and configure it
+var vmPrivileges = []string{
+	"VM.Allocate", "VM.Audit", "VM.PowerMgmt",
+	"VM.Config.CPU", "VM.Config.Memory", "VM.Config.Disk", "VM.Config.Network",
+	"VM.Config.Options", "VM.Config.HWType", "VM.Config.Cloudinit",
+}
+
+// minimalClonePrivileges are needed on the new VM of a minimal clone, which
+// never writes its config
+var minimalClonePrivileges = []string{"VM.Allocate", "VM.Audit", "VM.PowerMgmt"}
+
+// requiredPrivilege is a privilege needed on one of the given ACL paths
+type requiredPrivilege struct {
+	Paths     []string
+	Privilege string
+}
+
+// requiredPrivileges returns the privileges the user needs to create the
+// machine. The new VM inherits from /vms or its pool, as its VMID isn't known
+// yet.
+func (d *Driver) requiredPrivileges() []requiredPrivilege {
+	var required []requiredPrivilege
+	need := func(privileges []string, paths ...string) {
+		for _, p := range privileges {
+			required = append(required, requiredPrivilege{Paths: paths, Privilege: p})
+		}
+	}
+
+	if d.adopting() {
+		need([]string{"VM.Audit", "VM.PowerMgmt", "VM.Config.Cloudinit"}, "/vms/"+d.ExistingVMID)
+		return required
+	}
+
+	vmPaths := []string{"/vms"}
+	if len(d.Pool) > 0 {
+		vmPaths = append(vmPaths, "/pool/"+d.Pool)
+	}
+	privileges := vmPrivileges
+	if d.CloneMinimal {
+		privileges = minimalClonePrivileges
+	}
+	if len(d.ImageFile) > 0 {
+		privileges = append(privileges, "VM.Config.CDROM")
+	}
+	need(privileges, vmPaths...)
+
+	if len(d.CloneVMID) > 0 {
+		need([]string{"VM.Clone"}, "/vms/"+d.CloneVMID)
+	}
+	// node status and capacity of the node, or of all nodes if it's selected
+	if d.nodeAutoSelect() {
+		need([]string{"Sys.Audit"}, "/nodes")
+	} else {
+		need([]string{"Sys.Audit"}, "/nodes/"+d.Node)
+	}
+	if len(d.NetBridge) > 0 && d.pveVersion.atLeast(8, 0) {
+		// attaching a VM to a bridge is checked since Proxmox VE 8.0
+		need([]string{"SDN.Use"}, "/sdn/zones/localnetwork/"+d.NetBridge)
+	}
+	if len(d.Storage) > 0 {
+		need([]string{"Datastore.AllocateSpace"}, "/storage/"+d.Storage)
+	}
+	if len(d.CloudImageURL) > 0 {
+		need([]string{"Datastore.AllocateTemplate"}, "/storage/"+d.CloudImageStorage)
+	}
+	if len(d.Pool) > 0 && d.PoolCreate {
+		need([]string{"Pool.Allocate"}, "/pool/"+d.Pool)
+	}
+	if d.haEnabled() {
+		need([]string{"Sys.Console"}, "/")
+	}
+	if len(d.RemoveBackup) > 0 {
+		need([]string{"VM.Backup"}, vmPaths...)
+		need([]string{"Datastore.AllocateSpace"}, "/storage/"+d.RemoveBackup)
+	}
+	return required
+}
+
+// missingPrivileges returns the required privileges granted on none of their
+// paths, grouped by path, given the effective privileges per path
+func missingPrivileges(required []requiredPrivilege, granted map[string]map[string]int) []string {
+	missing := make(map[string][]string)
+	for _, r := range required {
+		found := false
+		for _, p := range r.Paths {
+			if _, ok := granted[p][r.Privilege]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			paths := strings.Join(r.Paths, " or ")
+			missing[paths] = append(missing[paths], r.Privilege)
+		}
+	}
+
+	var problems []string
+	for paths, privileges := range missing {
+		problems = append(problems, fmt.Sprintf("%s on %s", strings.Join(privileges, ", "), paths))
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// validatePermissions checks that the user has the privileges needed to
+// create the machine, instead of failing with a 403 halfway through
+func (d *Driver) validatePermissions() []string {
+	required := d.requiredPrivileges()
+	granted := make(map[string]map[string]int)
+	for _, r := range required {
+		for _, p := range r.Paths {
+			if _, ok := granted[p]; ok {
+				continue
+			}
+			// the effective privileges of the path, including inherited ones
+			var permissions map[string]map[string]int
+			if err := d.client.Get(context.Background(), "/access/permissions?path="+url.QueryEscape(p), &permissions); err != nil {
+				log.Warnf("unable to check the privileges of the user, skipping the check: %s", err)
+				return nil
+			}
+			granted[p] = permissions[p]
+		}
+	}
+
+	var problems []string
+	for _, m := range missingPrivileges(required, granted) {
+		problems = append(problems, fmt.Sprintf("proxmoxve-proxmox-user-name: %s@%s lacks %s", d.User, d.Realm, m))
+	}
+	return problems
+}
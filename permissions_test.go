@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MissingPrivileges(t *testing.T) {
+	var driver = createDriver()
+	driver.CloneVMID = "9000"
+	driver.Storage = "local-lvm"
+	driver.Pool = "rancher"
+
+	required := driver.requiredPrivileges()
+	assert.Contains(t, required, requiredPrivilege{Paths: []string{"/vms", "/pool/rancher"}, Privilege: "VM.Allocate"})
+	assert.Contains(t, required, requiredPrivilege{Paths: []string{"/vms/9000"}, Privilege: "VM.Clone"})
+	assert.Contains(t, required, requiredPrivilege{Paths: []string{"/nodes"}, Privilege: "Sys.Audit"})
+	assert.NotContains(t, required, requiredPrivilege{Paths: []string{"/sdn/zones/localnetwork/vmbr0"}, Privilege: "SDN.Use"})
+
+	granted := map[string]map[string]int{
+		"/vms":          {"VM.Audit": 1},
+		"/pool/rancher": {},
+		"/vms/9000":     {"VM.Clone": 1},
+	}
+	for _, p := range vmPrivileges {
+		granted["/pool/rancher"][p] = 1
+	}
+	granted["/nodes"] = map[string]int{"Sys.Audit": 1}
+	assert.Equal(t, []string{"Datastore.AllocateSpace on /storage/local-lvm"}, missingPrivileges(required, granted))
+
+	delete(granted, "/vms/9000")
+	granted["/storage/local-lvm"] = map[string]int{"Datastore.AllocateSpace": 1}
+	delete(granted["/pool/rancher"], "VM.PowerMgmt")
+	assert.Equal(t, []string{
+		"VM.Clone on /vms/9000",
+		"VM.PowerMgmt on /vms or /pool/rancher",
+	}, missingPrivileges(required, granted))
+
+	driver.Node = "pve1"
+	driver.NetBridge = "vmbr0"
+	driver.pveVersion = pveVersion{8, 2}
+	required = driver.requiredPrivileges()
+	assert.Contains(t, required, requiredPrivilege{Paths: []string{"/nodes/pve1"}, Privilege: "Sys.Audit"})
+	assert.Contains(t, required, requiredPrivilege{Paths: []string{"/sdn/zones/localnetwork/vmbr0"}, Privilege: "SDN.Use"})
+
+	// a minimal clone only clones and starts the VM
+	driver.NetBridge = ""
+	driver.CloneMinimal = true
+	required = driver.requiredPrivileges()
+	granted = map[string]map[string]int{
+		"/vms":               {"VM.Allocate": 1, "VM.Audit": 1, "VM.PowerMgmt": 1},
+		"/vms/9000":          {"VM.Clone": 1},
+		"/nodes/pve1":        {"Sys.Audit": 1},
+		"/storage/local-lvm": {"Datastore.AllocateSpace": 1},
+	}
+	assert.Empty(t, missingPrivileges(required, granted))
+	delete(granted["/vms"], "VM.PowerMgmt")
+	assert.Equal(t, []string{"VM.PowerMgmt on /vms or /pool/rancher"}, missingPrivileges(required, granted))
+}
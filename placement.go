@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// clusterNode is a node of the cluster resources listing
+type clusterNode struct {
+	Node   string  `json:"node"`
+	Status string  `json:"status"`
+	CPU    float64 `json:"cpu"`
+	MaxCPU int     `json:"maxcpu"`
+	Mem    uint64  `json:"mem"`
+	MaxMem uint64  `json:"maxmem"`
+}
+
+// pciRequest is a device requested by --proxmoxve-vm-hostpci0 or --proxmoxve-vm-hostpci
+type pciRequest struct {
+	Host    string // pci id like 0000:01:00.0 or 01:00
+	Mapping string // cluster wide resource mapping
+	Mdev    string // mediated device type, e.g. a vGPU profile
+}
+
+// parsePCIRequest parses a hostpciN value like 0000:01:00.0,pcie=1 or mapping=gpu,mdev=nvidia-63
+func parsePCIRequest(value string) pciRequest {
+	var r pciRequest
+	for i, part := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(part, "=")
+		switch {
+		case !ok && i == 0:
+			r.Host = k
+		case k == "host":
+			r.Host = v
+		case k == "mapping":
+			r.Mapping = v
+		case k == "mdev":
+			r.Mdev = v
+		}
+	}
+	// multifunction devices are given as 01:00 for all functions, several
+	// devices separated by ;
+	r.Host, _, _ = strings.Cut(r.Host, ";")
+	return r
+}
+
+// matchesPCIID returns true if the pci id reported by a node belongs to the requested one
+func matchesPCIID(id, requested string) bool {
+	id, requested = strings.ToLower(id), strings.ToLower(requested)
+	if !strings.HasPrefix(requested, "0000:") && strings.Count(requested, ":") == 1 {
+		requested = "0000:" + requested
+	}
+	return id == requested || strings.HasPrefix(id, requested+".")
+}
+
+// freeMem returns the memory of the node not in use
+func (n *clusterNode) freeMem() uint64 {
+	if n.Mem > n.MaxMem {
+		return 0
+	}
+	return n.MaxMem - n.Mem
+}
+
+// freeCPU returns the number of cpus of the node not in use
+func (n *clusterNode) freeCPU() float64 {
+	return float64(n.MaxCPU) * (1 - n.CPU)
+}
+
+// rankNodes returns the online nodes, the one with the most free memory
+// first, ties broken by free cpu
+func rankNodes(nodes []clusterNode) []string {
+	var online []clusterNode
+	for _, n := range nodes {
+		if n.Status == "online" {
+			online = append(online, n)
+		}
+	}
+	sort.SliceStable(online, func(i, j int) bool {
+		if online[i].freeMem() != online[j].freeMem() {
+			return online[i].freeMem() > online[j].freeMem()
+		}
+		return online[i].freeCPU() > online[j].freeCPU()
+	})
+
+	var names []string
+	for _, n := range online {
+		names = append(names, n.Node)
+	}
+	return names
+}
+
+// placementSpread is the placement policy spreading the VMs of a Rancher
+// cluster across the nodes
+const placementSpread = "spread"
+
+// spreadNodes orders the nodes by the number of VMs carrying the tag on them,
+// the fewest first, keeping the given order among nodes with as many
+func spreadNodes(nodes []string, vms []clusterVM, tag string) []string {
+	peers := make(map[string]int)
+	for _, vm := range vms {
+		if vm.Template == 1 {
+			continue
+		}
+		for _, t := range splitTags(vm.Tags) {
+			if t == tag {
+				peers[vm.Node]++
+				break
+			}
+		}
+	}
+
+	spread := append([]string(nil), nodes...)
+	sort.SliceStable(spread, func(i, j int) bool {
+		return peers[spread[i]] < peers[spread[j]]
+	})
+	return spread
+}
+
+// nodeAutoSelect returns true if the driver has to pick the node itself,
+// from NodeCandidates or, without a node, from all nodes of the cluster
+func (d *Driver) nodeAutoSelect() bool {
+	return len(d.NodeCandidates) > 0 || len(d.Node) == 0
+}
+
+func (d *Driver) getClusterNodes() ([]clusterNode, error) {
+	if err := d.connect(); err != nil {
+		return nil, err
+	}
+
+	var nodes []clusterNode
+	if err := d.client.Get(context.Background(), "/cluster/resources?type=node", &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// mappedHost returns the pci id of the resource mapping on the node, empty if
+// the mapping has no device there
+func (d *Driver) mappedHost(mapping, node string) (string, error) {
+	var m struct {
+		Map []string `json:"map"`
+	}
+	if err := d.client.Get(context.Background(), "/cluster/mapping/pci/"+url.PathEscape(mapping), &m); err != nil {
+		return "", err
+	}
+	for _, entry := range m.Map {
+		values := parsePropertyString(entry)
+		if values["node"] == node {
+			host, _, _ := strings.Cut(values["path"], ";")
+			return host, nil
+		}
+	}
+	return "", nil
+}
+
+// usedDevices returns the pci ids passed through to the running VMs of the
+// node. Mediated devices are left out, their card is shared.
+func (d *Driver) usedDevices(node string) ([]string, error) {
+	vms, err := d.getClusterVMs()
+	if err != nil {
+		return nil, err
+	}
+	var used []string
+	for _, vm := range vms {
+		if vm.Node != node || vm.Status != "running" {
+			continue
+		}
+		config, err := d.getVMConfig(node, vm.VMID)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range config {
+			if !strings.HasPrefix(key, "hostpci") {
+				continue
+			}
+			r := parsePCIRequest(fmt.Sprint(value))
+			if len(r.Mdev) > 0 {
+				continue
+			}
+			host := r.Host
+			if len(r.Mapping) > 0 {
+				if host, err = d.mappedHost(r.Mapping, node); err != nil {
+					return nil, err
+				}
+			}
+			if len(host) > 0 {
+				used = append(used, host)
+			}
+		}
+	}
+	return used, nil
+}
+
+// deviceInUse returns true if the pci id reported by a node is one of the
+// used ones
+func deviceInUse(id string, used []string) bool {
+	for _, u := range used {
+		if matchesPCIID(id, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeHasDevice checks whether the node has a free device matching the
+// request. Plain passthrough devices must not be passed through to a running
+// VM already, given as used, mediated devices need an available instance of
+// the requested type.
+func (d *Driver) nodeHasDevice(node string, r pciRequest, used []string) (bool, error) {
+	host := r.Host
+	if len(r.Mapping) > 0 {
+		var err error
+		if host, err = d.mappedHost(r.Mapping, node); err != nil || len(host) == 0 {
+			return false, err
+		}
+	}
+
+	var devices []struct {
+		ID   string `json:"id"`
+		Mdev int    `json:"mdev"`
+	}
+	if err := d.client.Get(context.Background(), fmt.Sprintf("/nodes/%s/hardware/pci", node), &devices); err != nil {
+		return false, err
+	}
+	found := false
+	for _, device := range devices {
+		if !matchesPCIID(device.ID, host) {
+			continue
+		}
+		if len(r.Mdev) == 0 {
+			// all functions of a multifunction device have to be free
+			if deviceInUse(device.ID, used) {
+				return false, nil
+			}
+			found = true
+			continue
+		}
+		if device.Mdev != 1 {
+			continue
+		}
+
+		var types []struct {
+			Type      string `json:"type"`
+			Available int    `json:"available"`
+		}
+		if err := d.client.Get(context.Background(), fmt.Sprintf("/nodes/%s/hardware/pci/%s/mdev", node, device.ID), &types); err != nil {
+			return false, err
+		}
+		for _, t := range types {
+			if t.Type == r.Mdev && t.Available > 0 {
+				return true, nil
+			}
+		}
+	}
+	return found, nil
+}
+
+// missingDevice returns the first device to pass through the node has no free
+// instance of, empty if it has all
+func (d *Driver) missingDevice(node string) (string, error) {
+	devices := d.hostPCIDevices()
+	if len(devices) == 0 {
+		return "", nil
+	}
+	used, err := d.usedDevices(node)
+	if err != nil {
+		return "", err
+	}
+	for _, device := range devices {
+		ok, err := d.nodeHasDevice(node, parsePCIRequest(device), used)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return device, nil
+		}
+	}
+	return "", nil
+}
+
+// placementCandidates returns the online nodes of NodeCandidates able to host
+// the VM, in the given order. Without NodeCandidates all online nodes are
+// candidates, ranked by their load.
+func (d *Driver) placementCandidates() ([]string, error) {
+	nodes, err := d.getClusterNodes()
+	if err != nil {
+		return nil, err
+	}
+	vms, err := d.getClusterVMs()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the VMs of the cluster: %w", err)
+	}
+	online := make(map[string]bool)
+	byName := make(map[string]clusterNode)
+	for _, n := range nodes {
+		online[n.Node] = n.Status == "online"
+		byName[n.Node] = n
+	}
+
+	names := d.NodeCandidates
+	if len(names) == 0 {
+		names = rankNodes(nodes)
+	}
+
+	var candidates, skipped []string
+	for _, node := range names {
+		if !online[node] {
+			skipped = append(skipped, node+" (offline)")
+			continue
+		}
+		if shortage := d.nodeShortage(byName[node], vms); len(shortage) > 0 {
+			skipped = append(skipped, node+" ("+shortage+")")
+			continue
+		}
+		missing, err := d.missingDevice(node)
+		if err != nil {
+			return nil, fmt.Errorf("unable to check the pci devices of node %s: %w", node, err)
+		}
+		if len(missing) > 0 {
+			skipped = append(skipped, node+" (no free device "+missing+")")
+			continue
+		}
+		candidates = append(candidates, node)
+	}
+
+	if len(candidates) == 0 && len(skipped) == 0 {
+		return nil, fmt.Errorf("insufficient capacity: no node of the cluster is online")
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("insufficient capacity: no node can host the VM: %s", strings.Join(skipped, ", "))
+	}
+	if len(skipped) > 0 {
+		d.debugf("skipping nodes %s", strings.Join(skipped, ", "))
+	}
+
+	if d.PlacementPolicy == placementSpread {
+		candidates = spreadNodes(candidates, vms, d.clusterTag())
+	}
+	return candidates, nil
+}
+
+// selectNode picks the node to create the VM on
+func (d *Driver) selectNode() error {
+	if !d.nodeAutoSelect() {
+		return nil
+	}
+
+	candidates, err := d.placementCandidates()
+	if err != nil {
+		return err
+	}
+	d.Node = candidates[0]
+	d.placement = candidates
+	d.debugf("selected node %s from %s", d.Node, strings.Join(candidates, ", "))
+	return nil
+}
+
+// nodeLocalErrors are error messages of failures caused by the node the VM is
+// created on, creating it on another node may succeed
+var nodeLocalErrors = []string{
+	"no space left on device",
+	"not enough space",
+	"insufficient free space",
+	"out of space",
+	"is not available on node", // storage 'local-lvm' is not available on node 'pve2'
+	"can't lock file",
+	"got timeout",
+	"connection timed out",
+	"connection refused",
+	"no route to host",
+	"node is offline",
+	"seems to be offline",
+}
+
+// nodeLocalStatus matches the status codes the API proxy answers with if it
+// can't reach the node (595) or the connection to it broke down (596)
+var nodeLocalStatus = regexp.MustCompile(`(^|: )59[56] `)
+
+// isNodeLocalError returns true if the error is likely caused by the node
+func isNodeLocalError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, e := range nodeLocalErrors {
+		if strings.Contains(msg, e) {
+			return true
+		}
+	}
+	return nodeLocalStatus.MatchString(msg)
+}
+
+// locateCloneSource sets the node of the clone source, which can differ from
+// the node the VM is created on, so one template serves all nodes
+func (d *Driver) locateCloneSource(cloneVmId int) error {
+	d.cloneNode = d.Node
+
+	vms, err := d.getClusterVMs()
+	if err != nil {
+		return err
+	}
+	for _, vm := range vms {
+		if vm.VMID == cloneVmId {
+			d.cloneNode = vm.Node
+			return nil
+		}
+	}
+	return fmt.Errorf("VM %d not found in the cluster", cloneVmId)
+}
+
+// cloneSourceNode returns the node of the clone source
+func (d *Driver) cloneSourceNode() string {
+	if len(d.cloneNode) > 0 {
+		return d.cloneNode
+	}
+	return d.Node
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParsePCIRequest(t *testing.T) {
+	assert.Equal(t, pciRequest{Host: "0000:01:00.0"}, parsePCIRequest("0000:01:00.0,pcie=1"))
+	assert.Equal(t, pciRequest{Host: "01:00", Mdev: "nvidia-63"}, parsePCIRequest("host=01:00;02:00,mdev=nvidia-63"))
+	assert.Equal(t, pciRequest{Mapping: "gpu"}, parsePCIRequest("mapping=gpu,pcie=1"))
+}
+
+func Test_MatchesPCIID(t *testing.T) {
+	assert.True(t, matchesPCIID("0000:01:00.0", "0000:01:00.0"))
+	assert.True(t, matchesPCIID("0000:01:00.1", "01:00"))
+	assert.True(t, matchesPCIID("0000:01:00.0", "0000:01:00"))
+	assert.False(t, matchesPCIID("0000:01:00.0", "0000:01:00.1"))
+	assert.False(t, matchesPCIID("0000:11:00.0", "01:00"))
+
+	used := []string{"01:00", "0000:02:00.1"}
+	assert.True(t, deviceInUse("0000:01:00.1", used))
+	assert.True(t, deviceInUse("0000:02:00.1", used))
+	assert.False(t, deviceInUse("0000:02:00.0", used))
+}
+
+func Test_IsNodeLocalError(t *testing.T) {
+	assert.True(t, isNodeLocalError(errors.New("clone failed: can't lock file '/var/lock/qemu-server/lock-9000.conf' - got timeout")))
+	assert.True(t, isNodeLocalError(errors.New("500 No space left on device")))
+	assert.True(t, isNodeLocalError(errors.New("595 Connection refused")))
+	assert.True(t, isNodeLocalError(errors.New("bad request: 596 Connection timed out - ")))
+	assert.True(t, isNodeLocalError(errors.New("500 storage 'local-lvm' is not available on node 'pve2'")))
+	assert.False(t, isNodeLocalError(errors.New("403 Permission check failed (/vms/9000, VM.Clone)")))
+	assert.False(t, isNodeLocalError(errors.New("403 Permission check failed (/storage/local-lvm, Datastore.AllocateSpace)")))
+	assert.False(t, isNodeLocalError(errors.New("400 Parameter verification failed. timeout: invalid format")))
+}
+
+func Test_RankNodes(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+	nodes := []clusterNode{
+		{Node: "pve1", Status: "online", CPU: 0.5, MaxCPU: 16, Mem: 48 * gb, MaxMem: 64 * gb},
+		{Node: "pve2", Status: "offline", MaxCPU: 16, MaxMem: 64 * gb},
+		{Node: "pve3", Status: "online", CPU: 0.1, MaxCPU: 16, Mem: 32 * gb, MaxMem: 64 * gb},
+		{Node: "pve4", Status: "online", CPU: 0.9, MaxCPU: 16, Mem: 32 * gb, MaxMem: 64 * gb},
+	}
+	assert.Equal(t, []string{"pve3", "pve4", "pve1"}, rankNodes(nodes))
+}
+
+func Test_SpreadNodes(t *testing.T) {
+	vms := []clusterVM{
+		{VMID: 101, Node: "pve1", Tags: "prod;etcd"},
+		{VMID: 102, Node: "pve1", Tags: "prod"},
+		{VMID: 103, Node: "pve2", Tags: "prod"},
+		{VMID: 104, Node: "pve3", Tags: "staging"},
+		{VMID: 9000, Node: "pve3", Tags: "prod", Template: 1},
+	}
+	assert.Equal(t, []string{"pve3", "pve2", "pve1"}, spreadNodes([]string{"pve1", "pve2", "pve3"}, vms, "prod"))
+	// ties keep the given order
+	assert.Equal(t, []string{"pve4", "pve3", "pve2", "pve1"}, spreadNodes([]string{"pve4", "pve1", "pve3", "pve2"}, vms, "prod"))
+	assert.Equal(t, []string{"pve1", "pve2"}, spreadNodes([]string{"pve1", "pve2"}, vms, "dev"))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxPoolDepth is the maximum nesting of resource pools supported by Proxmox VE 8.1+
+const maxPoolDepth = 3
+
+var poolSegmentPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// poolLevels returns all levels of a (nested) pool path, e.g. rancher/prod gives rancher and rancher/prod
+func poolLevels(pool string) []string {
+	var levels []string
+	segments := strings.Split(strings.Trim(pool, "/"), "/")
+	for i := range segments {
+		levels = append(levels, strings.Join(segments[:i+1], "/"))
+	}
+	return levels
+}
+
+// validatePool checks the format of the pool path
+func validatePool(pool string) error {
+	levels := poolLevels(pool)
+	if len(levels) > maxPoolDepth {
+		return fmt.Errorf("pools can be nested %d levels deep at most, got '%s'", maxPoolDepth, pool)
+	}
+	for _, segment := range strings.Split(strings.Trim(pool, "/"), "/") {
+		if !poolSegmentPattern.MatchString(segment) {
+			return fmt.Errorf("invalid pool name '%s' in '%s'", segment, pool)
+		}
+	}
+	return nil
+}
+
+// missingPools returns the levels of the pool path which don't exist yet
+func (d *Driver) missingPools() ([]string, error) {
+	if err := d.connect(); err != nil {
+		return nil, err
+	}
+
+	var pools []struct {
+		PoolID string `json:"poolid"`
+	}
+	if err := d.client.Get(context.Background(), "/pools", &pools); err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool)
+	for _, p := range pools {
+		existing[p.PoolID] = true
+	}
+
+	var missing []string
+	for _, level := range poolLevels(d.Pool) {
+		if !existing[level] {
+			missing = append(missing, level)
+		}
+	}
+	return missing, nil
+}
+
+// ensurePool creates the missing levels of the pool path if allowed
+func (d *Driver) ensurePool() error {
+	if len(d.Pool) == 0 {
+		return nil
+	}
+
+	missing, err := d.missingPools()
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 && !d.PoolCreate {
+		return fmt.Errorf("pool '%s' does not exist, create it or use --proxmoxve-proxmox-pool-create", missing[0])
+	}
+
+	for _, pool := range missing {
+		d.debugf("creating pool '%s'", pool)
+		if err := d.client.Post(context.Background(), "/pools", map[string]string{"poolid": pool}, nil); err != nil {
+			return fmt.Errorf("unable to create pool '%s': %w", pool, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PoolLevels(t *testing.T) {
+	assert.Equal(t, []string{"rancher"}, poolLevels("rancher"))
+	assert.Equal(t, []string{"rancher", "rancher/prod", "rancher/prod/workers"}, poolLevels("rancher/prod/workers"))
+}
+
+func Test_ValidatePool(t *testing.T) {
+	assert.Nil(t, validatePool("rancher/prod/workers"))
+	assert.NotNil(t, validatePool("rancher/prod/workers/gpu"))
+	assert.NotNil(t, validatePool("rancher//prod"))
+	assert.NotNil(t, validatePool("rancher/pr od"))
+}
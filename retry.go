@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// retryTransport retries API requests failing transiently, as the API proxy
+// of the cluster frequently does while many VMs are cloned at once. The
+// backoff doubles with every attempt.
+type retryTransport struct {
+	base     http.RoundTripper
+	attempts int
+	backoff  time.Duration
+}
+
+// isIdempotent returns true if the request can be sent again without side
+// effects. A POST, PUT or DELETE which reached the server, e.g. a clone, would
+// run a second time.
+func isIdempotent(req *http.Request) bool {
+	return req.Method == http.MethodGet || req.Method == http.MethodHead
+}
+
+// isTransientStatus returns true if the API proxy couldn't pass the request
+// on, e.g. the 596 it answers with if it can't reach the node. The 500 PVE
+// answers with for permanent errors, like an existing or locked VM, is never
+// retried, a 504 only if the request is idempotent.
+func isTransientStatus(code int, idempotent bool) bool {
+	switch code {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, 596:
+		return true
+	case http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// isTransientError returns true if the connection broke down
+func isTransientError(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// isDialError returns true if the connection couldn't be established, so the
+// request was never sent
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return (errors.As(err, &opErr) && opErr.Op == "dial") || errors.As(err, &dnsErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH)
+}
+
+// isRetryable returns true if the request failed with err or resp in a way
+// which allows to send it again
+func isRetryable(req *http.Request, resp *http.Response, err error) bool {
+	idempotent := isIdempotent(req)
+	if err != nil {
+		return isDialError(err) || (idempotent && isTransientError(err))
+	}
+	return isTransientStatus(resp.StatusCode, idempotent)
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := t.backoff
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		last := attempt >= t.attempts || (req.Body != nil && req.GetBody == nil)
+		if last || !isRetryable(req, resp, err) {
+			return resp, err
+		}
+
+		if err != nil {
+			log.Warnf("%s %s failed, retrying in %s: %s", req.Method, req.URL.Path, backoff, err)
+		} else {
+			log.Warnf("%s %s failed with %s, retrying in %s", req.Method, req.URL.Path, resp.Status, backoff)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RetryTransport(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		switch len(bodies) {
+		case 1:
+			w.WriteHeader(596)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &retryTransport{base: http.DefaultTransport, attempts: 3}}
+	resp, err := client.Post(server.URL, "application/x-www-form-urlencoded", strings.NewReader("newid=101"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"newid=101", "newid=101", "newid=101"}, bodies)
+
+	// permanent errors and the last attempt are returned as is
+	bodies = nil
+	client.Transport = &retryTransport{base: http.DefaultTransport, attempts: 2}
+	resp, err = client.Get(server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Len(t, bodies, 2)
+
+	// permanent errors of PVE are never sent again
+	bodies = nil
+	failed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failed.Close()
+	client.Transport = &retryTransport{base: http.DefaultTransport, attempts: 3}
+	resp, err = client.Post(failed.URL, "application/x-www-form-urlencoded", strings.NewReader("newid=101"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Len(t, bodies, 1)
+
+	assert.False(t, isTransientStatus(http.StatusForbidden, true))
+	assert.False(t, isTransientStatus(http.StatusInternalServerError, true))
+	assert.True(t, isTransientStatus(596, false))
+	assert.True(t, isTransientStatus(http.StatusGatewayTimeout, true))
+	assert.False(t, isTransientStatus(http.StatusGatewayTimeout, false))
+
+	post, _ := http.NewRequest(http.MethodPost, failed.URL, nil)
+	get, _ := http.NewRequest(http.MethodGet, failed.URL, nil)
+	assert.False(t, isRetryable(post, nil, io.ErrUnexpectedEOF))
+	assert.True(t, isRetryable(get, nil, io.ErrUnexpectedEOF))
+	assert.True(t, isRetryable(post, nil, &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}))
+}
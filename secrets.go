@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Secrets (the Proxmox VE and the guest password) can be given as reference to
+// an environment variable (env:NAME) or a file (file:/path), in which case only
+// the reference is stored in the machine config. Plain text secrets are stored
+// encrypted if a key is given in PROXMOXVE_SECRET_KEY or PROXMOXVE_SECRET_KEY_FILE.
+const (
+	secretEnvPrefix       = "env:"
+	secretFilePrefix      = "file:"
+	secretEncryptedPrefix = "enc:"
+)
+
+// driverJSON has the fields of Driver without its json methods
+type driverJSON Driver
+
+// MarshalJSON stores the driver with its secrets encrypted (if a key is configured)
+func (d *Driver) MarshalJSON() ([]byte, error) {
+	stored := driverJSON(*d)
+
+	key, err := secretKey()
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		if stored.Password, err = encryptSecret(key, d.Password); err != nil {
+			return nil, err
+		}
+		if stored.GuestPassword, err = encryptSecret(key, d.GuestPassword); err != nil {
+			return nil, err
+		}
+		if stored.CIPassword, err = encryptSecret(key, d.CIPassword); err != nil {
+			return nil, err
+		}
+		stored.Headers = make([]string, len(d.Headers))
+		for i, h := range d.Headers {
+			name, value, err := parseHeader(h)
+			if err != nil {
+				return nil, err
+			}
+			if value, err = encryptSecret(key, value); err != nil {
+				return nil, err
+			}
+			stored.Headers[i] = name + ": " + value
+		}
+	}
+
+	return json.Marshal(stored)
+}
+
+// resolveSecret returns the plain text of a secret, following references and
+// decrypting stored values
+func resolveSecret(secret string) (string, error) {
+	switch {
+	case strings.HasPrefix(secret, secretEnvPrefix):
+		name := strings.TrimPrefix(secret, secretEnvPrefix)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s referenced by secret is not set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(secret, secretFilePrefix):
+		value, err := os.ReadFile(strings.TrimPrefix(secret, secretFilePrefix))
+		if err != nil {
+			return "", fmt.Errorf("unable to read secret: %w", err)
+		}
+		return strings.TrimRight(string(value), "\r\n"), nil
+	case strings.HasPrefix(secret, secretEncryptedPrefix):
+		key, err := secretKey()
+		if err != nil {
+			return "", err
+		}
+		if key == nil {
+			return "", errors.New("secret is encrypted, set PROXMOXVE_SECRET_KEY or PROXMOXVE_SECRET_KEY_FILE to decrypt it")
+		}
+		return decryptSecret(key, secret)
+	}
+	return secret, nil
+}
+
+// secretKey returns the key used to encrypt secrets or nil if none is configured
+func secretKey() ([]byte, error) {
+	passphrase := os.Getenv("PROXMOXVE_SECRET_KEY")
+	if path := os.Getenv("PROXMOXVE_SECRET_KEY_FILE"); len(passphrase) == 0 && len(path) > 0 {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read secret key: %w", err)
+		}
+		passphrase = strings.TrimSpace(string(data))
+	}
+	if len(passphrase) == 0 {
+		return nil, nil
+	}
+
+	key := sha256.Sum256([]byte(passphrase))
+	return key[:], nil
+}
+
+func encryptSecret(key []byte, secret string) (string, error) {
+	if len(secret) == 0 || strings.HasPrefix(secret, secretEnvPrefix) ||
+		strings.HasPrefix(secret, secretFilePrefix) || strings.HasPrefix(secret, secretEncryptedPrefix) {
+		return secret, nil
+	}
+
+	gcm, err := secretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return secretEncryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptSecret(key []byte, secret string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, secretEncryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted secret: %w", err)
+	}
+
+	gcm, err := secretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted secret: too short")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("unable to decrypt secret, wrong PROXMOXVE_SECRET_KEY?")
+	}
+	return string(plain), nil
+}
+
+func secretCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SecretReferences(t *testing.T) {
+	t.Setenv("TEST_PVE_PASSWORD", "from-env")
+	path := filepath.Join(t.TempDir(), "password")
+	assert.Nil(t, os.WriteFile(path, []byte("from-file\n"), 0600))
+
+	s, err := resolveSecret("env:TEST_PVE_PASSWORD")
+	assert.Nil(t, err)
+	assert.Equal(t, "from-env", s)
+
+	s, err = resolveSecret("file:" + path)
+	assert.Nil(t, err)
+	assert.Equal(t, "from-file", s)
+
+	s, err = resolveSecret("plain")
+	assert.Nil(t, err)
+	assert.Equal(t, "plain", s)
+
+	_, err = resolveSecret("env:TEST_PVE_UNSET")
+	assert.NotNil(t, err)
+}
+
+func Test_EncryptedSecrets(t *testing.T) {
+	var driver = createDriver()
+	driver.Password = "secret"
+	driver.GuestPassword = "env:TEST_GUEST_PASSWORD"
+
+	t.Setenv("PROXMOXVE_SECRET_KEY", "passphrase")
+	data, err := json.Marshal(driver)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "\"secret\"")
+	// the in-memory value is untouched
+	assert.Equal(t, "secret", driver.Password)
+
+	var stored = createDriver()
+	assert.Nil(t, json.Unmarshal(data, stored))
+	assert.Equal(t, "env:TEST_GUEST_PASSWORD", stored.GuestPassword)
+
+	s, err := resolveSecret(stored.Password)
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", s)
+
+	t.Setenv("PROXMOXVE_SECRET_KEY", "wrong")
+	_, err = resolveSecret(stored.Password)
+	assert.NotNil(t, err)
+}
+
+func Test_EncryptedHeaders(t *testing.T) {
+	var driver = createDriver()
+	driver.Headers = []string{"CF-Access-Client-Id: client.access", "CF-Access-Client-Secret: env:TEST_CF_SECRET"}
+
+	t.Setenv("PROXMOXVE_SECRET_KEY", "passphrase")
+	t.Setenv("TEST_CF_SECRET", "cf-secret")
+	data, err := json.Marshal(driver)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "client.access")
+
+	var stored = createDriver()
+	assert.Nil(t, json.Unmarshal(data, stored))
+
+	header, err := stored.apiHeaders()
+	assert.Nil(t, err)
+	assert.Equal(t, "client.access", header.Get("Cf-Access-Client-Id"))
+	assert.Equal(t, "cf-secret", header.Get("Cf-Access-Client-Secret"))
+}
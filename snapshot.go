@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/luthermonson/go-proxmox"
+)
+
+// Snapshot is a snapshot of the VM
+type Snapshot struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Parent      string `json:"parent,omitempty"`
+	SnapTime    int64  `json:"snaptime,omitempty"`
+	VMState     int    `json:"vmstate,omitempty"`
+}
+
+// snapshotPath returns the API path of the snapshots of the VM, or of the
+// given one
+func (d *Driver) snapshotPath(name string) string {
+	path := fmt.Sprintf("/nodes/%s/qemu/%d/snapshot", d.Node, d.VMID)
+	if len(name) > 0 {
+		path += "/" + url.PathEscape(name)
+	}
+	return path
+}
+
+// snapshotTask runs a snapshot operation and waits for its task
+func (d *Driver) snapshotTask(operation, name string, call func(*proxmox.UPID) error) error {
+	if err := d.connect(); err != nil {
+		return err
+	}
+	var upid proxmox.UPID
+	if err := call(&upid); err != nil {
+		return fmt.Errorf("unable to %s snapshot '%s' of VM %d: %w", operation, name, d.VMID, err)
+	}
+	if err := proxmox.NewTask(upid, d.client).Wait(context.Background(), d.taskInterval, d.taskTimeout); err != nil {
+		return fmt.Errorf("unable to %s snapshot '%s' of VM %d: %w", operation, name, d.VMID, err)
+	}
+	return nil
+}
+
+// CreateSnapshot takes a snapshot of the disks of the VM
+func (d *Driver) CreateSnapshot(name, description string) error {
+	if !validSnapshotName(name) {
+		return fmt.Errorf("invalid snapshot name '%s', use letters, digits, - and _", name)
+	}
+	d.debugf("creating snapshot '%s' of VM %d", name, d.VMID)
+	params := map[string]interface{}{"snapname": name, "description": description}
+	return d.snapshotTask("create", name, func(upid *proxmox.UPID) error {
+		return d.client.Post(context.Background(), d.snapshotPath(""), params, upid)
+	})
+}
+
+// ListSnapshots returns the snapshots of the VM, the oldest first
+func (d *Driver) ListSnapshots() ([]Snapshot, error) {
+	if err := d.connect(); err != nil {
+		return nil, err
+	}
+
+	var all []Snapshot
+	if err := d.client.Get(context.Background(), d.snapshotPath(""), &all); err != nil {
+		return nil, fmt.Errorf("unable to list the snapshots of VM %d: %w", d.VMID, err)
+	}
+	return sortSnapshots(all), nil
+}
+
+// sortSnapshots drops the current state of the VM from a snapshot listing
+// and sorts the snapshots by time
+func sortSnapshots(all []Snapshot) []Snapshot {
+	var snapshots []Snapshot
+	for _, s := range all {
+		if s.Name != "current" {
+			snapshots = append(snapshots, s)
+		}
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].SnapTime < snapshots[j].SnapTime
+	})
+	return snapshots
+}
+
+// DeleteSnapshot deletes a snapshot of the VM
+func (d *Driver) DeleteSnapshot(name string) error {
+	d.debugf("deleting snapshot '%s' of VM %d", name, d.VMID)
+	return d.snapshotTask("delete", name, func(upid *proxmox.UPID) error {
+		return d.client.Delete(context.Background(), d.snapshotPath(name), upid)
+	})
+}
+
+// RollbackSnapshot resets the VM to a snapshot. A running VM stopped by the
+// rollback of a snapshot without RAM is started again.
+func (d *Driver) RollbackSnapshot(name string) error {
+	vm, err := d.GetVM()
+	if err != nil {
+		return err
+	}
+	running := vm.Status == "running"
+
+	d.debugf("rolling VM %d back to snapshot '%s'", d.VMID, name)
+	err = d.snapshotTask("roll back to", name, func(upid *proxmox.UPID) error {
+		return d.client.Post(context.Background(), d.snapshotPath(name)+"/rollback", nil, upid)
+	})
+	if err != nil || !running {
+		return err
+	}
+
+	if vm, err = d.GetVM(); err != nil {
+		return err
+	}
+	if vm.Status == "running" {
+		return nil
+	}
+	return d.Start()
+}
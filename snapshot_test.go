@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SortSnapshots(t *testing.T) {
+	snapshots := sortSnapshots([]Snapshot{
+		{Name: "current", Parent: "upgrade"},
+		{Name: "upgrade", Parent: "provisioned", SnapTime: 1700000200},
+		{Name: "provisioned", SnapTime: 1700000100},
+	})
+
+	assert.Equal(t, []Snapshot{
+		{Name: "provisioned", SnapTime: 1700000100},
+		{Name: "upgrade", Parent: "provisioned", SnapTime: 1700000200},
+	}, snapshots)
+}
+
+func Test_SnapshotPath(t *testing.T) {
+	var driver = createDriver()
+	driver.Node = "pve1"
+	driver.VMID = 105
+
+	assert.Equal(t, "/nodes/pve1/qemu/105/snapshot", driver.snapshotPath(""))
+	assert.Equal(t, "/nodes/pve1/qemu/105/snapshot/provisioned", driver.snapshotPath("provisioned"))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// publicKeyPattern matches an authorized_keys line of a public key
+var publicKeyPattern = regexp.MustCompile(`^(?:ssh-(?:rsa|ed25519|dss)|ecdsa-sha2-nistp\d+|sk-[a-z0-9@.-]+)\s+[0-9A-Za-z+/]+=*(?:\s|$)`)
+
+// extraSSHKeys returns the public keys of SSHExtraKeys, given literally or as
+// the path of a local file with one key per line
+func (d *Driver) extraSSHKeys() ([]string, error) {
+	var keys []string
+	for _, value := range d.SSHExtraKeys {
+		value = strings.TrimSpace(value)
+		if publicKeyPattern.MatchString(value) {
+			keys = append(keys, value)
+			continue
+		}
+
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("neither a public key nor a readable file: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) == 0 || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if !publicKeyPattern.MatchString(line) {
+				return nil, fmt.Errorf("%s contains a line that isn't a public key: '%s'", value, line)
+			}
+			keys = append(keys, line)
+		}
+	}
+	return keys, nil
+}
+
+// mergeSSHKeys returns the authorized keys of the cloud-init sshkeys option:
+// the keys already set, unless they are replaced, followed by the given keys.
+// Keys already in the list aren't added twice.
+func mergeSSHKeys(existing string, replace bool, keys ...string) string {
+	var merged []string
+	seen := make(map[string]bool)
+	add := func(key string) {
+		key = strings.TrimSpace(key)
+		if len(key) == 0 || seen[key] {
+			return
+		}
+		seen[key] = true
+		merged = append(merged, key)
+	}
+
+	if !replace {
+		for _, key := range strings.Split(existing, "\n") {
+			add(key)
+		}
+	}
+	for _, key := range keys {
+		add(key)
+	}
+	return strings.Join(merged, "\n")
+}
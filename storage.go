@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// fileStorageTypes are the storage types keeping disks as files, the only
+// ones supporting the qcow2 and vmdk formats
+var fileStorageTypes = map[string]bool{"dir": true, "nfs": true, "cifs": true, "glusterfs": true, "cephfs": true}
+
+// storageStatus is the status of a storage on a node
+type storageStatus struct {
+	Content string `json:"content"` // comma separated content types, e.g. images,iso
+	Type    string `json:"type"`
+	Active  int    `json:"active"`
+	Enabled int    `json:"enabled"`
+	Shared  int    `json:"shared"`
+	Avail   uint64 `json:"avail"`
+	Total   uint64 `json:"total"`
+	Used    uint64 `json:"used"`
+}
+
+// storageVolume is a volume of a storage content listing
+type storageVolume struct {
+	Volid   string `json:"volid"`
+	Content string `json:"content"`
+	Format  string `json:"format"`
+	Size    uint64 `json:"size"`
+}
+
+// supports returns true if the storage accepts the given content type
+func (s *storageStatus) supports(content string) bool {
+	for _, c := range strings.Split(s.Content, ",") {
+		if strings.TrimSpace(c) == content {
+			return true
+		}
+	}
+	return false
+}
+
+// supportsFormat returns true if the storage can hold disks in the format
+func (s *storageStatus) supportsFormat(format string) bool {
+	return format == "" || format == "raw" || fileStorageTypes[s.Type]
+}
+
+// requiredSpace returns the bytes the disks of the VM take at most, the boot
+// disk and the extra disks
+func (d *Driver) requiredSpace() uint64 {
+	const gb = 1024 * 1024 * 1024
+	size, _ := strconv.Atoi(d.DiskSize)
+	for _, disk := range d.ExtraDisks {
+		if _, extra, err := parseExtraDisk(disk); err == nil {
+			size += extra
+		}
+	}
+	return uint64(size) * gb
+}
+
+func (d *Driver) getStorageStatus(node, storage string) (*storageStatus, error) {
+	if err := d.connect(); err != nil {
+		return nil, err
+	}
+
+	var status storageStatus
+	path := fmt.Sprintf("/nodes/%s/storage/%s/status", node, url.PathEscape(storage))
+	if err := d.client.Get(context.Background(), path, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (d *Driver) getStorageContent(node, storage, content string) ([]storageVolume, error) {
+	if err := d.connect(); err != nil {
+		return nil, err
+	}
+
+	var volumes []storageVolume
+	path := fmt.Sprintf("/nodes/%s/storage/%s/content?content=%s", node, url.PathEscape(storage), url.QueryEscape(content))
+	if err := d.client.Get(context.Background(), path, &volumes); err != nil {
+		return nil, err
+	}
+	return volumes, nil
+}
+
+// validateVolume checks that the storage of the volume exists on the node,
+// accepts the content type and holds the volume
+func (d *Driver) validateVolume(flag, volid, content string) []string {
+	storage, _, found := strings.Cut(volid, ":")
+	if !found {
+		return []string{fmt.Sprintf("%s must be in the form <storage>:%s/<file>, got '%s'", flag, content, volid)}
+	}
+
+	status, err := d.getStorageStatus(d.Node, storage)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: storage '%s' not found on node '%s': %s", flag, storage, d.Node, err)}
+	}
+	if !status.supports(content) {
+		return []string{fmt.Sprintf("%s: storage '%s' does not hold content type '%s' (content: %s)", flag, storage, content, status.Content)}
+	}
+
+	volumes, err := d.getStorageContent(d.Node, storage, content)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: unable to list storage '%s': %s", flag, storage, err)}
+	}
+	for _, v := range volumes {
+		if v.Volid == volid {
+			return nil
+		}
+	}
+
+	return []string{fmt.Sprintf("%s: volume '%s' not found on storage '%s' of node '%s'", flag, volid, storage, d.Node)}
+}
+
+// validateStorage checks that the storage the disks of the VM are put on
+// exists on the node and holds VM images
+func (d *Driver) validateStorage() []string {
+	if len(d.Storage) == 0 {
+		return nil
+	}
+
+	status, err := d.getStorageStatus(d.Node, d.Storage)
+	if err != nil {
+		return []string{fmt.Sprintf("proxmoxve-vm-storage-path: storage '%s' not found on node '%s': %s", d.Storage, d.Node, err)}
+	}
+	if !status.supports("images") {
+		return []string{fmt.Sprintf("proxmoxve-vm-storage-path: storage '%s' does not hold content type 'images' (content: %s), "+
+			"enable it under Datacenter > Storage", d.Storage, status.Content)}
+	}
+	if status.Active != 1 || status.Enabled != 1 {
+		return []string{fmt.Sprintf("proxmoxve-vm-storage-path: storage '%s' is not active on node '%s'", d.Storage, d.Node)}
+	}
+	if !status.supportsFormat(d.StorageType) {
+		return []string{fmt.Sprintf("proxmoxve-vm-storage-type: storage '%s' of type %s holds raw disks only, got '%s'", d.Storage, status.Type, d.StorageType)}
+	}
+	// linked clones take no space up front
+	if required := d.requiredSpace(); d.CloneFullMode != "0" && required > status.Avail {
+		return []string{fmt.Sprintf("proxmoxve-vm-storage-path: storage '%s' on node '%s' has %s free, the disks of the VM need %s",
+			d.Storage, d.Node, formatBytes(float64(status.Avail)), formatBytes(float64(required)))}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_StorageSupports(t *testing.T) {
+	status := storageStatus{Content: "vztmpl,iso, backup"}
+
+	assert.True(t, status.supports("iso"))
+	assert.True(t, status.supports("backup"))
+	assert.False(t, status.supports("images"))
+}
+
+func Test_ValidateVolumeFormat(t *testing.T) {
+	var driver = createDriver()
+
+	problems := driver.validateVolume("proxmoxve-vm-image-file", "ubuntu.iso", "iso")
+
+	assert.Equal(t, []string{"proxmoxve-vm-image-file must be in the form <storage>:iso/<file>, got 'ubuntu.iso'"}, problems)
+}
+
+func Test_StorageSupportsFormat(t *testing.T) {
+	lvm := storageStatus{Type: "lvmthin"}
+	nfs := storageStatus{Type: "nfs"}
+
+	assert.True(t, lvm.supportsFormat(""))
+	assert.True(t, lvm.supportsFormat("raw"))
+	assert.False(t, lvm.supportsFormat("qcow2"))
+	assert.True(t, nfs.supportsFormat("qcow2"))
+}
+
+func Test_RequiredSpace(t *testing.T) {
+	var driver = createDriver()
+	driver.DiskSize = "16"
+	driver.ExtraDisks = []string{"32", "scsi2=8"}
+
+	assert.Equal(t, uint64(56*1024*1024*1024), driver.requiredSpace())
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTaskTimeout  = 300
+	defaultTaskInterval = 5
+)
+
+// UnmarshalJSON loads the driver from the machine store. Stores written by
+// the upstream driver have the VMID as string next to VMID_int, both are
+// accepted.
+func (d *Driver) UnmarshalJSON(data []byte) error {
+	stored := struct {
+		*driverJSON
+		VMID    json.RawMessage
+		VMIDInt int `json:"VMID_int"`
+	}{driverJSON: (*driverJSON)(d)}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+
+	vmid, err := parseStoredVMID(stored.VMID)
+	if err != nil {
+		return err
+	}
+	if vmid == 0 {
+		vmid = stored.VMIDInt
+	}
+	d.VMID = vmid
+
+	d.normalize()
+	return nil
+}
+
+// parseStoredVMID parses a stored VMID given as number or string
+func parseStoredVMID(raw json.RawMessage) (int, error) {
+	value := strings.Trim(strings.TrimSpace(string(raw)), `"`)
+	if len(value) == 0 || value == "null" {
+		return 0, nil
+	}
+	vmid, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid VMID '%s' in machine store: %w", value, err)
+	}
+	return vmid, nil
+}
+
+// normalize derives the state which isn't stored from the stored fields, so
+// commands on an existing machine behave like the one creating it
+func (d *Driver) normalize() {
+	if d.TaskTimeout <= 0 {
+		d.TaskTimeout = defaultTaskTimeout
+	}
+	if d.TaskInterval <= 0 {
+		d.TaskInterval = defaultTaskInterval
+	}
+	d.taskTimeout = time.Duration(d.TaskTimeout) * time.Second
+	d.taskInterval = time.Duration(d.TaskInterval) * time.Second
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_UnmarshalStoredVMID(t *testing.T) {
+	for _, stored := range []string{
+		`{"VMID": 123, "Node": "pve1"}`,
+		`{"VMID": "123", "Node": "pve1"}`,
+		`{"VMID": "", "VMID_int": 123, "Node": "pve1"}`,
+	} {
+		var driver = createDriver()
+		assert.Nil(t, json.Unmarshal([]byte(stored), driver), stored)
+		assert.Equal(t, 123, driver.VMID, stored)
+		assert.Equal(t, "pve1", driver.Node, stored)
+		assert.Equal(t, 300*time.Second, driver.taskTimeout, stored)
+		assert.Equal(t, 5*time.Second, driver.taskInterval, stored)
+	}
+
+	var driver = createDriver()
+	assert.NotNil(t, json.Unmarshal([]byte(`{"VMID": "vm-123"}`), driver))
+}
+
+func Test_StoreRoundTrip(t *testing.T) {
+	var driver = createDriver()
+	driver.VMID = 150
+	driver.TaskTimeout = 600
+	driver.TaskInterval = 2
+
+	data, err := json.Marshal(driver)
+	assert.Nil(t, err)
+
+	var loaded = createDriver()
+	assert.Nil(t, json.Unmarshal(data, loaded))
+	assert.Equal(t, 150, loaded.VMID)
+	assert.Equal(t, 600*time.Second, loaded.taskTimeout)
+	assert.Equal(t, 2*time.Second, loaded.taskInterval)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// tlsConfig returns the TLS configuration for the API connection, verifying
+// the certificate against the system roots or the given CA file
+func (d *Driver) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: d.InsecureTLS}
+	if len(d.CAFile) == 0 {
+		return config, nil
+	}
+
+	pem, err := os.ReadFile(d.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM encoded certificate found in CA file %s", d.CAFile)
+	}
+	config.RootCAs = pool
+	return config, nil
+}
+
+// tlsError explains a certificate verification failure
+func tlsError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "x509:") {
+		return fmt.Errorf("%w: use --proxmoxve-proxmox-ca-file with the CA of the Proxmox VE certificate (e.g. /etc/pve/pve-root-ca.pem) or --proxmoxve-proxmox-insecure-tls to skip verification", err)
+	}
+	return err
+}
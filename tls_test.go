@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	get := func(driver *Driver) error {
+		config, err := driver.tlsConfig()
+		if err != nil {
+			return err
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return tlsError(err)
+	}
+
+	// verified by default
+	var driver = createDriver()
+	err := get(driver)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "--proxmoxve-proxmox-ca-file")
+
+	driver.InsecureTLS = true
+	assert.Nil(t, get(driver))
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	assert.Nil(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+	driver.InsecureTLS = false
+	driver.CAFile = path
+	assert.Nil(t, get(driver))
+
+	assert.Nil(t, os.WriteFile(path, []byte("no certificate"), 0600))
+	_, err = driver.tlsConfig()
+	assert.Error(t, err)
+}
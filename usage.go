@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// UsageSample is a data point of the RRD statistics of a VM
+type UsageSample struct {
+	Time      int64   `json:"time"`
+	CPU       float64 `json:"cpu"` // fraction of MaxCPU in use
+	MaxCPU    float64 `json:"maxcpu"`
+	Mem       float64 `json:"mem"` // bytes
+	MaxMem    float64 `json:"maxmem"`
+	Disk      float64 `json:"disk"` // bytes
+	MaxDisk   float64 `json:"maxdisk"`
+	DiskRead  float64 `json:"diskread"` // bytes per second
+	DiskWrite float64 `json:"diskwrite"`
+	NetIn     float64 `json:"netin"` // bytes per second
+	NetOut    float64 `json:"netout"`
+}
+
+// UsageSummary aggregates the samples of a timeframe
+type UsageSummary struct {
+	Samples int
+	Average UsageSample
+	Peak    UsageSample
+}
+
+var usageTimeframes = []string{"hour", "day", "week", "month", "year"}
+
+// GetUsage returns the CPU, memory, disk and network usage of the VM over the
+// given timeframe (hour, day, week, month or year), as recorded by Proxmox VE
+func (d *Driver) GetUsage(timeframe string) ([]UsageSample, error) {
+	valid := false
+	for _, t := range usageTimeframes {
+		valid = valid || t == timeframe
+	}
+	if !valid {
+		return nil, fmt.Errorf("timeframe must be one of %v, got '%s'", usageTimeframes, timeframe)
+	}
+	if err := d.connect(); err != nil {
+		return nil, err
+	}
+
+	var samples []UsageSample
+	path := fmt.Sprintf("/nodes/%s/qemu/%d/rrddata?timeframe=%s&cf=AVERAGE", d.Node, d.VMID, timeframe)
+	if err := d.client.Get(context.Background(), path, &samples); err != nil {
+		return nil, fmt.Errorf("unable to get the usage of VM %d: %w", d.VMID, err)
+	}
+	return samples, nil
+}
+
+// summarizeUsage returns the average and peak values of the samples, samples
+// without data (e.g. while the VM was stopped) are skipped
+func summarizeUsage(samples []UsageSample) UsageSummary {
+	var s UsageSummary
+	for _, u := range samples {
+		if u.MaxMem == 0 {
+			continue
+		}
+		s.Samples++
+		s.Average.CPU += u.CPU
+		s.Average.Mem += u.Mem
+		s.Average.DiskRead += u.DiskRead
+		s.Average.DiskWrite += u.DiskWrite
+		s.Average.NetIn += u.NetIn
+		s.Average.NetOut += u.NetOut
+
+		s.Peak.CPU = math.Max(s.Peak.CPU, u.CPU)
+		s.Peak.Mem = math.Max(s.Peak.Mem, u.Mem)
+		s.Peak.DiskRead = math.Max(s.Peak.DiskRead, u.DiskRead)
+		s.Peak.DiskWrite = math.Max(s.Peak.DiskWrite, u.DiskWrite)
+		s.Peak.NetIn = math.Max(s.Peak.NetIn, u.NetIn)
+		s.Peak.NetOut = math.Max(s.Peak.NetOut, u.NetOut)
+
+		// capacities are taken from the latest sample
+		s.Average.Time, s.Peak.Time = u.Time, u.Time
+		s.Average.MaxCPU, s.Peak.MaxCPU = u.MaxCPU, u.MaxCPU
+		s.Average.MaxMem, s.Peak.MaxMem = u.MaxMem, u.MaxMem
+		s.Average.Disk, s.Peak.Disk = u.Disk, u.Disk
+		s.Average.MaxDisk, s.Peak.MaxDisk = u.MaxDisk, u.MaxDisk
+	}
+	if s.Samples > 0 {
+		n := float64(s.Samples)
+		s.Average.CPU /= n
+		s.Average.Mem /= n
+		s.Average.DiskRead /= n
+		s.Average.DiskWrite /= n
+		s.Average.NetIn /= n
+		s.Average.NetOut /= n
+	}
+	return s
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SummarizeUsage(t *testing.T) {
+	summary := summarizeUsage([]UsageSample{
+		{Time: 60, CPU: 0.2, MaxCPU: 4, Mem: 1024, MaxMem: 4096, NetIn: 100},
+		{Time: 120}, // VM stopped
+		{Time: 180, CPU: 0.6, MaxCPU: 4, Mem: 3072, MaxMem: 4096, NetIn: 300},
+	})
+
+	assert.Equal(t, 2, summary.Samples)
+	assert.InDelta(t, 0.4, summary.Average.CPU, 0.0001)
+	assert.Equal(t, 0.6, summary.Peak.CPU)
+	assert.Equal(t, 2048.0, summary.Average.Mem)
+	assert.Equal(t, 3072.0, summary.Peak.Mem)
+	assert.Equal(t, 200.0, summary.Average.NetIn)
+	assert.Equal(t, 4096.0, summary.Average.MaxMem)
+	assert.Equal(t, int64(180), summary.Average.Time)
+
+	assert.Equal(t, 0, summarizeUsage(nil).Samples)
+}
+
+func Test_FormatBytes(t *testing.T) {
+	assert.Equal(t, "512.0 B", formatBytes(512))
+	assert.Equal(t, "1.5 GiB", formatBytes(1.5*1024*1024*1024))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+)
+
+// pveVersion is the major and minor version of Proxmox VE
+type pveVersion struct {
+	Major int
+	Minor int
+}
+
+var (
+	// minimumPVEVersion is the oldest release the driver supports
+	minimumPVEVersion = pveVersion{7, 0}
+	// newestTestedPVEMajor is the newest major release the driver is tested with
+	newestTestedPVEMajor = 8
+)
+
+// parsePVEVersion parses a version like 8.2.4 or 7.4-3
+func parsePVEVersion(version string) (pveVersion, error) {
+	major, rest, _ := strings.Cut(version, ".")
+	minor := strings.FieldsFunc(rest, func(r rune) bool { return r == '.' || r == '-' })
+	v := pveVersion{}
+	var err error
+	if v.Major, err = strconv.Atoi(major); err != nil {
+		return v, fmt.Errorf("unexpected Proxmox VE version '%s'", version)
+	}
+	if len(minor) > 0 {
+		if v.Minor, err = strconv.Atoi(minor[0]); err != nil {
+			return v, fmt.Errorf("unexpected Proxmox VE version '%s'", version)
+		}
+	}
+	return v, nil
+}
+
+func (v pveVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// atLeast returns true if the version is the given one or newer
+func (v pveVersion) atLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// checkPVEVersion fails for releases older than minimumPVEVersion and warns
+// about major releases newer than the tested ones
+func checkPVEVersion(v pveVersion) error {
+	if !v.atLeast(minimumPVEVersion.Major, minimumPVEVersion.Minor) {
+		return fmt.Errorf("Proxmox VE %s is not supported, %s or later is required", v, minimumPVEVersion)
+	}
+	if v.Major > newestTestedPVEMajor {
+		log.Warnf("Proxmox VE %s is newer than the releases the driver is tested with (up to %d.x)", v, newestTestedPVEMajor)
+	}
+	return nil
+}
+
+// validateVersion checks that the features in use are available in the
+// Proxmox VE release of the cluster
+func (d *Driver) validateVersion() []string {
+	var problems []string
+	check := func(major, minor int, flag string) {
+		if !d.pveVersion.atLeast(major, minor) {
+			problems = append(problems, fmt.Sprintf("%s requires Proxmox VE %d.%d or later, the cluster runs %s", flag, major, minor, d.pveVersion))
+		}
+	}
+
+	if len(d.CloudImageURL) > 0 {
+		// the import content type of storages
+		check(8, 2, "proxmoxve-vm-cloud-image-url")
+	}
+	if d.IPSource == ipSourceLease {
+		// DHCP of SDN zones
+		check(8, 1, "proxmoxve-ip-source dhcp-lease")
+	}
+	if len(d.LookupTag) > 0 {
+		// tags in the cluster resources
+		check(7, 3, "proxmoxve-vm-lookup-tag")
+	}
+	return problems
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParsePVEVersion(t *testing.T) {
+	v, err := parsePVEVersion("8.2.4")
+	assert.Nil(t, err)
+	assert.Equal(t, pveVersion{8, 2}, v)
+	v, err = parsePVEVersion("7.4-3")
+	assert.Nil(t, err)
+	assert.Equal(t, pveVersion{7, 4}, v)
+	_, err = parsePVEVersion("pve")
+	assert.NotNil(t, err)
+
+	assert.True(t, v.atLeast(7, 3))
+	assert.True(t, v.atLeast(6, 9))
+	assert.False(t, v.atLeast(8, 0))
+
+	assert.Nil(t, checkPVEVersion(pveVersion{9, 0}))
+	assert.EqualError(t, checkPVEVersion(pveVersion{6, 4}), "Proxmox VE 6.4 is not supported, 7.0 or later is required")
+}
+
+func Test_ValidateVersion(t *testing.T) {
+	var driver = createDriver()
+	driver.pveVersion = pveVersion{8, 1}
+	driver.CloudImageURL = "https://cloud-images.ubuntu.com/noble/current/noble-server-cloudimg-amd64.img"
+	driver.IPSource = ipSourceLease
+
+	assert.Equal(t, []string{"proxmoxve-vm-cloud-image-url requires Proxmox VE 8.2 or later, the cluster runs 8.1"}, driver.validateVersion())
+
+	driver.pveVersion = pveVersion{8, 2}
+	assert.Empty(t, driver.validateVersion())
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// nextVMID asks the cluster for the next free VMID
+func (d *Driver) nextVMID() (int, error) {
+	if err := d.connect(); err != nil {
+		return 0, err
+	}
+
+	// returned as string by some versions
+	var next json.Number
+	if err := d.client.Get(context.Background(), "/cluster/nextid", &next); err != nil {
+		return 0, fmt.Errorf("unable to get the next VMID of the cluster: %w", err)
+	}
+	id, err := strconv.Atoi(next.String())
+	if err != nil {
+		return 0, fmt.Errorf("unexpected next VMID '%s': %w", next, err)
+	}
+	return id, nil
+}
+
+// usedVMIDs returns the IDs of the VMs and containers of the cluster
+func (d *Driver) usedVMIDs() (map[int]bool, error) {
+	vms, err := d.getClusterVMs()
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[int]bool)
+	for _, vm := range vms {
+		used[vm.VMID] = true
+	}
+	return used, nil
+}
+
+// pickVMID randomly chooses one of the IDs between min and max (both
+// inclusive) which isn't used yet. The n-th free ID is found by skipping the
+// used IDs below it, so large ranges cost no memory.
+func pickVMID(min, max int, used map[int]bool) (int, error) {
+	var taken []int
+	for id := range used {
+		if id >= min && id <= max {
+			taken = append(taken, id)
+		}
+	}
+	free := max - min + 1 - len(taken)
+	if free <= 0 {
+		return 0, fmt.Errorf("all VMIDs between %d and %d are in use", min, max)
+	}
+
+	sort.Ints(taken)
+	id := min + rand.Intn(free)
+	for _, t := range taken {
+		if t <= id {
+			id++
+		}
+	}
+	return id, nil
+}
+
+// allocateVMID returns an unused ID for the new VM, chosen from VMIDRange or,
+// if no range is given, the next free ID of the cluster
+func (d *Driver) allocateVMID() (int, error) {
+	used, err := d.usedVMIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	if len(d.VMIDRange) > 0 {
+		min, max, err := d.parseVmidRange()
+		if err != nil {
+			return 0, err
+		}
+		if id, err = pickVMID(min, max, used); err != nil {
+			return 0, err
+		}
+	} else {
+		if id, err = d.nextVMID(); err != nil {
+			return 0, err
+		}
+		if used[id] {
+			return 0, fmt.Errorf("VMID %d returned by the cluster is already in use", id)
+		}
+	}
+	d.debugf("allocated VMID %d", id)
+	return id, nil
+}
+
+// isVMIDCollision returns true if the VMID was taken by someone else between
+// allocating and using it. Only the messages of Proxmox VE about the ID itself
+// count, an existing disk or HA resource of the new VM is a failure of its own.
+func isVMIDCollision(err error, id int) bool {
+	msg := err.Error()
+	return strings.Contains(msg, fmt.Sprintf("VM %d already exists", id)) ||
+		strings.Contains(msg, fmt.Sprintf("CT %d already exists", id)) ||
+		strings.Contains(msg, fmt.Sprintf("unable to create VM %d: config file already exists", id))
+}
+
+// createWithFreeVMID allocates a VMID and creates the VM with it. Concurrent
+// creates may allocate the same ID, so the creation is retried with another
+// one after a random delay up to VMIDRetries times.
+func (d *Driver) createWithFreeVMID() error {
+	for attempt := 0; ; attempt++ {
+		newId, err := d.allocateVMID()
+		if err == nil {
+			switch {
+			case len(d.CloneVMID) > 0:
+				err = d.cloneTemplate(newId)
+			case len(d.CloudImageURL) > 0:
+				err = d.createFromCloudImage(newId)
+			default:
+				err = d.createFromISO(newId)
+			}
+		}
+		if err == nil || !isVMIDCollision(err, newId) || attempt >= d.VMIDRetries {
+			return err
+		}
+
+		// the VM with the ID belongs to someone else and must not be rolled back
+		d.VMID = 0
+		jitter := time.Duration(rand.Int63n(int64(time.Second)))
+		log.Warnf("VMID taken by a concurrent create, retrying with another one in %s: %s", jitter, err)
+		time.Sleep(jitter)
+	}
+}
+
+// matchVM returns the VM (no template) with the given name and, if not empty,
+// tag. More than one match is an error, as the VM to manage is ambiguous.
+func matchVM(vms []clusterVM, name, tag string) (*clusterVM, error) {
+	var found []clusterVM
+	for _, vm := range vms {
+		if vm.Template == 1 || vm.Name != name {
+			continue
+		}
+		if len(tag) > 0 && !strings.Contains(";"+strings.Join(splitTags(vm.Tags), ";")+";", ";"+tag+";") {
+			continue
+		}
+		found = append(found, vm)
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no VM named '%s' found", name)
+	case 1:
+		return &found[0], nil
+	}
+	ids := make([]string, len(found))
+	for i, vm := range found {
+		ids[i] = strconv.Itoa(vm.VMID)
+	}
+	return nil, fmt.Errorf("VMs %s are all named '%s', set --proxmoxve-vm-lookup-tag to tell them apart", strings.Join(ids, ", "), name)
+}
+
+// recoverVMID sets VMID and Node of a machine whose store lost them by
+// looking up the VM by its name among the VMs tagged LookupTag. Without the
+// tag any VM of the same name would be taken over. A recovered VM is never
+// removed, as the VMID is stored along with the machine.
+func (d *Driver) recoverVMID() error {
+	if len(d.LookupTag) == 0 {
+		return fmt.Errorf("machine has no VMID, set --proxmoxve-vm-lookup-tag to look its VM up by name")
+	}
+	name := d.VMName
+	if len(name) == 0 {
+		name = d.MachineName
+	}
+
+	vms, err := d.getClusterVMs()
+	if err != nil {
+		return err
+	}
+	vm, err := matchVM(vms, name, d.LookupTag)
+	if err != nil {
+		return err
+	}
+
+	log.Warnf("machine has no VMID, using VM %d '%s' on node %s, which is never removed", vm.VMID, vm.Name, vm.Node)
+	d.VMID = vm.VMID
+	d.Node = vm.Node
+	d.VMIDRecovered = true
+	return nil
+}
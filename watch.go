@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WatchEvent is a change of a VM noticed by Watch
+type WatchEvent struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"` // state, node or task
+	VMID int       `json:"vmid"`
+	Node string    `json:"node"`
+	Old  string    `json:"old,omitempty"`
+	New  string    `json:"new,omitempty"`
+	Task *vmTask   `json:"task,omitempty"`
+}
+
+func (e WatchEvent) String() string {
+	switch e.Type {
+	case "task":
+		return fmt.Sprintf("%s VM %d: task %s by %s on %s: %s", e.Time.Format(time.RFC3339), e.VMID, e.Task.Type, e.Task.User, e.Node, e.Task.Status)
+	case "node":
+		return fmt.Sprintf("%s VM %d: moved from node %s to %s", e.Time.Format(time.RFC3339), e.VMID, e.Old, e.New)
+	default:
+		return fmt.Sprintf("%s VM %d on %s: %s -> %s", e.Time.Format(time.RFC3339), e.VMID, e.Node, e.Old, e.New)
+	}
+}
+
+// vmTask is a task of the node task list
+type vmTask struct {
+	UPID      string `json:"upid"`
+	Type      string `json:"type"`
+	User      string `json:"user"`
+	Status    string `json:"status"`
+	StartTime int64  `json:"starttime"`
+	EndTime   int64  `json:"endtime"`
+}
+
+// getClusterVM returns the VM from the cluster resources, which knows the
+// current node of the VM even after a migration
+func (d *Driver) getClusterVM() (*clusterVM, error) {
+	vms, err := d.getClusterVMs()
+	if err != nil {
+		return nil, err
+	}
+	for _, vm := range vms {
+		if vm.VMID == d.VMID {
+			return &vm, nil
+		}
+	}
+	return nil, fmt.Errorf("VM %d not found in the cluster", d.VMID)
+}
+
+// getTasks returns the finished tasks of the VM started since the given time
+func (d *Driver) getTasks(node string, since int64) ([]vmTask, error) {
+	var tasks []vmTask
+	path := fmt.Sprintf("/nodes/%s/tasks?vmid=%d&since=%d", node, d.VMID, since)
+	if err := d.client.Get(context.Background(), path, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// Watch polls the status, node and task list of the VM every interval and
+// calls emit for every change until the context is done, so out-of-band
+// shutdowns or migrations of the machine can be reacted on
+func (d *Driver) Watch(ctx context.Context, interval time.Duration, emit func(WatchEvent)) error {
+	if err := d.connect(); err != nil {
+		return err
+	}
+
+	var last *clusterVM
+	since := time.Now().Unix()
+	seen := make(map[string]bool)
+	for {
+		vm, err := d.getClusterVM()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+
+		if last != nil && last.Node != vm.Node {
+			emit(WatchEvent{Time: now, Type: "node", VMID: d.VMID, Node: vm.Node, Old: last.Node, New: vm.Node})
+		}
+		if last == nil || last.Status != vm.Status {
+			old := ""
+			if last != nil {
+				old = last.Status
+			}
+			emit(WatchEvent{Time: now, Type: "state", VMID: d.VMID, Node: vm.Node, Old: old, New: vm.Status})
+		}
+		d.Node = vm.Node
+		last = vm
+
+		tasks, err := d.getTasks(vm.Node, since)
+		if err != nil {
+			return err
+		}
+		for i := len(tasks) - 1; i >= 0; i-- {
+			t := tasks[i]
+			if seen[t.UPID] {
+				continue
+			}
+			seen[t.UPID] = true
+			emit(WatchEvent{Time: time.Unix(t.EndTime, 0), Type: "task", VMID: d.VMID, Node: vm.Node, Task: &t})
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WatchEventString(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, "2024-05-01T12:00:00Z VM 142 on pve01: running -> stopped",
+		WatchEvent{Time: at, Type: "state", VMID: 142, Node: "pve01", Old: "running", New: "stopped"}.String())
+	assert.Equal(t, "2024-05-01T12:00:00Z VM 142: moved from node pve01 to pve02",
+		WatchEvent{Time: at, Type: "node", VMID: 142, Node: "pve02", Old: "pve01", New: "pve02"}.String())
+	assert.Equal(t, "2024-05-01T12:00:00Z VM 142: task qmshutdown by root@pam on pve01: OK",
+		WatchEvent{Time: at, Type: "task", VMID: 142, Node: "pve01", Task: &vmTask{Type: "qmshutdown", User: "root@pam", Status: "OK"}}.String())
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// webhookEvent is the payload of a lifecycle webhook and the data available
+// to --proxmoxve-webhook-template
+type webhookEvent struct {
+	Event       string `json:"event"`  // create, start, stop or remove
+	Status      string `json:"status"` // success or failure
+	Error       string `json:"error,omitempty"`
+	MachineName string `json:"machine_name"`
+	VMName      string `json:"vm_name"`
+	VMID        int    `json:"vmid"`
+	Node        string `json:"node"`
+	IPAddress   string `json:"ip_address,omitempty"`
+	Time        string `json:"time"`
+}
+
+// validateWebhook returns the problems of the webhook flags
+func (d *Driver) validateWebhook() []string {
+	var problems []string
+	for _, e := range d.WebhookEvents {
+		if e != "create" && e != "start" && e != "stop" && e != "remove" {
+			problems = append(problems, fmt.Sprintf("proxmoxve-webhook-events must be create, start, stop or remove, got '%s'", e))
+		}
+	}
+	if len(d.WebhookTemplate) > 0 {
+		if _, err := template.New("webhook").Parse(d.WebhookTemplate); err != nil {
+			problems = append(problems, fmt.Sprintf("proxmoxve-webhook-template is invalid: %s", err))
+		}
+	}
+	return problems
+}
+
+// webhookEnabled returns true if a webhook is configured for the event
+func (d *Driver) webhookEnabled(event string) bool {
+	if len(d.WebhookURL) == 0 {
+		return false
+	}
+	if len(d.WebhookEvents) == 0 {
+		return true
+	}
+	for _, e := range d.WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookBody renders the payload of the event, as json unless a template is given
+func (d *Driver) webhookBody(e webhookEvent) ([]byte, error) {
+	if len(d.WebhookTemplate) == 0 {
+		return json.Marshal(e)
+	}
+
+	tmpl, err := template.New("webhook").Parse(d.WebhookTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %w", err)
+	}
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, e); err != nil {
+		return nil, fmt.Errorf("unable to render webhook template: %w", err)
+	}
+	return body.Bytes(), nil
+}
+
+// notify posts the outcome of a lifecycle operation to the webhook. A failing
+// webhook is logged only, it never fails the operation itself.
+func (d *Driver) notify(event string, opErr error) {
+	if !d.webhookEnabled(event) {
+		return
+	}
+
+	e := webhookEvent{
+		Event:       event,
+		Status:      "success",
+		MachineName: d.MachineName,
+		VMName:      d.VMName,
+		VMID:        d.VMID,
+		Node:        d.Node,
+		IPAddress:   d.IPAddress,
+		Time:        time.Now().UTC().Format(time.RFC3339),
+	}
+	if opErr != nil {
+		e.Status = "failure"
+		e.Error = opErr.Error()
+	}
+
+	body, err := d.webhookBody(e)
+	if err != nil {
+		log.Warnf("webhook for %s not sent: %s", event, err)
+		return
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(d.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Warnf("webhook for %s failed: %s", event, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Warnf("webhook for %s failed: %s", event, resp.Status)
+		return
+	}
+	d.debugf("webhook for %s (%s) sent", event, e.Status)
+}
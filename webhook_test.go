@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Webhook(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	var driver = createDriver()
+	driver.MachineName = "worker-1"
+	driver.VMID = 142
+	driver.WebhookURL = server.URL
+	driver.WebhookEvents = []string{"create", "remove"}
+	driver.WebhookTemplate = `{"text": "{{.MachineName}} ({{.VMID}}) {{.Event}}: {{.Status}}{{with .Error}} {{.}}{{end}}"}`
+	assert.Empty(t, driver.validateWebhook())
+
+	driver.notify("create", nil)
+	driver.notify("stop", nil)
+	driver.notify("remove", errors.New("VM is protected"))
+
+	assert.Equal(t, []string{
+		`{"text": "worker-1 (142) create: success"}`,
+		`{"text": "worker-1 (142) remove: failure VM is protected"}`,
+	}, bodies)
+
+	driver.WebhookEvents = []string{"destroy"}
+	driver.WebhookTemplate = "{{.MachineName"
+	assert.Len(t, driver.validateWebhook(), 2)
+}